@@ -0,0 +1,138 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// translate renders the Envoy configuration Kourier generates for the Ingresses
+// in the given manifests, without a cluster.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/runtime"
+	"knative.dev/net-kourier/pkg/translate"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/system"
+)
+
+// files collects the values of a repeated flag.
+type files []string
+
+func (f *files) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *files) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	var inputs files
+	flag.Var(&inputs, "f", "Manifest file to read, or - for stdin. Can be repeated.")
+	output := flag.String("o", string(translate.FormatYAML), "Output format, either yaml or json.")
+	namespace := flag.String("system-namespace", "knative-serving", "Namespace Kourier is installed in, unless SYSTEM_NAMESPACE is set.")
+	verbose := flag.Bool("v", false, "Log the progress of the translation.")
+	redact := flag.Bool("redact", true, "Redact private keys and secrets in the output.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -f <manifest> [-f <manifest>...] [-o yaml|json]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Prints the Envoy configuration Kourier generates for the Ingresses in the given manifests.")
+		fmt.Fprintln(flag.CommandLine.Output(), "The config-kourier and config-network ConfigMaps in the manifests configure the translation.")
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(inputs) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if os.Getenv(system.NamespaceEnvKey) == "" {
+		os.Setenv(system.NamespaceEnvKey, *namespace)
+	}
+
+	if err := run(inputs, translate.Format(*output), *verbose, *redact, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(inputs []string, format translate.Format, verbose, redact bool, out io.Writer) error {
+	level := zapcore.WarnLevel
+	if verbose {
+		level = zapcore.DebugLevel
+	}
+	cfg := zap.NewDevelopmentConfig()
+	cfg.Level = zap.NewAtomicLevelAt(level)
+	logger, err := cfg.Build()
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	defer logger.Sync() //nolint:errcheck // Nothing to do about unflushed logs.
+	ctx := logging.WithLogger(context.Background(), logger.Sugar())
+
+	var objects []runtime.Object
+	for _, input := range inputs {
+		objs, err := decodeFile(input)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, objs...)
+	}
+
+	snapshots, err := translate.Snapshots(ctx, objects)
+	if err != nil {
+		return err
+	}
+	var opts []translate.RenderOption
+	if !redact {
+		opts = append(opts, translate.WithSecrets())
+	}
+	rendered, err := translate.Render(snapshots, format, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(rendered)
+	return err
+}
+
+func decodeFile(name string) ([]runtime.Object, error) {
+	if name == "-" {
+		objs, err := translate.Decode(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		return objs, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	objs, err := translate.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return objs, nil
+}
@@ -24,10 +24,24 @@ import (
 
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	httpOptions "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	envoytypev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
+	"knative.dev/networking/pkg/http/header"
 )
 
+// httpProtocolOptionsKey is the key of the HTTP protocol options in the typed
+// extension protocol options of a cluster.
+const httpProtocolOptionsKey = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+
+// ClusterOption further configures a cluster generated by NewCluster.
+type ClusterOption func(*envoyclusterv3.Cluster)
+
 // NewCluster generates a new v3.Cluster with the given settings.
 func NewCluster(
 	name string,
@@ -35,6 +49,7 @@ func NewCluster(
 	endpoints []*endpoint.LbEndpoint,
 	isHTTP2 bool, transportSocket *envoycorev3.TransportSocket,
 	discoveryType envoyclusterv3.Cluster_DiscoveryType,
+	opts ...ClusterOption,
 ) *envoyclusterv3.Cluster {
 	cluster := &envoyclusterv3.Cluster{
 		Name: name,
@@ -52,18 +67,263 @@ func NewCluster(
 	}
 
 	if isHTTP2 {
-		opts, _ := anypb.New(&httpOptions.HttpProtocolOptions{
-			UpstreamProtocolOptions: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig_{
-				ExplicitHttpConfig: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig{
-					ProtocolConfig: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{},
-				},
-			},
-		})
+		opts, _ := anypb.New(httpProtocolOptions(true))
 
 		cluster.TypedExtensionProtocolOptions = map[string]*anypb.Any{
-			"envoy.extensions.upstreams.http.v3.HttpProtocolOptions": opts,
+			httpProtocolOptionsKey: opts,
 		}
 	}
 
+	for _, opt := range opts {
+		opt(cluster)
+	}
+
 	return cluster
 }
+
+// WithLocalityLB replaces the endpoints of the cluster with the given localities and
+// balances the load between them according to the given policy.
+//
+// Zone aware routing requires the gateway to know its own zone and to have a local
+// cluster configured in its bootstrap, whose endpoints are the gateways.
+// Ref: https://www.envoyproxy.io/docs/envoy/latest/intro/arch_overview/upstream/load_balancing/zone_aware
+func WithLocalityLB(localities []*endpoint.LocalityLbEndpoints, policy config.LocalityLBPolicy) ClusterOption {
+	return func(cluster *envoyclusterv3.Cluster) {
+		cluster.LoadAssignment.Endpoints = localities
+
+		switch policy {
+		case config.LocalityLBPolicyWeighted:
+			// Weigh each locality by the amount of endpoints it contains, so that
+			// every endpoint still receives the same share of the traffic.
+			for _, locality := range localities {
+				locality.LoadBalancingWeight = wrapperspb.UInt32(uint32(len(locality.GetLbEndpoints()))) //#nosec G115
+			}
+			cluster.CommonLbConfig = &envoyclusterv3.Cluster_CommonLbConfig{
+				LocalityConfigSpecifier: &envoyclusterv3.Cluster_CommonLbConfig_LocalityWeightedLbConfig_{
+					LocalityWeightedLbConfig: &envoyclusterv3.Cluster_CommonLbConfig_LocalityWeightedLbConfig{},
+				},
+			}
+		case config.LocalityLBPolicyZoneAware:
+			cluster.CommonLbConfig = &envoyclusterv3.Cluster_CommonLbConfig{
+				LocalityConfigSpecifier: &envoyclusterv3.Cluster_CommonLbConfig_ZoneAwareLbConfig_{
+					ZoneAwareLbConfig: &envoyclusterv3.Cluster_CommonLbConfig_ZoneAwareLbConfig{},
+				},
+			}
+		}
+	}
+}
+
+// WithOutlierDetection ejects the endpoints of the cluster that fail according to
+// the given configuration. Only consecutive 5xx responses eject endpoints, the
+// success rate based detection Envoy enables by default is disabled.
+func WithOutlierDetection(outlierDetection config.OutlierDetection) ClusterOption {
+	return func(cluster *envoyclusterv3.Cluster) {
+		od := &envoyclusterv3.OutlierDetection{
+			Consecutive_5Xx:      wrapperspb.UInt32(outlierDetection.Consecutive5xx),
+			EnforcingSuccessRate: wrapperspb.UInt32(0),
+		}
+		if outlierDetection.Interval != 0 {
+			od.Interval = durationpb.New(outlierDetection.Interval)
+		}
+		if outlierDetection.BaseEjectionTime != 0 {
+			od.BaseEjectionTime = durationpb.New(outlierDetection.BaseEjectionTime)
+		}
+		if outlierDetection.MaxEjectionPercent != 0 {
+			od.MaxEjectionPercent = wrapperspb.UInt32(outlierDetection.MaxEjectionPercent)
+		}
+		cluster.OutlierDetection = od
+	}
+}
+
+// WithCircuitBreakers sets the given thresholds of the cluster. Thresholds that
+// aren't set keep Envoy's defaults.
+func WithCircuitBreakers(circuitBreakers config.CircuitBreakers) ClusterOption {
+	return func(cluster *envoyclusterv3.Cluster) {
+		thresholds := &envoyclusterv3.CircuitBreakers_Thresholds{}
+		for _, t := range []struct {
+			into  **wrapperspb.UInt32Value
+			value uint32
+		}{
+			{&thresholds.MaxConnections, circuitBreakers.MaxConnections},
+			{&thresholds.MaxPendingRequests, circuitBreakers.MaxPendingRequests},
+			{&thresholds.MaxRequests, circuitBreakers.MaxRequests},
+			{&thresholds.MaxRetries, circuitBreakers.MaxRetries},
+		} {
+			if t.value != 0 {
+				*t.into = wrapperspb.UInt32(t.value)
+			}
+		}
+		cluster.CircuitBreakers = &envoyclusterv3.CircuitBreakers{
+			Thresholds: []*envoyclusterv3.CircuitBreakers_Thresholds{thresholds},
+		}
+	}
+}
+
+// WithConnectionPool configures how connections to the endpoints of the cluster
+// are reused. The connect timeout is an argument of NewCluster instead. The
+// protocol has to be the one the cluster was created with.
+func WithConnectionPool(pool config.ConnectionPool, isHTTP2 bool) ClusterOption {
+	return func(cluster *envoyclusterv3.Cluster) {
+		if !pool.HasHTTPProtocolOptions() {
+			return
+		}
+
+		opts := httpProtocolOptions(isHTTP2)
+		if pool.MaxRequestsPerConnection != 0 || pool.IdleTimeout != 0 {
+			opts.CommonHttpProtocolOptions = &envoycorev3.HttpProtocolOptions{}
+			if pool.MaxRequestsPerConnection != 0 {
+				opts.CommonHttpProtocolOptions.MaxRequestsPerConnection = wrapperspb.UInt32(pool.MaxRequestsPerConnection)
+			}
+			if pool.IdleTimeout != 0 {
+				opts.CommonHttpProtocolOptions.IdleTimeout = durationpb.New(pool.IdleTimeout)
+			}
+		}
+
+		// The maximum of concurrent streams only applies to HTTP/2.
+		if http2 := opts.GetExplicitHttpConfig().GetHttp2ProtocolOptions(); http2 != nil && pool.HTTP2MaxConcurrentStreams != 0 {
+			http2.MaxConcurrentStreams = wrapperspb.UInt32(pool.HTTP2MaxConcurrentStreams)
+		}
+
+		marshaled, _ := anypb.New(opts)
+		if cluster.TypedExtensionProtocolOptions == nil {
+			cluster.TypedExtensionProtocolOptions = map[string]*anypb.Any{}
+		}
+		cluster.TypedExtensionProtocolOptions[httpProtocolOptionsKey] = marshaled
+	}
+}
+
+// httpProtocolOptions returns the HTTP protocol options of a cluster using the
+// given protocol.
+func httpProtocolOptions(isHTTP2 bool) *httpOptions.HttpProtocolOptions {
+	explicit := &httpOptions.HttpProtocolOptions_ExplicitHttpConfig{
+		ProtocolConfig: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig_HttpProtocolOptions{},
+	}
+	if isHTTP2 {
+		explicit.ProtocolConfig = &httpOptions.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{
+			Http2ProtocolOptions: &envoycorev3.Http2ProtocolOptions{},
+		}
+	}
+	return &httpOptions.HttpProtocolOptions{
+		UpstreamProtocolOptions: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig_{
+			ExplicitHttpConfig: explicit,
+		},
+	}
+}
+
+// lbPolicies maps the load balancing policies to Envoy's.
+var lbPolicies = map[config.LBPolicy]envoyclusterv3.Cluster_LbPolicy{
+	config.LBPolicyRoundRobin:   envoyclusterv3.Cluster_ROUND_ROBIN,
+	config.LBPolicyLeastRequest: envoyclusterv3.Cluster_LEAST_REQUEST,
+	config.LBPolicyRingHash:     envoyclusterv3.Cluster_RING_HASH,
+	config.LBPolicyMaglev:       envoyclusterv3.Cluster_MAGLEV,
+	config.LBPolicyRandom:       envoyclusterv3.Cluster_RANDOM,
+}
+
+// WithLBPolicy picks the endpoints of the cluster according to the given policy.
+// Hash based policies hash requests by the hash policy of their route, see
+// WithSessionAffinity.
+func WithLBPolicy(policy config.LBPolicy) ClusterOption {
+	return func(cluster *envoyclusterv3.Cluster) {
+		cluster.LbPolicy = lbPolicies[policy]
+	}
+}
+
+// The defaults of the fields of health checks that aren't configured. Envoy
+// requires them to be set.
+const (
+	defaultHealthCheckPath               = "/"
+	defaultHealthCheckInterval           = 10 * time.Second
+	defaultHealthCheckTimeout            = time.Second
+	defaultHealthCheckHealthyThreshold   = 1
+	defaultHealthCheckUnhealthyThreshold = 3
+)
+
+// queueProxyProbeValue is the value of the K-Network-Probe header the queue proxy
+// of a Knative revision answers itself, reporting whether the revision is ready.
+const queueProxyProbeValue = "queue"
+
+// WithHealthCheck actively checks the health of the endpoints of the cluster
+// according to the given configuration, in addition to their readiness reported
+// by Kubernetes. HTTP checks are sent with the protocol of the cluster, which has
+// to be HTTP/2 for gRPC checks. HTTP checks without a path are probes of the queue
+// proxy.
+func WithHealthCheck(healthCheck config.HealthCheck, isHTTP2 bool) ClusterOption {
+	return func(cluster *envoyclusterv3.Cluster) {
+		hc := &envoycorev3.HealthCheck{
+			Interval:           durationpb.New(valueOrDefault(healthCheck.Interval, defaultHealthCheckInterval)),
+			Timeout:            durationpb.New(valueOrDefault(healthCheck.Timeout, defaultHealthCheckTimeout)),
+			HealthyThreshold:   wrapperspb.UInt32(valueOrDefault(healthCheck.HealthyThreshold, defaultHealthCheckHealthyThreshold)),
+			UnhealthyThreshold: wrapperspb.UInt32(valueOrDefault(healthCheck.UnhealthyThreshold, defaultHealthCheckUnhealthyThreshold)),
+		}
+
+		switch healthCheck.Type {
+		case config.HealthCheckHTTP:
+			httpHealthCheck := &envoycorev3.HealthCheck_HttpHealthCheck{
+				Path: valueOrDefault(healthCheck.Path, defaultHealthCheckPath),
+			}
+			if healthCheck.Path == "" {
+				// Without a path of its own, the queue proxy answers the check from
+				// the readiness of the revision. A configured path is meant to reach
+				// the application instead, which the probe header would prevent.
+				httpHealthCheck.RequestHeadersToAdd = headersToAdd(map[string]string{
+					header.ProbeKey: queueProxyProbeValue,
+				})
+			}
+			if isHTTP2 {
+				httpHealthCheck.CodecClientType = envoytypev3.CodecClientType_HTTP2
+			}
+			hc.HealthChecker = &envoycorev3.HealthCheck_HttpHealthCheck_{
+				HttpHealthCheck: httpHealthCheck,
+			}
+		case config.HealthCheckGRPC:
+			hc.HealthChecker = &envoycorev3.HealthCheck_GrpcHealthCheck_{
+				GrpcHealthCheck: &envoycorev3.HealthCheck_GrpcHealthCheck{
+					ServiceName: healthCheck.GRPCServiceName,
+				},
+			}
+		default:
+			return
+		}
+
+		cluster.HealthChecks = []*envoycorev3.HealthCheck{hc}
+	}
+}
+
+func valueOrDefault[T comparable](value, def T) T {
+	var zero T
+	if value == zero {
+		return def
+	}
+	return value
+}
+
+// NewEDSCluster returns a copy of the given static cluster that discovers its
+// endpoints through EDS (via ADS) instead, along with the load assignment to serve
+// for it. Clusters of other types are returned as they are, without a load assignment.
+func NewEDSCluster(cluster *envoyclusterv3.Cluster) (*envoyclusterv3.Cluster, *endpoint.ClusterLoadAssignment) {
+	if cluster.GetType() != envoyclusterv3.Cluster_STATIC || cluster.GetLoadAssignment() == nil {
+		return cluster, nil
+	}
+
+	edsCluster := proto.Clone(cluster).(*envoyclusterv3.Cluster)
+	edsCluster.ClusterDiscoveryType = &envoyclusterv3.Cluster_Type{
+		Type: envoyclusterv3.Cluster_EDS,
+	}
+	edsCluster.EdsClusterConfig = &envoyclusterv3.Cluster_EdsClusterConfig{
+		EdsConfig: adsConfigSource(),
+	}
+	edsCluster.LoadAssignment = nil
+
+	return edsCluster, cluster.GetLoadAssignment()
+}
+
+// adsConfigSource returns a ConfigSource pointing to the aggregated discovery
+// service the gateways are bootstrapped with.
+func adsConfigSource() *envoycorev3.ConfigSource {
+	return &envoycorev3.ConfigSource{
+		ResourceApiVersion: resource.DefaultAPIVersion,
+		ConfigSourceSpecifier: &envoycorev3.ConfigSource_Ads{
+			Ads: &envoycorev3.AggregatedConfigSource{},
+		},
+	}
+}
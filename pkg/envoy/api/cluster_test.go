@@ -21,9 +21,16 @@ import (
 	"time"
 
 	v3Cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	httpOptions "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	envoytypev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 	"gotest.tools/v3/assert"
+
+	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
 )
 
 func TestNewCluster(t *testing.T) {
@@ -45,3 +52,206 @@ func TestNewCluster(t *testing.T) {
 	c = NewCluster(name, connectTimeout, endpoints, false, nil, v3Cluster.Cluster_STATIC)
 	assert.Assert(t, c.TypedExtensionProtocolOptions["envoy.extensions.upstreams.http.v3.HttpProtocolOptions"] == nil)
 }
+
+func TestNewClusterWithLocalityLB(t *testing.T) {
+	localities := func() []*endpoint.LocalityLbEndpoints {
+		return []*endpoint.LocalityLbEndpoints{{
+			Locality:    &core.Locality{Zone: "zone-a"},
+			LbEndpoints: []*endpoint.LbEndpoint{NewLBEndpoint("127.0.0.1", 1234)},
+		}, {
+			Locality: &core.Locality{Zone: "zone-b"},
+			LbEndpoints: []*endpoint.LbEndpoint{
+				NewLBEndpoint("127.0.0.2", 1234),
+				NewLBEndpoint("127.0.0.3", 1234),
+			},
+		}}
+	}
+
+	// Locality weighted
+	c := NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+		WithLocalityLB(localities(), config.LocalityLBPolicyWeighted))
+	assert.Equal(t, len(c.LoadAssignment.Endpoints), 2)
+	assert.Equal(t, c.LoadAssignment.Endpoints[0].GetLoadBalancingWeight().GetValue(), uint32(1))
+	assert.Equal(t, c.LoadAssignment.Endpoints[1].GetLoadBalancingWeight().GetValue(), uint32(2))
+	assert.Assert(t, c.GetCommonLbConfig().GetLocalityWeightedLbConfig() != nil)
+
+	// Zone aware
+	c = NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+		WithLocalityLB(localities(), config.LocalityLBPolicyZoneAware))
+	assert.DeepEqual(t, c.LoadAssignment.Endpoints, localities(), protocmp.Transform())
+	assert.Assert(t, c.GetCommonLbConfig().GetZoneAwareLbConfig() != nil)
+}
+
+func TestNewClusterWithOutlierDetection(t *testing.T) {
+	c := NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+		WithOutlierDetection(config.OutlierDetection{
+			Consecutive5xx:     5,
+			Interval:           5 * time.Second,
+			BaseEjectionTime:   time.Minute,
+			MaxEjectionPercent: 50,
+		}))
+	assert.DeepEqual(t, c.OutlierDetection, &v3Cluster.OutlierDetection{
+		Consecutive_5Xx:      wrapperspb.UInt32(5),
+		Interval:             durationpb.New(5 * time.Second),
+		BaseEjectionTime:     durationpb.New(time.Minute),
+		MaxEjectionPercent:   wrapperspb.UInt32(50),
+		EnforcingSuccessRate: wrapperspb.UInt32(0),
+	}, protocmp.Transform())
+
+	// Unset fields are left to Envoy's defaults.
+	c = NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+		WithOutlierDetection(config.OutlierDetection{Consecutive5xx: 3}))
+	assert.DeepEqual(t, c.OutlierDetection, &v3Cluster.OutlierDetection{
+		Consecutive_5Xx:      wrapperspb.UInt32(3),
+		EnforcingSuccessRate: wrapperspb.UInt32(0),
+	}, protocmp.Transform())
+}
+
+func TestNewClusterWithCircuitBreakers(t *testing.T) {
+	c := NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+		WithCircuitBreakers(config.CircuitBreakers{
+			MaxConnections: 100,
+			MaxRetries:     10,
+		}))
+	assert.DeepEqual(t, c.CircuitBreakers, &v3Cluster.CircuitBreakers{
+		Thresholds: []*v3Cluster.CircuitBreakers_Thresholds{{
+			MaxConnections: wrapperspb.UInt32(100),
+			MaxRetries:     wrapperspb.UInt32(10),
+		}},
+	}, protocmp.Transform())
+}
+
+func TestNewClusterWithHealthCheck(t *testing.T) {
+	// HTTP with defaults
+	c := NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+		WithHealthCheck(config.HealthCheck{Type: config.HealthCheckHTTP}, false))
+	assert.DeepEqual(t, c.HealthChecks, []*core.HealthCheck{{
+		Interval:           durationpb.New(10 * time.Second),
+		Timeout:            durationpb.New(time.Second),
+		HealthyThreshold:   wrapperspb.UInt32(1),
+		UnhealthyThreshold: wrapperspb.UInt32(3),
+		HealthChecker: &core.HealthCheck_HttpHealthCheck_{
+			HttpHealthCheck: &core.HealthCheck_HttpHealthCheck{
+				Path: "/",
+				RequestHeadersToAdd: []*core.HeaderValueOption{{
+					Header:       &core.HeaderValue{Key: "K-Network-Probe", Value: "queue"},
+					AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+				}},
+			},
+		},
+	}}, protocmp.Transform())
+
+	// HTTP/2 with a path, which reaches the application instead of the queue proxy.
+	c = NewCluster("myTestCluster_12345", 5*time.Second, nil, true, nil, v3Cluster.Cluster_STATIC,
+		WithHealthCheck(config.HealthCheck{Type: config.HealthCheckHTTP, Path: "/ready"}, true))
+	assert.DeepEqual(t, c.HealthChecks[0].GetHttpHealthCheck(), &core.HealthCheck_HttpHealthCheck{
+		Path:            "/ready",
+		CodecClientType: envoytypev3.CodecClientType_HTTP2,
+	}, protocmp.Transform())
+
+	// gRPC
+	c = NewCluster("myTestCluster_12345", 5*time.Second, nil, true, nil, v3Cluster.Cluster_STATIC,
+		WithHealthCheck(config.HealthCheck{
+			Type:               config.HealthCheckGRPC,
+			GRPCServiceName:    "orders",
+			Interval:           2 * time.Second,
+			Timeout:            500 * time.Millisecond,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 4,
+		}, true))
+	assert.DeepEqual(t, c.HealthChecks, []*core.HealthCheck{{
+		Interval:           durationpb.New(2 * time.Second),
+		Timeout:            durationpb.New(500 * time.Millisecond),
+		HealthyThreshold:   wrapperspb.UInt32(2),
+		UnhealthyThreshold: wrapperspb.UInt32(4),
+		HealthChecker: &core.HealthCheck_GrpcHealthCheck_{
+			GrpcHealthCheck: &core.HealthCheck_GrpcHealthCheck{ServiceName: "orders"},
+		},
+	}}, protocmp.Transform())
+
+	// Disabled
+	c = NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+		WithHealthCheck(config.HealthCheck{}, false))
+	assert.Assert(t, c.HealthChecks == nil)
+}
+
+func TestNewClusterWithLBPolicy(t *testing.T) {
+	for policy, want := range map[config.LBPolicy]v3Cluster.Cluster_LbPolicy{
+		config.LBPolicyRoundRobin:   v3Cluster.Cluster_ROUND_ROBIN,
+		config.LBPolicyLeastRequest: v3Cluster.Cluster_LEAST_REQUEST,
+		config.LBPolicyRingHash:     v3Cluster.Cluster_RING_HASH,
+		config.LBPolicyMaglev:       v3Cluster.Cluster_MAGLEV,
+		config.LBPolicyRandom:       v3Cluster.Cluster_RANDOM,
+	} {
+		c := NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+			WithLBPolicy(policy))
+		assert.Equal(t, c.LbPolicy, want, "policy %s", policy)
+	}
+}
+
+func TestNewClusterWithConnectionPool(t *testing.T) {
+	pool := config.ConnectionPool{
+		MaxRequestsPerConnection:  1000,
+		IdleTimeout:               5 * time.Minute,
+		HTTP2MaxConcurrentStreams: 100,
+	}
+	httpProtocolOptions := func(c *v3Cluster.Cluster) *httpOptions.HttpProtocolOptions {
+		opts := &httpOptions.HttpProtocolOptions{}
+		assert.NilError(t, c.TypedExtensionProtocolOptions["envoy.extensions.upstreams.http.v3.HttpProtocolOptions"].UnmarshalTo(opts))
+		return opts
+	}
+
+	// HTTP/1 ignores the maximum of concurrent streams.
+	c := NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+		WithConnectionPool(pool, false))
+	assert.DeepEqual(t, httpProtocolOptions(c), &httpOptions.HttpProtocolOptions{
+		CommonHttpProtocolOptions: &core.HttpProtocolOptions{
+			MaxRequestsPerConnection: wrapperspb.UInt32(1000),
+			IdleTimeout:              durationpb.New(5 * time.Minute),
+		},
+		UpstreamProtocolOptions: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig_{
+			ExplicitHttpConfig: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig{
+				ProtocolConfig: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig_HttpProtocolOptions{},
+			},
+		},
+	}, protocmp.Transform())
+
+	// HTTP/2 keeps the protocol.
+	c = NewCluster("myTestCluster_12345", 5*time.Second, nil, true, nil, v3Cluster.Cluster_STATIC,
+		WithConnectionPool(config.ConnectionPool{HTTP2MaxConcurrentStreams: 100}, true))
+	assert.DeepEqual(t, httpProtocolOptions(c), &httpOptions.HttpProtocolOptions{
+		UpstreamProtocolOptions: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig_{
+			ExplicitHttpConfig: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig{
+				ProtocolConfig: &httpOptions.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{
+					Http2ProtocolOptions: &core.Http2ProtocolOptions{
+						MaxConcurrentStreams: wrapperspb.UInt32(100),
+					},
+				},
+			},
+		},
+	}, protocmp.Transform())
+
+	// Nothing to configure
+	c = NewCluster("myTestCluster_12345", 5*time.Second, nil, false, nil, v3Cluster.Cluster_STATIC,
+		WithConnectionPool(config.ConnectionPool{ConnectTimeout: time.Second}, false))
+	assert.Assert(t, c.TypedExtensionProtocolOptions == nil)
+}
+
+func TestNewEDSCluster(t *testing.T) {
+	endpoints := []*endpoint.LbEndpoint{NewLBEndpoint("127.0.0.1", 1234)}
+
+	static := NewCluster("myTestCluster_12345", 5*time.Second, endpoints, true, nil, v3Cluster.Cluster_STATIC)
+	eds, loadAssignment := NewEDSCluster(static)
+	assert.Equal(t, eds.GetType(), v3Cluster.Cluster_EDS)
+	assert.Assert(t, eds.GetEdsClusterConfig().GetEdsConfig().GetAds() != nil)
+	assert.Assert(t, eds.GetLoadAssignment() == nil)
+	assert.Assert(t, eds.TypedExtensionProtocolOptions["envoy.extensions.upstreams.http.v3.HttpProtocolOptions"] != nil)
+	assert.DeepEqual(t, loadAssignment, static.GetLoadAssignment(), protocmp.Transform())
+	// The original cluster must not be modified.
+	assert.Equal(t, static.GetType(), v3Cluster.Cluster_STATIC)
+
+	dns := NewCluster("myTestCluster_12345", 5*time.Second, endpoints, false, nil, v3Cluster.Cluster_LOGICAL_DNS)
+	unchanged, loadAssignment := NewEDSCluster(dns)
+	assert.Equal(t, unchanged, dns)
+	assert.Assert(t, loadAssignment == nil)
+}
@@ -18,6 +18,7 @@ package envoy
 
 import (
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // headersToAdd generates a list of HeaderValueOption from a map of headers.
@@ -27,11 +28,12 @@ func headersToAdd(headers map[string]string) []*core.HeaderValueOption {
 	}
 
 	res := make([]*core.HeaderValueOption, 0, len(headers))
-	for headerName, headerVal := range headers {
+	// Sort the headers, so the same headers always yield the same route.
+	for _, headerName := range sets.List(sets.KeySet(headers)) {
 		res = append(res, &core.HeaderValueOption{
 			Header: &core.HeaderValue{
 				Key:   headerName,
-				Value: headerVal,
+				Value: headers[headerName],
 			},
 			// In Knative Serving, headers are set instead of appended.
 			// Ref: https://github.com/knative/serving/pull/6366
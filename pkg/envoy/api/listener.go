@@ -47,8 +47,12 @@ type SNIMatch struct {
 	PrivateKey       []byte
 }
 
+// ListenerOption further configures a listener generated by NewHTTPListener,
+// NewHTTPSListener or NewHTTPSListenerWithSNI.
+type ListenerOption func(*listener.Listener)
+
 // NewHTTPListener creates a new Listener at the given port, backed by the given manager.
-func NewHTTPListener(manager *hcm.HttpConnectionManager, port uint32, enableProxyProtocol bool) (*listener.Listener, error) {
+func NewHTTPListener(manager *hcm.HttpConnectionManager, port uint32, enableProxyProtocol bool, opts ...ListenerOption) (*listener.Listener, error) {
 	filters, err := createFilters(manager)
 	if err != nil {
 		return nil, err
@@ -63,18 +67,22 @@ func NewHTTPListener(manager *hcm.HttpConnectionManager, port uint32, enableProx
 		listenerFilter = append(listenerFilter, proxyProtocolListenerFilter)
 	}
 
-	return &listener.Listener{
+	l := &listener.Listener{
 		Name:            CreateListenerName(port),
-		Address:         createAddress(port),
+		Address:         createAddress("0.0.0.0", port),
 		ListenerFilters: listenerFilter,
 		FilterChains: []*listener.FilterChain{{
 			Filters: filters,
 		}},
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l, nil
 }
 
 // NewHTTPSListener creates a new Listener at the given port with a given filter chain
-func NewHTTPSListener(port uint32, filterChain []*listener.FilterChain, enableProxyProtocol bool) (*listener.Listener, error) {
+func NewHTTPSListener(port uint32, filterChain []*listener.FilterChain, enableProxyProtocol bool, opts ...ListenerOption) (*listener.Listener, error) {
 	var listenerFilter []*listener.ListenerFilter
 	if enableProxyProtocol {
 		proxyProtocolListenerFilter, err := createProxyProtocolListenerFilter()
@@ -84,12 +92,16 @@ func NewHTTPSListener(port uint32, filterChain []*listener.FilterChain, enablePr
 		listenerFilter = append(listenerFilter, proxyProtocolListenerFilter)
 	}
 
-	return &listener.Listener{
+	l := &listener.Listener{
 		Name:            CreateListenerName(port),
-		Address:         createAddress(port),
+		Address:         createAddress("0.0.0.0", port),
 		ListenerFilters: listenerFilter,
 		FilterChains:    filterChain,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l, nil
 }
 
 // CreateFilterChainFromCertificateAndPrivateKey creates a new filter chain from a certificate and a private key
@@ -124,7 +136,7 @@ func CreateFilterChainFromCertificateAndPrivateKey(
 // manager and applies a FilterChain with the given sniMatches.
 //
 // Ref: https://www.envoyproxy.io/docs/envoy/latest/faq/configuration/sni.html
-func NewHTTPSListenerWithSNI(manager *hcm.HttpConnectionManager, port uint32, sniMatches []*SNIMatch, kourierConfig *config.Kourier) (*listener.Listener, error) {
+func NewHTTPSListenerWithSNI(manager *hcm.HttpConnectionManager, port uint32, sniMatches []*SNIMatch, kourierConfig *config.Kourier, opts ...ListenerOption) (*listener.Listener, error) {
 	filterChains, err := createFilterChainsForTLS(manager, sniMatches, kourierConfig)
 	if err != nil {
 		return nil, err
@@ -157,12 +169,40 @@ func NewHTTPSListenerWithSNI(manager *hcm.HttpConnectionManager, port uint32, sn
 
 	listenerFilter = append(listenerFilter, listenerFilterForTLS)
 
-	return &listener.Listener{
+	l := &listener.Listener{
 		Name:            CreateListenerName(port),
-		Address:         createAddress(port),
+		Address:         createAddress("0.0.0.0", port),
 		FilterChains:    filterChains,
 		ListenerFilters: listenerFilter,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l, nil
+}
+
+// WithIPFamily binds the listener to the wildcard addresses of the given IP family
+// at its port.
+func WithIPFamily(family config.ListenerIPFamily) ListenerOption {
+	return func(l *listener.Listener) {
+		port := l.GetAddress().GetSocketAddress().GetPortValue()
+		switch family {
+		case config.ListenerIPFamilyIPv6:
+			l.Address = createAddress("::", port)
+			l.Address.GetSocketAddress().Ipv4Compat = true
+			l.AdditionalAddresses = nil
+		case config.ListenerIPFamilyDualStack:
+			// Envoy binds IPv6 sockets without ipv4_compat to IPv6 only, so that they
+			// don't conflict with the IPv4 socket.
+			l.Address = createAddress("0.0.0.0", port)
+			l.AdditionalAddresses = []*listener.AdditionalAddress{{
+				Address: createAddress("::", port),
+			}}
+		default:
+			l.Address = createAddress("0.0.0.0", port)
+			l.AdditionalAddresses = nil
+		}
+	}
 }
 
 // CreateListenerName returns a listener name based on port
@@ -170,12 +210,12 @@ func CreateListenerName(port uint32) string {
 	return fmt.Sprintf("listener_%d", port)
 }
 
-func createAddress(port uint32) *core.Address {
+func createAddress(address string, port uint32) *core.Address {
 	return &core.Address{
 		Address: &core.Address_SocketAddress{
 			SocketAddress: &core.SocketAddress{
 				Protocol: core.SocketAddress_TCP,
-				Address:  "0.0.0.0",
+				Address:  address,
 				PortSpecifier: &core.SocketAddress_PortValue{
 					PortValue: port,
 				},
@@ -204,7 +244,7 @@ func createFilterChainsForTLS(manager *hcm.HttpConnectionManager, sniMatches []*
 			return nil, err
 		}
 
-		c := Certificate{Certificate: sniMatch.CertificateChain, PrivateKey: sniMatch.PrivateKey, CipherSuites: sets.List(kourierConfig.CipherSuites)}
+		c := sniMatch.certificate(sets.List(kourierConfig.CipherSuites))
 
 		tlsContext, err := c.createTLSContext()
 		if err != nil {
@@ -234,6 +274,8 @@ func createFilterChainsForTLS(manager *hcm.HttpConnectionManager, sniMatches []*
 
 // Certificate stores certificate data to generrate TLS context for downstream.
 type Certificate struct {
+	// Name is the name of the SDS Secret holding the certificate and the private key.
+	Name               string
 	Certificate        []byte
 	PrivateKey         []byte
 	PrivateKeyProvider string
@@ -268,9 +310,8 @@ func (c Certificate) createCryptoMbMessaage() (*anypb.Any, error) {
 }
 
 func (c Certificate) createTLSContext() (*auth.DownstreamTlsContext, error) {
-	tlsCertificates, err := c.createTLScertificates()
-	if err != nil {
-		return nil, err
+	if c.Name == "" {
+		return nil, errors.New("certificate must have a name to be referenced through SDS")
 	}
 
 	return &auth.DownstreamTlsContext{
@@ -281,7 +322,12 @@ func (c Certificate) createTLSContext() (*auth.DownstreamTlsContext, error) {
 				TlsMinimumProtocolVersion: auth.TlsParameters_TLSv1_2,
 				CipherSuites:              c.CipherSuites,
 			},
-			TlsCertificates: []*auth.TlsCertificate{tlsCertificates},
+			// The certificate and the private key are served through SDS, so that they
+			// can be rotated without updating the listener and don't show up in its config.
+			TlsCertificateSdsSecretConfigs: []*auth.SdsSecretConfig{{
+				Name:      c.Name,
+				SdsConfig: adsConfigSource(),
+			}},
 		},
 	}, nil
 }
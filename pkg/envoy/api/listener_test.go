@@ -32,6 +32,7 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
 )
@@ -78,12 +79,59 @@ func TestNewHTTPListenerWithProxyProtocol(t *testing.T) {
 	assertListenerHasProxyProtocolConfigured(t, l.ListenerFilters[0])
 }
 
+func TestWithIPFamily(t *testing.T) {
+	manager := NewHTTPConnectionManager("test", &config.Kourier{})
+
+	tests := []struct {
+		name       string
+		family     config.ListenerIPFamily
+		address    string
+		ipv4Compat bool
+		additional []string
+	}{{
+		name:    "ipv4",
+		family:  config.ListenerIPFamilyIPv4,
+		address: "0.0.0.0",
+	}, {
+		name:       "ipv6",
+		family:     config.ListenerIPFamilyIPv6,
+		address:    "::",
+		ipv4Compat: true,
+	}, {
+		name:       "dual stack",
+		family:     config.ListenerIPFamilyDualStack,
+		address:    "0.0.0.0",
+		additional: []string{"::"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := NewHTTPListener(manager, 8080, false, WithIPFamily(test.family))
+			assert.NilError(t, err)
+
+			assert.Equal(t, test.address, l.Address.GetSocketAddress().Address)
+			assert.Equal(t, test.ipv4Compat, l.Address.GetSocketAddress().Ipv4Compat)
+			assert.Equal(t, uint32(8080), l.Address.GetSocketAddress().GetPortValue())
+
+			var additional []string
+			for _, a := range l.AdditionalAddresses {
+				assert.Equal(t, uint32(8080), a.GetAddress().GetSocketAddress().GetPortValue())
+				assert.Equal(t, false, a.GetAddress().GetSocketAddress().Ipv4Compat)
+				additional = append(additional, a.GetAddress().GetSocketAddress().Address)
+			}
+			assert.DeepEqual(t, test.additional, additional)
+		})
+	}
+}
+
 var c = Certificate{
+	Name:        "secretns/secretname",
 	Certificate: []byte("some_certificate_chain"),
 	PrivateKey:  []byte("some_private_key"),
 }
 
 var crypto = Certificate{
+	Name:               "secretns/secretname/cryptomb",
 	Certificate:        []byte("some_certificate_chain"),
 	PrivateKey:         []byte("some_private_key"),
 	PrivateKeyProvider: "cryptomb",
@@ -109,11 +157,9 @@ func TestNewHTTPSListener(t *testing.T) {
 	assert.Equal(t, uint32(8081), l.Address.GetSocketAddress().GetPortValue())
 
 	// Check that TLS is configured
-	gotCertChain, gotPrivateKey, _, err := getTLSCreds(l.FilterChains[0])
+	gotSecretName, err := getSDSSecretName(l.FilterChains[0])
 	assert.NilError(t, err)
-
-	assert.DeepEqual(t, c.Certificate, gotCertChain)
-	assert.DeepEqual(t, c.PrivateKey, gotPrivateKey)
+	assert.Equal(t, c.Name, gotSecretName)
 
 	// check proxy protocol is not configured
 	assert.Check(t, len(l.ListenerFilters) == 0)
@@ -128,16 +174,6 @@ func TestNewHTTPSListenerWithPrivatekeyProvider(t *testing.T) {
 	}
 	manager := NewHTTPConnectionManager("test", &kourierConfig)
 
-	msg, err := c.createCryptoMbMessaage()
-	assert.NilError(t, err)
-
-	fakePrivateKeyProvider := &auth.PrivateKeyProvider{
-		ProviderName: "cryptomb",
-		ConfigType: &auth.PrivateKeyProvider_TypedConfig{
-			TypedConfig: msg,
-		},
-	}
-
 	filterChain, err := CreateFilterChainFromCertificateAndPrivateKey(manager, &crypto)
 	assert.NilError(t, err)
 
@@ -149,12 +185,9 @@ func TestNewHTTPSListenerWithPrivatekeyProvider(t *testing.T) {
 	assert.Equal(t, uint32(8081), l.Address.GetSocketAddress().GetPortValue())
 
 	// Check that TLS is configured
-	gotCertChain, gotPrivateKey, gotProvider, err := getTLSCreds(l.FilterChains[0])
+	gotSecretName, err := getSDSSecretName(l.FilterChains[0])
 	assert.NilError(t, err)
-
-	assert.DeepEqual(t, c.Certificate, gotCertChain)
-	assert.DeepEqual(t, []byte(nil), gotPrivateKey)
-	assert.DeepEqual(t, fakePrivateKeyProvider.String(), gotProvider.String())
+	assert.Equal(t, crypto.Name, gotSecretName)
 
 	// check proxy protocol is not configured
 	assert.Check(t, len(l.ListenerFilters) == 0)
@@ -163,10 +196,12 @@ func TestNewHTTPSListenerWithPrivatekeyProvider(t *testing.T) {
 func TestNewHTTPSListenerWithSNIWithCipherSuites(t *testing.T) {
 	sniMatches := []*SNIMatch{{
 		Hosts:            []string{"some_host.com"},
+		CertSource:       types.NamespacedName{Namespace: "secretns", Name: "secret1"},
 		CertificateChain: []byte("cert1"),
 		PrivateKey:       []byte("key1"),
 	}, {
 		Hosts:            []string{"another_host.com"},
+		CertSource:       types.NamespacedName{Namespace: "secretns", Name: "secret2"},
 		CertificateChain: []byte("cert2"),
 		PrivateKey:       []byte("key2"),
 	}}
@@ -213,11 +248,9 @@ func TestNewHTTPSListenerWithProxyProtocol(t *testing.T) {
 	assert.Equal(t, uint32(8081), l.Address.GetSocketAddress().GetPortValue())
 
 	// Check that TLS is configured
-	gotCertChain, gotPrivateKey, _, err := getTLSCreds(l.FilterChains[0])
+	gotSecretName, err := getSDSSecretName(l.FilterChains[0])
 	assert.NilError(t, err)
-
-	assert.DeepEqual(t, c.Certificate, gotCertChain)
-	assert.DeepEqual(t, c.PrivateKey, gotPrivateKey)
+	assert.Equal(t, c.Name, gotSecretName)
 	// check proxy protocol is configured
 	assertListenerHasProxyProtocolConfigured(t, l.ListenerFilters[0])
 }
@@ -225,10 +258,12 @@ func TestNewHTTPSListenerWithProxyProtocol(t *testing.T) {
 func TestNewHTTPSListenerWithSNI(t *testing.T) {
 	sniMatches := []*SNIMatch{{
 		Hosts:            []string{"some_host.com"},
+		CertSource:       types.NamespacedName{Namespace: "secretns", Name: "secret1"},
 		CertificateChain: []byte("cert1"),
 		PrivateKey:       []byte("key1"),
 	}, {
 		Hosts:            []string{"another_host.com"},
+		CertSource:       types.NamespacedName{Namespace: "secretns", Name: "secret2"},
 		CertificateChain: []byte("cert2"),
 		PrivateKey:       []byte("key2"),
 	}}
@@ -258,10 +293,12 @@ func TestNewHTTPSListenerWithSNI(t *testing.T) {
 func TestNewHTTPSListenerWithSNIWithProxyProtocol(t *testing.T) {
 	sniMatches := []*SNIMatch{{
 		Hosts:            []string{"some_host.com"},
+		CertSource:       types.NamespacedName{Namespace: "secretns", Name: "secret1"},
 		CertificateChain: []byte("cert1"),
 		PrivateKey:       []byte("key1"),
 	}, {
 		Hosts:            []string{"another_host.com"},
+		CertSource:       types.NamespacedName{Namespace: "secretns", Name: "secret2"},
 		CertificateChain: []byte("cert2"),
 		PrivateKey:       []byte("key2"),
 	}}
@@ -290,10 +327,15 @@ func assertListenerHasSNIMatchConfigured(t *testing.T, listener *envoy_api_v3.Li
 	filterChainFirstSNIMatch := getFilterChainByServerName(listener, match.Hosts)
 	assert.Assert(t, filterChainFirstSNIMatch != nil)
 
-	certChain, privateKey, _, err := getTLSCreds(filterChainFirstSNIMatch)
+	secretName, err := getSDSSecretName(filterChainFirstSNIMatch)
 	assert.NilError(t, err)
-	assert.DeepEqual(t, match.CertificateChain, certChain)
-	assert.DeepEqual(t, match.PrivateKey, privateKey)
+	assert.Equal(t, SecretName(match.CertSource, ""), secretName)
+
+	secret, err := match.NewSecret()
+	assert.NilError(t, err)
+	assert.Equal(t, secretName, secret.GetName())
+	assert.DeepEqual(t, match.CertificateChain, secret.GetTlsCertificate().GetCertificateChain().GetInlineBytes())
+	assert.DeepEqual(t, match.PrivateKey, secret.GetTlsCertificate().GetPrivateKey().GetInlineBytes())
 }
 
 func assertListenerHasProxyProtocolConfigured(t *testing.T, listenerFilter *envoy_api_v3.ListenerFilter) {
@@ -315,21 +357,19 @@ func getFilterChainByServerName(listener *envoy_api_v3.Listener, serverNames []s
 }
 
 // Note: Returns an error when there are multiple certificates
-func getTLSCreds(filterChain *envoy_api_v3.FilterChain) (certChain []byte, privateKey []byte, privateKeyProvider *auth.PrivateKeyProvider, err error) {
+func getSDSSecretName(filterChain *envoy_api_v3.FilterChain) (string, error) {
 	downstreamTLSContext := &auth.DownstreamTlsContext{}
-	err = anypb.UnmarshalTo(filterChain.GetTransportSocket().GetTypedConfig(), downstreamTLSContext, proto.UnmarshalOptions{})
+	err := anypb.UnmarshalTo(filterChain.GetTransportSocket().GetTypedConfig(), downstreamTLSContext, proto.UnmarshalOptions{})
 	if err != nil {
-		return nil, nil, nil, err
+		return "", err
 	}
 
-	if len(downstreamTLSContext.CommonTlsContext.TlsCertificates) > 1 {
-		return nil, nil, nil, errors.New("more than one certificate configured")
+	if len(downstreamTLSContext.CommonTlsContext.TlsCertificates) > 0 {
+		return "", errors.New("certificates must not be inlined")
+	}
+	if len(downstreamTLSContext.CommonTlsContext.TlsCertificateSdsSecretConfigs) != 1 {
+		return "", errors.New("expected exactly one SDS certificate")
 	}
 
-	certs := downstreamTLSContext.CommonTlsContext.TlsCertificates[0]
-	certChain = certs.CertificateChain.GetInlineBytes()
-	privateKey = certs.PrivateKey.GetInlineBytes()
-	privateKeyProvider = certs.PrivateKeyProvider
-
-	return certChain, privateKey, privateKeyProvider, nil
+	return downstreamTLSContext.CommonTlsContext.TlsCertificateSdsSecretConfigs[0].GetName(), nil
 }
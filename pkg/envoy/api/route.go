@@ -17,18 +17,25 @@ limitations under the License.
 package envoy
 
 import (
+	"strings"
 	"time"
 
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	extAuthService "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
+	envoymatcherv3 "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	"github.com/golang/protobuf/ptypes/any"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
+	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
 )
 
-// NewRoute creates a new Route.
+// RouteOption further configures a route generated by NewRoute and its variants.
+type RouteOption func(*route.Route)
+
+// NewRoute creates a new Route. Its path matches by prefix unless configured
+// otherwise with WithPathMatch.
 func NewRoute(name string,
 	headersMatch []*route.HeaderMatcher,
 	path string,
@@ -36,6 +43,7 @@ func NewRoute(name string,
 	routeTimeout time.Duration,
 	headers map[string]string,
 	hostRewrite string,
+	opts ...RouteOption,
 ) *route.Route {
 	routeAction := &route.RouteAction{
 		ClusterSpecifier: &route.RouteAction_WeightedClusters{
@@ -56,7 +64,7 @@ func NewRoute(name string,
 		}
 	}
 
-	return &route.Route{
+	r := &route.Route{
 		Name: name,
 		Match: &route.RouteMatch{
 			PathSpecifier: &route.RouteMatch_Prefix{
@@ -69,13 +77,18 @@ func NewRoute(name string,
 		},
 		RequestHeadersToAdd: headersToAdd(headers),
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 func NewRedirectRoute(name string,
 	headersMatch []*route.HeaderMatcher,
 	path string,
+	opts ...RouteOption,
 ) *route.Route {
-	return &route.Route{
+	r := &route.Route{
 		Name: name,
 		Match: &route.RouteMatch{
 			PathSpecifier: &route.RouteMatch_Prefix{
@@ -91,6 +104,10 @@ func NewRedirectRoute(name string,
 			},
 		},
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 func NewRouteExtAuthzDisabled(name string,
@@ -100,8 +117,9 @@ func NewRouteExtAuthzDisabled(name string,
 	routeTimeout time.Duration,
 	headers map[string]string,
 	hostRewrite string,
+	opts ...RouteOption,
 ) *route.Route {
-	newRoute := NewRoute(name, headersMatch, path, wrs, routeTimeout, headers, hostRewrite)
+	newRoute := NewRoute(name, headersMatch, path, wrs, routeTimeout, headers, hostRewrite, opts...)
 	extAuthzDisabled, _ := anypb.New(&extAuthService.ExtAuthzPerRoute{
 		Override: &extAuthService.ExtAuthzPerRoute_Disabled{
 			Disabled: true,
@@ -113,3 +131,157 @@ func NewRouteExtAuthzDisabled(name string,
 
 	return newRoute
 }
+
+// WithPathMatch matches the path of requests in the given way instead of by prefix.
+func WithPathMatch(path string, matchType config.PathMatchType) RouteOption {
+	return func(r *route.Route) {
+		switch matchType {
+		case config.PathMatchExact:
+			r.Match.PathSpecifier = &route.RouteMatch_Path{Path: path}
+		case config.PathMatchPathSeparatedPrefix:
+			r.Match.PathSpecifier = &route.RouteMatch_PathSeparatedPrefix{PathSeparatedPrefix: path}
+		case config.PathMatchRegex:
+			r.Match.PathSpecifier = &route.RouteMatch_SafeRegex{SafeRegex: &envoymatcherv3.RegexMatcher{Regex: path}}
+		default:
+			r.Match.PathSpecifier = &route.RouteMatch_Prefix{Prefix: path}
+		}
+	}
+}
+
+// WithIdleTimeout sets the amount of time a request may go without activity,
+// overriding the stream idle timeout of the connection manager. It doesn't apply
+// to redirect routes.
+func WithIdleTimeout(idleTimeout time.Duration) RouteOption {
+	return func(r *route.Route) {
+		if action := r.GetRoute(); action != nil {
+			action.IdleTimeout = durationpb.New(idleTimeout)
+		}
+	}
+}
+
+// WithRetryPolicy retries failed requests according to the given policy. It
+// doesn't apply to redirect routes.
+func WithRetryPolicy(policy config.RetryPolicy) RouteOption {
+	return func(r *route.Route) {
+		action := r.GetRoute()
+		if action == nil {
+			return
+		}
+		retryPolicy := &route.RetryPolicy{
+			RetryOn:              strings.Join(policy.RetryOn, ","),
+			RetriableStatusCodes: policy.RetriableStatusCodes,
+		}
+		if policy.NumRetries != 0 {
+			retryPolicy.NumRetries = wrapperspb.UInt32(policy.NumRetries)
+		}
+		if policy.PerTryTimeout != 0 {
+			retryPolicy.PerTryTimeout = durationpb.New(policy.PerTryTimeout)
+		}
+		if policy.BackoffBaseInterval != 0 {
+			retryPolicy.RetryBackOff = &route.RetryPolicy_RetryBackOff{
+				BaseInterval: durationpb.New(policy.BackoffBaseInterval),
+			}
+			if policy.BackoffMaxInterval != 0 {
+				retryPolicy.RetryBackOff.MaxInterval = durationpb.New(policy.BackoffMaxInterval)
+			}
+		}
+		action.RetryPolicy = retryPolicy
+	}
+}
+
+// WithSessionAffinity hashes requests according to the given session affinity, so
+// the hash based load balancing policies of the clusters of the route send the
+// requests of a client to the same endpoint. It doesn't apply to redirect routes.
+func WithSessionAffinity(affinity config.SessionAffinity) RouteOption {
+	return func(r *route.Route) {
+		action := r.GetRoute()
+		if action == nil {
+			return
+		}
+		var hashPolicy *route.RouteAction_HashPolicy
+		switch affinity.Mode {
+		case config.SessionAffinityCookie:
+			hashPolicy = &route.RouteAction_HashPolicy{
+				PolicySpecifier: &route.RouteAction_HashPolicy_Cookie_{
+					Cookie: &route.RouteAction_HashPolicy_Cookie{
+						Name: affinity.CookieName,
+						// Without a TTL, Envoy wouldn't set the cookie.
+						Ttl:  durationpb.New(affinity.CookieTTL),
+						Path: "/",
+					},
+				},
+			}
+		case config.SessionAffinityHeader:
+			hashPolicy = &route.RouteAction_HashPolicy{
+				PolicySpecifier: &route.RouteAction_HashPolicy_Header_{
+					Header: &route.RouteAction_HashPolicy_Header{
+						HeaderName: affinity.HeaderName,
+					},
+				},
+			}
+		case config.SessionAffinitySourceIP:
+			hashPolicy = &route.RouteAction_HashPolicy{
+				PolicySpecifier: &route.RouteAction_HashPolicy_ConnectionProperties_{
+					ConnectionProperties: &route.RouteAction_HashPolicy_ConnectionProperties{
+						SourceIp: true,
+					},
+				},
+			}
+		default:
+			return
+		}
+		action.HashPolicy = []*route.RouteAction_HashPolicy{hashPolicy}
+	}
+}
+
+// WithHeaderMatches additionally matches the headers of requests against the given
+// matches.
+func WithHeaderMatches(matches []config.ValueMatch) RouteOption {
+	return func(r *route.Route) {
+		for _, m := range matches {
+			matcher := &route.HeaderMatcher{
+				Name:        m.Name,
+				InvertMatch: m.Invert,
+			}
+			if m.Present {
+				matcher.HeaderMatchSpecifier = &route.HeaderMatcher_PresentMatch{PresentMatch: true}
+			} else {
+				matcher.HeaderMatchSpecifier = &route.HeaderMatcher_StringMatch{StringMatch: stringMatcher(m)}
+			}
+			r.Match.Headers = append(r.Match.Headers, matcher)
+		}
+	}
+}
+
+// WithQueryParameterMatches matches the query parameters of requests against the
+// given matches.
+func WithQueryParameterMatches(matches []config.ValueMatch) RouteOption {
+	return func(r *route.Route) {
+		for _, m := range matches {
+			matcher := &route.QueryParameterMatcher{Name: m.Name}
+			if m.Present {
+				matcher.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_PresentMatch{PresentMatch: true}
+			} else {
+				matcher.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_StringMatch{StringMatch: stringMatcher(m)}
+			}
+			r.Match.QueryParameters = append(r.Match.QueryParameters, matcher)
+		}
+	}
+}
+
+// stringMatcher returns the matcher of the value of the given match, which must not
+// be a presence match.
+func stringMatcher(m config.ValueMatch) *envoymatcherv3.StringMatcher {
+	switch {
+	case m.Prefix != "":
+		return &envoymatcherv3.StringMatcher{MatchPattern: &envoymatcherv3.StringMatcher_Prefix{Prefix: m.Prefix}}
+	case m.Suffix != "":
+		return &envoymatcherv3.StringMatcher{MatchPattern: &envoymatcherv3.StringMatcher_Suffix{Suffix: m.Suffix}}
+	case m.Regex != "":
+		return &envoymatcherv3.StringMatcher{MatchPattern: &envoymatcherv3.StringMatcher_SafeRegex{
+			SafeRegex: &envoymatcherv3.RegexMatcher{Regex: m.Regex},
+		}}
+	default:
+		return &envoymatcherv3.StringMatcher{MatchPattern: &envoymatcherv3.StringMatcher_Exact{Exact: m.Exact}}
+	}
+}
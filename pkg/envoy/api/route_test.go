@@ -18,10 +18,16 @@ package envoy
 
 import (
 	"testing"
+	"time"
 
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoymatcherv3 "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 	"gotest.tools/v3/assert"
+	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
 )
 
 func TestNewRouteHeaderMatch(t *testing.T) {
@@ -63,3 +69,189 @@ func TestNewRouteExtAuthzDisabled(t *testing.T) {
 	assert.Assert(t, len(r.TypedPerFilterConfig) != 0)
 	assert.Assert(t, r.TypedPerFilterConfig[wellknown.HTTPExternalAuthorization] != nil)
 }
+
+func TestNewRoutePathMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		matchType config.PathMatchType
+		want      *route.RouteMatch
+	}{{
+		name: "default",
+		path: "/api",
+		want: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/api"}},
+	}, {
+		name:      "prefix",
+		path:      "/api",
+		matchType: config.PathMatchPrefix,
+		want:      &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/api"}},
+	}, {
+		name:      "path separated prefix",
+		path:      "/api",
+		matchType: config.PathMatchPathSeparatedPrefix,
+		want:      &route.RouteMatch{PathSpecifier: &route.RouteMatch_PathSeparatedPrefix{PathSeparatedPrefix: "/api"}},
+	}, {
+		name:      "exact",
+		path:      "/api/v1/users",
+		matchType: config.PathMatchExact,
+		want:      &route.RouteMatch{PathSpecifier: &route.RouteMatch_Path{Path: "/api/v1/users"}},
+	}, {
+		name:      "regex",
+		path:      "^/tenant/[a-z]+/hook$",
+		matchType: config.PathMatchRegex,
+		want: &route.RouteMatch{PathSpecifier: &route.RouteMatch_SafeRegex{
+			SafeRegex: &envoymatcherv3.RegexMatcher{Regex: "^/tenant/[a-z]+/hook$"},
+		}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var opts []RouteOption
+			if test.matchType != "" {
+				opts = append(opts, WithPathMatch(test.path, test.matchType))
+			}
+
+			r := NewRoute("route", nil, test.path, nil, 0, nil, "", opts...)
+			assert.DeepEqual(t, r.Match, test.want, protocmp.Transform())
+
+			redirect := NewRedirectRoute("redirect", nil, test.path, opts...)
+			assert.DeepEqual(t, redirect.Match, test.want, protocmp.Transform())
+		})
+	}
+}
+
+func TestNewRouteRequestMatches(t *testing.T) {
+	r := NewRoute("route", nil, "/", nil, 0, nil, "",
+		WithHeaderMatches([]config.ValueMatch{
+			{Name: "x-exact", Exact: "a"},
+			{Name: "x-prefix", Prefix: "b"},
+			{Name: "x-suffix", Suffix: "c"},
+			{Name: "x-canary", Regex: "^beta"},
+			{Name: "x-debug", Present: true, Invert: true},
+		}),
+		WithQueryParameterMatches([]config.ValueMatch{
+			{Name: "version", Exact: "2"},
+			{Name: "debug", Present: true},
+		}),
+	)
+
+	assert.DeepEqual(t, r.Match, &route.RouteMatch{
+		PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"},
+		Headers: []*route.HeaderMatcher{{
+			Name: "x-exact",
+			HeaderMatchSpecifier: &route.HeaderMatcher_StringMatch{StringMatch: &envoymatcherv3.StringMatcher{
+				MatchPattern: &envoymatcherv3.StringMatcher_Exact{Exact: "a"},
+			}},
+		}, {
+			Name: "x-prefix",
+			HeaderMatchSpecifier: &route.HeaderMatcher_StringMatch{StringMatch: &envoymatcherv3.StringMatcher{
+				MatchPattern: &envoymatcherv3.StringMatcher_Prefix{Prefix: "b"},
+			}},
+		}, {
+			Name: "x-suffix",
+			HeaderMatchSpecifier: &route.HeaderMatcher_StringMatch{StringMatch: &envoymatcherv3.StringMatcher{
+				MatchPattern: &envoymatcherv3.StringMatcher_Suffix{Suffix: "c"},
+			}},
+		}, {
+			Name: "x-canary",
+			HeaderMatchSpecifier: &route.HeaderMatcher_StringMatch{StringMatch: &envoymatcherv3.StringMatcher{
+				MatchPattern: &envoymatcherv3.StringMatcher_SafeRegex{SafeRegex: &envoymatcherv3.RegexMatcher{Regex: "^beta"}},
+			}},
+		}, {
+			Name:                 "x-debug",
+			HeaderMatchSpecifier: &route.HeaderMatcher_PresentMatch{PresentMatch: true},
+			InvertMatch:          true,
+		}},
+		QueryParameters: []*route.QueryParameterMatcher{{
+			Name: "version",
+			QueryParameterMatchSpecifier: &route.QueryParameterMatcher_StringMatch{StringMatch: &envoymatcherv3.StringMatcher{
+				MatchPattern: &envoymatcherv3.StringMatcher_Exact{Exact: "2"},
+			}},
+		}, {
+			Name:                         "debug",
+			QueryParameterMatchSpecifier: &route.QueryParameterMatcher_PresentMatch{PresentMatch: true},
+		}},
+	}, protocmp.Transform())
+}
+
+func TestNewRouteIdleTimeout(t *testing.T) {
+	r := NewRoute("route", nil, "/", nil, 10*time.Minute, nil, "", WithIdleTimeout(30*time.Second))
+	assert.DeepEqual(t, r.GetRoute().Timeout, durationpb.New(10*time.Minute), protocmp.Transform())
+	assert.DeepEqual(t, r.GetRoute().IdleTimeout, durationpb.New(30*time.Second), protocmp.Transform())
+
+	// Redirect routes don't have a route action to set it on.
+	r = NewRedirectRoute("route", nil, "/", WithIdleTimeout(30*time.Second))
+	assert.Assert(t, r.GetRoute() == nil)
+}
+
+func TestNewRouteRetryPolicy(t *testing.T) {
+	r := NewRoute("route", nil, "/", nil, 0, nil, "", WithRetryPolicy(config.RetryPolicy{
+		RetryOn:              []string{"reset", "retriable-status-codes"},
+		NumRetries:           3,
+		PerTryTimeout:        2 * time.Second,
+		RetriableStatusCodes: []uint32{503},
+		BackoffBaseInterval:  50 * time.Millisecond,
+		BackoffMaxInterval:   time.Second,
+	}))
+	assert.DeepEqual(t, r.GetRoute().RetryPolicy, &route.RetryPolicy{
+		RetryOn:              "reset,retriable-status-codes",
+		NumRetries:           wrapperspb.UInt32(3),
+		PerTryTimeout:        durationpb.New(2 * time.Second),
+		RetriableStatusCodes: []uint32{503},
+		RetryBackOff: &route.RetryPolicy_RetryBackOff{
+			BaseInterval: durationpb.New(50 * time.Millisecond),
+			MaxInterval:  durationpb.New(time.Second),
+		},
+	}, protocmp.Transform())
+
+	// Unset fields are left to Envoy's defaults.
+	r = NewRoute("route", nil, "/", nil, 0, nil, "", WithRetryPolicy(config.RetryPolicy{
+		RetryOn: []string{"5xx"},
+	}))
+	assert.DeepEqual(t, r.GetRoute().RetryPolicy, &route.RetryPolicy{
+		RetryOn: "5xx",
+	}, protocmp.Transform())
+}
+
+func TestNewRouteSessionAffinity(t *testing.T) {
+	tests := []struct {
+		name     string
+		affinity config.SessionAffinity
+		want     []*route.RouteAction_HashPolicy
+	}{{
+		name:     "cookie",
+		affinity: config.SessionAffinity{Mode: config.SessionAffinityCookie, CookieName: "affinity", CookieTTL: time.Hour},
+		want: []*route.RouteAction_HashPolicy{{
+			PolicySpecifier: &route.RouteAction_HashPolicy_Cookie_{Cookie: &route.RouteAction_HashPolicy_Cookie{
+				Name: "affinity",
+				Ttl:  durationpb.New(time.Hour),
+				Path: "/",
+			}},
+		}},
+	}, {
+		name:     "header",
+		affinity: config.SessionAffinity{Mode: config.SessionAffinityHeader, HeaderName: "x-user-id"},
+		want: []*route.RouteAction_HashPolicy{{
+			PolicySpecifier: &route.RouteAction_HashPolicy_Header_{Header: &route.RouteAction_HashPolicy_Header{
+				HeaderName: "x-user-id",
+			}},
+		}},
+	}, {
+		name:     "source ip",
+		affinity: config.SessionAffinity{Mode: config.SessionAffinitySourceIP},
+		want: []*route.RouteAction_HashPolicy{{
+			PolicySpecifier: &route.RouteAction_HashPolicy_ConnectionProperties_{ConnectionProperties: &route.RouteAction_HashPolicy_ConnectionProperties{
+				SourceIp: true,
+			}},
+		}},
+	}, {
+		name: "none",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewRoute("route", nil, "/", nil, 0, nil, "", WithSessionAffinity(test.affinity))
+			assert.DeepEqual(t, r.GetRoute().HashPolicy, test.want, protocmp.Transform())
+		})
+	}
+}
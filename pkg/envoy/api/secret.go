@@ -0,0 +1,128 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envoy
+
+import (
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	auth "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SecretName returns the name under which the certificate of the given
+// Kubernetes secret is served through SDS. The private key provider is part of
+// the name, as it changes how the private key is handed to Envoy.
+func SecretName(source types.NamespacedName, privateKeyProvider string) string {
+	if privateKeyProvider == "" {
+		return source.String()
+	}
+	return source.String() + "/" + privateKeyProvider
+}
+
+// NewSecret creates the SDS Secret holding the certificate chain and private key
+// of the given certificate. Listeners refer to it by the certificate's name.
+func (c Certificate) NewSecret() (*auth.Secret, error) {
+	tlsCertificate, err := c.createTLScertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Secret{
+		Name: c.Name,
+		Type: &auth.Secret_TlsCertificate{
+			TlsCertificate: tlsCertificate,
+		},
+	}, nil
+}
+
+// NewSecret creates the SDS Secret holding the certificate chain and private key
+// of the given SNI match.
+func (m *SNIMatch) NewSecret() (*auth.Secret, error) {
+	return m.certificate(nil).NewSecret()
+}
+
+func (m *SNIMatch) certificate(cipherSuites []string) Certificate {
+	return Certificate{
+		Name:         SecretName(m.CertSource, ""),
+		Certificate:  m.CertificateChain,
+		PrivateKey:   m.PrivateKey,
+		CipherSuites: cipherSuites,
+	}
+}
+
+// Redacted replaces secret values in redacted resources.
+const Redacted = "[redacted]"
+
+// RedactSecrets replaces all private keys and generic secrets in the given message,
+// including the ones in embedded Any messages, so that it can be shown to people.
+// The message is changed in place.
+func RedactSecrets(m proto.Message) error {
+	switch msg := m.(type) {
+	case *auth.TlsCertificate:
+		if msg.GetPrivateKey() != nil {
+			msg.PrivateKey = redactedDataSource()
+		}
+		if msg.GetPassword() != nil {
+			msg.Password = redactedDataSource()
+		}
+	case *auth.GenericSecret:
+		if msg.GetSecret() != nil {
+			msg.Secret = redactedDataSource()
+		}
+	case *anypb.Any:
+		inner, err := msg.UnmarshalNew()
+		if err != nil {
+			// Types unknown to Kourier can't contain any secrets generated by it.
+			return nil //nolint:nilerr
+		}
+		if err := RedactSecrets(inner); err != nil {
+			return err
+		}
+		value, err := proto.MarshalOptions{Deterministic: true}.Marshal(inner)
+		if err != nil {
+			return err
+		}
+		msg.Value = value
+		return nil
+	}
+
+	var err error
+	m.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = RedactSecrets(list.Get(i).Message().Interface())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				err = RedactSecrets(mv.Message().Interface())
+				return err == nil
+			})
+		case fd.Message() != nil && !fd.IsList() && !fd.IsMap():
+			err = RedactSecrets(v.Message().Interface())
+		}
+		return err == nil
+	})
+	return err
+}
+
+func redactedDataSource() *core.DataSource {
+	return &core.DataSource{Specifier: &core.DataSource_InlineString{InlineString: Redacted}}
+}
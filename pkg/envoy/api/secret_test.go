@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envoy
+
+import (
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	auth "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"google.golang.org/protobuf/testing/protocmp"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSecretName(t *testing.T) {
+	source := types.NamespacedName{Namespace: "secretns", Name: "secretname"}
+
+	assert.Equal(t, SecretName(source, ""), "secretns/secretname")
+	assert.Equal(t, SecretName(source, "cryptomb"), "secretns/secretname/cryptomb")
+}
+
+func TestCertificateNewSecret(t *testing.T) {
+	got, err := c.NewSecret()
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, got, &auth.Secret{
+		Name: c.Name,
+		Type: &auth.Secret_TlsCertificate{
+			TlsCertificate: &auth.TlsCertificate{
+				CertificateChain: &core.DataSource{
+					Specifier: &core.DataSource_InlineBytes{InlineBytes: c.Certificate},
+				},
+				PrivateKey: &core.DataSource{
+					Specifier: &core.DataSource_InlineBytes{InlineBytes: c.PrivateKey},
+				},
+			},
+		},
+	}, protocmp.Transform())
+}
+
+func TestCertificateNewSecretWithPrivateKeyProvider(t *testing.T) {
+	msg, err := crypto.createCryptoMbMessaage()
+	assert.NilError(t, err)
+
+	got, err := crypto.NewSecret()
+	assert.NilError(t, err)
+
+	assert.Equal(t, got.GetName(), crypto.Name)
+	assert.DeepEqual(t, got.GetTlsCertificate().GetCertificateChain().GetInlineBytes(), crypto.Certificate)
+	assert.Assert(t, got.GetTlsCertificate().GetPrivateKey() == nil)
+	assert.DeepEqual(t, got.GetTlsCertificate().GetPrivateKeyProvider(), &auth.PrivateKeyProvider{
+		ProviderName: "cryptomb",
+		ConfigType: &auth.PrivateKeyProvider_TypedConfig{
+			TypedConfig: msg,
+		},
+	}, protocmp.Transform())
+}
+
+func TestCertificateWithoutNameIsRejected(t *testing.T) {
+	_, err := Certificate{}.createTLSContext()
+	assert.ErrorContains(t, err, "must have a name")
+}
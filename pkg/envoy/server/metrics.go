@@ -0,0 +1,68 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"knative.dev/pkg/observability/attributekey"
+)
+
+const scopeName = "knative.dev/net-kourier/pkg/envoy/server"
+
+var (
+	// nodeIDAttr is the node ID of the gateway a response was sent to.
+	nodeIDAttr = attributekey.String("kn.kourier.node_id")
+	// typeURLAttr is the type URL of the resources a response contained.
+	typeURLAttr = attributekey.String("kn.kourier.resource.type")
+)
+
+type metrics struct {
+	nacks   metric.Int64Counter
+	streams metric.Int64UpDownCounter
+}
+
+func newMetrics(provider metric.MeterProvider) *metrics {
+	var (
+		m   metrics
+		err error
+	)
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+	meter := provider.Meter(scopeName)
+
+	m.nacks, err = meter.Int64Counter(
+		"kn.kourier.xds.nacks",
+		metric.WithDescription("The number of responses rejected by gateways."),
+		metric.WithUnit("{response}"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	m.streams, err = meter.Int64UpDownCounter(
+		"kn.kourier.xds.streams",
+		metric.WithDescription("The number of open xDS streams of gateways."),
+		metric.WithUnit("{stream}"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &m
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Gateway is a gateway connected to the management server.
+type Gateway struct {
+	// NodeID is the node ID the gateway connected with.
+	NodeID string
+	// Address is the address the gateway connected from.
+	Address string
+	// Authenticated is true if the gateway proved to be allowed to use the node ID.
+	Authenticated bool
+	// ConnectedSince is the time the gateway opened the stream.
+	ConnectedSince time.Time
+}
+
+// gatewayStream is a stream opened by a gateway.
+type gatewayStream struct {
+	gateway Gateway
+	// identities are the names in the verified client certificate of the gateway.
+	identities []string
+}
+
+// nodeAuthenticator authenticates the gateways opening streams and makes sure they
+// only receive the config of the node ID they are allowed to use. It wraps the
+// callbacks of the xDS server to observe streams being opened and requests.
+//
+// Gateways authenticate with a client certificate if the management server serves
+// over TLS and verifies client certificates. A gateway is allowed to use a node ID
+// if its certificate names it, either as a DNS SAN or as its common name. Without
+// client certificates, gateways are only allowed to use the node IDs explicitly
+// opted out of authentication. Either way, gateways can only use the node IDs of
+// fleets there is a snapshot for.
+type nodeAuthenticator struct {
+	xds.Callbacks
+
+	// certificates are the certificates of the management server. Nodes are only
+	// authenticated if they are set and verify client certificates.
+	certificates *CertificateReloader
+	// unauthenticatedNodeIDs are the node IDs gateways may use if they can't be
+	// authenticated.
+	unauthenticatedNodeIDs []string
+	snapshotCache          cache.SnapshotCache
+	metrics                *metrics
+
+	mu      sync.Mutex
+	streams map[int64]*gatewayStream
+}
+
+func newNodeAuthenticator(callbacks xds.Callbacks, snapshotCache cache.SnapshotCache, metrics *metrics) *nodeAuthenticator {
+	return &nodeAuthenticator{
+		Callbacks:     callbacks,
+		snapshotCache: snapshotCache,
+		metrics:       metrics,
+		streams:       make(map[int64]*gatewayStream),
+	}
+}
+
+// connectedGateways returns the gateways with an open stream, sorted by node ID.
+// A gateway is listed once per stream it opened.
+func (a *nodeAuthenticator) connectedGateways() []Gateway {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	gateways := make([]Gateway, 0, len(a.streams))
+	for _, s := range a.streams {
+		if s.gateway.NodeID != "" {
+			gateways = append(gateways, s.gateway)
+		}
+	}
+	sort.Slice(gateways, func(i, j int) bool {
+		if gateways[i].NodeID != gateways[j].NodeID {
+			return gateways[i].NodeID < gateways[j].NodeID
+		}
+		return gateways[i].ConnectedSince.Before(gateways[j].ConnectedSince)
+	})
+	return gateways
+}
+
+func (a *nodeAuthenticator) OnStreamOpen(ctx context.Context, streamID int64, typeURL string) error {
+	if err := a.openStream(ctx, streamID); err != nil {
+		return err
+	}
+	return a.Callbacks.OnStreamOpen(ctx, streamID, typeURL)
+}
+
+func (a *nodeAuthenticator) OnDeltaStreamOpen(ctx context.Context, streamID int64, typeURL string) error {
+	if err := a.openStream(ctx, streamID); err != nil {
+		return err
+	}
+	return a.Callbacks.OnDeltaStreamOpen(ctx, streamID, typeURL)
+}
+
+func (a *nodeAuthenticator) OnStreamRequest(streamID int64, req *discovery.DiscoveryRequest) error {
+	if err := a.authorize(streamID, req.GetNode().GetId()); err != nil {
+		return err
+	}
+	return a.Callbacks.OnStreamRequest(streamID, req)
+}
+
+func (a *nodeAuthenticator) OnStreamDeltaRequest(streamID int64, req *discovery.DeltaDiscoveryRequest) error {
+	if err := a.authorize(streamID, req.GetNode().GetId()); err != nil {
+		return err
+	}
+	return a.Callbacks.OnStreamDeltaRequest(streamID, req)
+}
+
+// OnFetchRequest authenticates the peer of a unary fetch request. As these requests
+// are not part of a stream, the peer must be allowed to use the node ID of each.
+func (a *nodeAuthenticator) OnFetchRequest(ctx context.Context, req *discovery.DiscoveryRequest) error {
+	var identities []string
+	if a.authenticates() {
+		p, _ := peer.FromContext(ctx)
+		var err error
+		if identities, err = peerIdentities(p); err != nil {
+			return status.Errorf(codes.Unauthenticated, "failed to authenticate gateway: %v", err)
+		}
+	}
+	if err := a.allowed(identities, req.GetNode().GetId()); err != nil {
+		return err
+	}
+	return a.Callbacks.OnFetchRequest(ctx, req)
+}
+
+func (a *nodeAuthenticator) OnStreamClosed(streamID int64, node *core.Node) {
+	a.closeStream(streamID)
+	a.Callbacks.OnStreamClosed(streamID, node)
+}
+
+func (a *nodeAuthenticator) OnDeltaStreamClosed(streamID int64, node *core.Node) {
+	a.closeStream(streamID)
+	a.Callbacks.OnDeltaStreamClosed(streamID, node)
+}
+
+// openStream authenticates the peer of a stream being opened.
+func (a *nodeAuthenticator) openStream(ctx context.Context, streamID int64) error {
+	s := &gatewayStream{gateway: Gateway{ConnectedSince: time.Now()}}
+	p, hasPeer := peer.FromContext(ctx)
+	if hasPeer && p.Addr != nil {
+		s.gateway.Address = p.Addr.String()
+	}
+
+	if a.authenticates() {
+		identities, err := peerIdentities(p)
+		if err != nil {
+			return status.Errorf(codes.Unauthenticated, "failed to authenticate gateway: %v", err)
+		}
+		s.identities = identities
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.streams[streamID] = s
+	a.metrics.streams.Add(ctx, 1)
+	return nil
+}
+
+// authorize verifies that the peer of the stream is allowed to use the node ID it
+// claims. Gateways might only send their node on the first request of a stream.
+func (a *nodeAuthenticator) authorize(streamID int64, nodeID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := a.streams[streamID]
+	if s == nil {
+		// Streams are only unknown if they were rejected on open.
+		return status.Error(codes.Unauthenticated, "unknown stream")
+	}
+	if nodeID == "" || nodeID == s.gateway.NodeID {
+		return nil
+	}
+	if s.gateway.NodeID != "" {
+		return status.Errorf(codes.PermissionDenied, "node ID changed from %q to %q", s.gateway.NodeID, nodeID)
+	}
+
+	if err := a.allowed(s.identities, nodeID); err != nil {
+		return err
+	}
+	s.gateway.Authenticated = a.authenticates()
+	s.gateway.NodeID = nodeID
+	return nil
+}
+
+// allowed verifies that a gateway with the given identities is allowed to use the
+// node ID. The identities are only checked if gateways are authenticated.
+func (a *nodeAuthenticator) allowed(identities []string, nodeID string) error {
+	if a.authenticates() {
+		if !slices.Contains(identities, nodeID) {
+			return status.Errorf(codes.PermissionDenied, "gateway is not allowed to use node ID %q", nodeID)
+		}
+	} else if !slices.Contains(a.unauthenticatedNodeIDs, nodeID) {
+		return status.Errorf(codes.PermissionDenied, "gateway must authenticate with a client certificate to use node ID %q", nodeID)
+	}
+
+	// The node IDs of all fleets are served a snapshot, even if it's empty.
+	if _, err := a.snapshotCache.GetSnapshot(nodeID); err != nil {
+		return status.Errorf(codes.PermissionDenied, "unknown node ID %q", nodeID)
+	}
+	return nil
+}
+
+func (a *nodeAuthenticator) closeStream(streamID int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.streams[streamID]; ok {
+		delete(a.streams, streamID)
+		a.metrics.streams.Add(context.Background(), -1)
+	}
+}
+
+func (a *nodeAuthenticator) authenticates() bool {
+	return a.certificates != nil && a.certificates.verifiesClients()
+}
+
+// peerIdentities returns the names in the verified client certificate of the peer.
+func peerIdentities(p *peer.Peer) ([]string, error) {
+	if p == nil {
+		return nil, errors.New("no peer")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, errors.New("no verified client certificate")
+	}
+
+	leaf := info.State.VerifiedChains[0][0]
+	identities := slices.Clone(leaf.DNSNames)
+	if leaf.Subject.CommonName != "" {
+		identities = append(identities, leaf.Subject.CommonName)
+	}
+	return identities, nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"gotest.tools/v3/assert"
+)
+
+func TestNodeAuthentication(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "net-kourier-controller.knative-serving")
+	reloader := &CertificateReloader{}
+	assert.NilError(t, reloader.Update(xdsSecret(serverCert, serverKey, ca.pem)))
+
+	xdsServer := NewXdsServer(18000, &xds.CallbackFuncs{}, WithTLS(reloader))
+	serveNode(t, xdsServer, testNodeID)
+	callbacks := xdsServer.authenticator
+
+	// A gateway without a client certificate can't open a stream.
+	err := callbacks.OnStreamOpen(peerContext(nil), 1, resource.ListenerType)
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+
+	// A gateway can only use the node IDs its certificate names.
+	clientCert, _ := ca.issue(t, testNodeID)
+	assert.NilError(t, callbacks.OnStreamOpen(peerContext(parseCertificate(t, clientCert)), 2, resource.ListenerType))
+	err = callbacks.OnStreamRequest(2, discoveryRequest("other-gateway"))
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+
+	// Node IDs of fleets without a snapshot are rejected even if the certificate names them.
+	unknownCert, _ := ca.issue(t, "unknown-gateway")
+	assert.NilError(t, callbacks.OnStreamOpen(peerContext(parseCertificate(t, unknownCert)), 4, resource.ListenerType))
+	err = callbacks.OnStreamRequest(4, discoveryRequest("unknown-gateway"))
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+	callbacks.OnStreamClosed(4, nil)
+
+	assert.NilError(t, callbacks.OnDeltaStreamOpen(peerContext(parseCertificate(t, clientCert)), 3, resource.ListenerType))
+	assert.NilError(t, callbacks.OnStreamDeltaRequest(3, &discovery.DeltaDiscoveryRequest{Node: &core.Node{Id: testNodeID}}))
+	// Subsequent requests might not carry the node.
+	assert.NilError(t, callbacks.OnStreamDeltaRequest(3, &discovery.DeltaDiscoveryRequest{}))
+	// The node ID can't be changed on an open stream.
+	err = callbacks.OnStreamDeltaRequest(3, &discovery.DeltaDiscoveryRequest{Node: &core.Node{Id: "other-gateway"}})
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+
+	gateways := xdsServer.ConnectedGateways()
+	assert.Equal(t, len(gateways), 1)
+	assert.Equal(t, gateways[0].NodeID, testNodeID)
+	assert.Equal(t, gateways[0].Address, "10.0.0.1:4321")
+	assert.Assert(t, gateways[0].Authenticated)
+
+	callbacks.OnDeltaStreamClosed(3, &core.Node{Id: testNodeID})
+	assert.Equal(t, len(xdsServer.ConnectedGateways()), 0)
+}
+
+func TestNodeAuthenticationWithoutClientVerification(t *testing.T) {
+	xdsServer := NewXdsServer(18000, &xds.CallbackFuncs{}, WithUnauthenticatedNodeIDs(testNodeID))
+	serveNode(t, xdsServer, testNodeID)
+	serveNode(t, xdsServer, "other-gateway")
+	callbacks := xdsServer.authenticator
+
+	// Without client certificates, gateways can only use the node IDs opted out of
+	// authentication, even if there is a snapshot for others.
+	assert.NilError(t, callbacks.OnStreamOpen(peerContext(nil), 2, resource.ListenerType))
+	err := callbacks.OnStreamRequest(2, discoveryRequest("other-gateway"))
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+	callbacks.OnStreamClosed(2, nil)
+
+	assert.NilError(t, callbacks.OnStreamOpen(peerContext(nil), 1, resource.ListenerType))
+	assert.NilError(t, callbacks.OnStreamRequest(1, discoveryRequest(testNodeID)))
+
+	gateways := xdsServer.ConnectedGateways()
+	assert.Equal(t, len(gateways), 1)
+	assert.Equal(t, gateways[0].NodeID, testNodeID)
+	assert.Assert(t, !gateways[0].Authenticated)
+
+	callbacks.OnStreamClosed(1, &core.Node{Id: testNodeID})
+	assert.Equal(t, len(xdsServer.ConnectedGateways()), 0)
+}
+
+func TestNodeAuthenticationFailsClosed(t *testing.T) {
+	xdsServer := NewXdsServer(18000, &xds.CallbackFuncs{})
+	serveNode(t, xdsServer, testNodeID)
+	callbacks := xdsServer.authenticator
+	assert.Assert(t, !xdsServer.AuthenticatesGateways())
+
+	// Unless node IDs are opted out of authentication, gateways that can't be
+	// authenticated can't use any.
+	assert.NilError(t, callbacks.OnStreamOpen(peerContext(nil), 1, resource.ListenerType))
+	err := callbacks.OnStreamRequest(1, discoveryRequest(testNodeID))
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+
+	_, err = xdsServer.server.FetchSecrets(peerContext(nil), discoveryRequest(testNodeID))
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+}
+
+func TestNodeAuthenticationOfFetchRequests(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "net-kourier-controller.knative-serving")
+	reloader := &CertificateReloader{}
+	assert.NilError(t, reloader.Update(xdsSecret(serverCert, serverKey, ca.pem)))
+
+	xdsServer := NewXdsServer(18000, &xds.CallbackFuncs{}, WithTLS(reloader))
+	for _, nodeID := range []string{testNodeID, "other-gateway"} {
+		snapshot, err := cache.NewSnapshot("1", map[resource.Type][]types.Resource{
+			resource.SecretType: {&tlsv3.Secret{Name: nodeID + "-secret"}},
+		})
+		assert.NilError(t, err)
+		assert.NilError(t, xdsServer.SetSnapshot(nodeID, snapshot))
+	}
+	fetchSecret := func(ctx context.Context, nodeID string) error {
+		_, err := xdsServer.server.FetchSecrets(ctx, &discovery.DiscoveryRequest{
+			Node:          &core.Node{Id: nodeID},
+			ResourceNames: []string{nodeID + "-secret"},
+		})
+		return err
+	}
+
+	// A gateway without a client certificate can't fetch anything.
+	err := fetchSecret(peerContext(nil), testNodeID)
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+
+	// A gateway can fetch the secrets of its own node, but not those of others.
+	clientCert, _ := ca.issue(t, testNodeID)
+	ctx := peerContext(parseCertificate(t, clientCert))
+	assert.NilError(t, fetchSecret(ctx, testNodeID))
+	err = fetchSecret(ctx, "other-gateway")
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+}
+
+// peerContext returns a context of a stream opened by a peer that presented the
+// given verified client certificate, if any.
+func peerContext(cert *x509.Certificate) context.Context {
+	p := &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4321}}
+	if cert != nil {
+		p.AuthInfo = credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}}
+	}
+	return peer.NewContext(context.Background(), p)
+}
+
+func parseCertificate(t *testing.T, certPEM []byte) *x509.Certificate {
+	t.Helper()
+
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NilError(t, err)
+	return cert
+}
+
+// serveNode serves an empty snapshot to the given node ID, making it a known fleet.
+func serveNode(t *testing.T, xdsServer *XdsServer, nodeID string) {
+	t.Helper()
+
+	snapshot, err := cache.NewSnapshot("1", nil)
+	assert.NilError(t, err)
+	assert.NilError(t, xdsServer.SetSnapshot(nodeID, snapshot))
+}
+
+func discoveryRequest(nodeID string) *discovery.DiscoveryRequest {
+	return &discovery.DiscoveryRequest{Node: &core.Node{Id: nodeID}}
+}
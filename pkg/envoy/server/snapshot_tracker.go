@@ -0,0 +1,378 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"go.opentelemetry.io/otel/metric"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// RollbackFunc is called when a node rejected the snapshot with the given version
+// and has been rolled back to the last snapshot it accepted.
+type RollbackFunc func(nodeID, rejectedVersion string, errorDetail *rpcstatus.Status)
+
+// AcceptFunc is called when a node accepted the snapshot with the given version
+// for all types it subscribed to.
+type AcceptFunc func(nodeID, version string)
+
+// Rejection is a version of a type of resources a node rejected.
+type Rejection struct {
+	// Version is the rejected version.
+	Version string
+	// Message is the reason the node gave for rejecting it.
+	Message string
+}
+
+// NodeStatus is the status of the config served to a node.
+type NodeStatus struct {
+	// Snapshot is the snapshot currently served to the node, if any.
+	Snapshot cache.ResourceSnapshot
+	// LastAcceptedVersion is the version of the last snapshot all streams of the
+	// node accepted for all types they subscribed to, if any.
+	LastAcceptedVersion string
+	// Acked holds the last version all open streams of the node accepted per type
+	// URL. Types the streams disagree on are left out.
+	Acked map[string]string
+	// Nacked holds the last version the node rejected per type URL.
+	Nacked map[string]Rejection
+}
+
+// response identifies the last response sent for a type on a stream, so that the
+// ACK or NACK referring to it by nonce can be attributed to a snapshot version.
+type response struct {
+	nonce   string
+	version string
+	// resources holds the versions of the resources of the type in the snapshot
+	// that was sent, if it was still the current one.
+	resources map[string]string
+}
+
+// streamAcks tracks what a single stream of a node accepted. All the gateways of a
+// fleet share the node ID, each with its own stream.
+type streamAcks struct {
+	nodeID string
+	// acked holds the last version the stream accepted per subscribed type.
+	acked map[string]string
+	// ackedResources holds the versions of the resources the stream accepted last
+	// per subscribed type.
+	ackedResources map[string]map[string]string
+	// responses holds the last response sent per type.
+	responses map[string]response
+}
+
+// nodeSnapshots tracks the snapshots of a single node.
+type nodeSnapshots struct {
+	// current is the snapshot currently served to the node.
+	current cache.ResourceSnapshot
+	// lastGood is the last snapshot all streams of the node accepted for all types
+	// they subscribed to.
+	lastGood cache.ResourceSnapshot
+	// nacked holds the last version any stream of the node rejected per type.
+	nacked map[string]Rejection
+	// streams are the open streams of the node.
+	streams map[int64]*streamAcks
+}
+
+// snapshotTracker keeps track of the snapshot versions the streams of each node
+// acknowledged and rolls a node back to the last snapshot all its streams fully
+// accepted when any of them rejects one. It wraps the callbacks of the xDS server
+// to observe requests and responses.
+type snapshotTracker struct {
+	xds.Callbacks
+
+	snapshotCache cache.SnapshotCache
+	onRollback    RollbackFunc
+	onAccept      AcceptFunc
+	metrics       *metrics
+
+	mu      sync.Mutex
+	nodes   map[string]*nodeSnapshots
+	streams map[int64]*streamAcks
+}
+
+func newSnapshotTracker(callbacks xds.Callbacks, snapshotCache cache.SnapshotCache, metrics *metrics) *snapshotTracker {
+	return &snapshotTracker{
+		Callbacks:     callbacks,
+		snapshotCache: snapshotCache,
+		metrics:       metrics,
+		nodes:         make(map[string]*nodeSnapshots),
+		streams:       make(map[int64]*streamAcks),
+	}
+}
+
+// setSnapshot serves the given snapshot to the node.
+func (t *snapshotTracker) setSnapshot(ctx context.Context, nodeID string, snapshot cache.ResourceSnapshot) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// The versions of the individual resources tell which types a snapshot changed.
+	if err := snapshot.ConstructVersionMap(); err != nil {
+		return err
+	}
+	if err := t.snapshotCache.SetSnapshot(ctx, nodeID, snapshot); err != nil {
+		return err
+	}
+	node := t.node(nodeID)
+	node.current = snapshot
+	// The node might have accepted all the resources of the snapshot already, if it
+	// only changed types the node didn't subscribe to.
+	t.checkAccepted(nodeID, node)
+	return nil
+}
+
+// lastGoodVersion returns the version of the last snapshot the node accepted.
+func (t *snapshotTracker) lastGoodVersion(nodeID string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	node := t.nodes[nodeID]
+	if node == nil || node.lastGood == nil {
+		return "", false
+	}
+	return snapshotVersion(node.lastGood), true
+}
+
+// nodeStatuses returns the status of the config served to each known node.
+func (t *snapshotTracker) nodeStatuses() map[string]NodeStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make(map[string]NodeStatus, len(t.nodes))
+	for nodeID, node := range t.nodes {
+		status := NodeStatus{
+			Snapshot: node.current,
+			Acked:    node.commonAcks(),
+			Nacked:   maps.Clone(node.nacked),
+		}
+		if node.lastGood != nil {
+			status.LastAcceptedVersion = snapshotVersion(node.lastGood)
+		}
+		statuses[nodeID] = status
+	}
+	return statuses
+}
+
+func (t *snapshotTracker) OnStreamClosed(streamID int64, node *core.Node) {
+	t.forgetStream(streamID)
+	t.Callbacks.OnStreamClosed(streamID, node)
+}
+
+func (t *snapshotTracker) OnDeltaStreamClosed(streamID int64, node *core.Node) {
+	t.forgetStream(streamID)
+	t.Callbacks.OnDeltaStreamClosed(streamID, node)
+}
+
+func (t *snapshotTracker) OnStreamRequest(streamID int64, req *discovery.DiscoveryRequest) error {
+	t.observeRequest(streamID, req.GetNode().GetId(), req.GetTypeUrl(), req.GetResponseNonce(), req.GetErrorDetail())
+	return t.Callbacks.OnStreamRequest(streamID, req)
+}
+
+func (t *snapshotTracker) OnStreamDeltaRequest(streamID int64, req *discovery.DeltaDiscoveryRequest) error {
+	t.observeRequest(streamID, req.GetNode().GetId(), req.GetTypeUrl(), req.GetResponseNonce(), req.GetErrorDetail())
+	return t.Callbacks.OnStreamDeltaRequest(streamID, req)
+}
+
+func (t *snapshotTracker) OnStreamResponse(ctx context.Context, streamID int64, req *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+	t.observeResponse(streamID, resp.GetTypeUrl(), resp.GetNonce(), resp.GetVersionInfo())
+	t.Callbacks.OnStreamResponse(ctx, streamID, req, resp)
+}
+
+func (t *snapshotTracker) OnStreamDeltaResponse(streamID int64, req *discovery.DeltaDiscoveryRequest, resp *discovery.DeltaDiscoveryResponse) {
+	t.observeResponse(streamID, resp.GetTypeUrl(), resp.GetNonce(), resp.GetSystemVersionInfo())
+	t.Callbacks.OnStreamDeltaResponse(streamID, req, resp)
+}
+
+func (t *snapshotTracker) observeResponse(streamID int64, typeURL, nonce, version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stream := t.stream(streamID)
+	resp := response{nonce: nonce, version: version}
+	if node := t.nodes[stream.nodeID]; node != nil && node.current != nil && snapshotVersion(node.current) == version {
+		resp.resources = node.current.GetVersionMap(typeURL)
+	}
+	stream.responses[typeURL] = resp
+}
+
+func (t *snapshotTracker) observeRequest(streamID int64, nodeID, typeURL, nonce string, errorDetail *rpcstatus.Status) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stream := t.stream(streamID)
+	// Envoy might only send the node on the first request of a stream.
+	if nodeID != "" && stream.nodeID == "" {
+		stream.nodeID = nodeID
+		t.node(nodeID).streams[streamID] = stream
+	}
+	nodeID = stream.nodeID
+	if nodeID == "" {
+		return
+	}
+
+	node := t.node(nodeID)
+	if _, ok := stream.acked[typeURL]; !ok {
+		// A new subscription has not accepted anything yet.
+		stream.acked[typeURL] = ""
+	}
+
+	// ACKs and NACKs refer to the last response sent on the stream. Late ones, for
+	// example to a response sent before a rollback, are ignored.
+	resp, ok := stream.responses[typeURL]
+	if nonce == "" || !ok || resp.nonce != nonce {
+		// Either an initial request or one referring to a superseded response.
+		return
+	}
+
+	if errorDetail == nil {
+		stream.acked[typeURL] = resp.version
+		if resp.resources != nil {
+			stream.ackedResources[typeURL] = resp.resources
+		} else {
+			delete(stream.ackedResources, typeURL)
+		}
+		t.checkAccepted(nodeID, node)
+		return
+	}
+
+	node.nacked[typeURL] = Rejection{Version: resp.version, Message: errorDetail.GetMessage()}
+	t.metrics.nacks.Add(context.Background(), 1, metric.WithAttributes(nodeIDAttr.With(nodeID), typeURLAttr.With(typeURL)))
+
+	// Only roll back if the rejected version is the one currently served and there
+	// is an accepted one to go back to. Older versions have already been replaced.
+	if node.current == nil || resp.version != snapshotVersion(node.current) ||
+		node.lastGood == nil || snapshotVersion(node.lastGood) == resp.version {
+		return
+	}
+	if err := t.snapshotCache.SetSnapshot(context.Background(), nodeID, node.lastGood); err != nil {
+		return
+	}
+	node.current = node.lastGood
+	if t.onRollback != nil {
+		// Called in a goroutine as it is likely to call back into the server.
+		go t.onRollback(nodeID, resp.version, errorDetail)
+	}
+}
+
+// checkAccepted makes the current snapshot of the node its last good one once all
+// streams of the node accepted all types they subscribed to.
+func (t *snapshotTracker) checkAccepted(nodeID string, node *nodeSnapshots) {
+	if node.current == nil || node.current == node.lastGood || !t.acceptedAllTypes(node) {
+		return
+	}
+	previous := node.lastGood
+	node.lastGood = node.current
+	if t.onAccept != nil && (previous == nil || snapshotVersion(previous) != snapshotVersion(node.current)) {
+		// Called in a goroutine as it might call back into the server.
+		go t.onAccept(nodeID, snapshotVersion(node.current))
+	}
+}
+
+// acceptedAllTypes returns whether all streams of the node accepted the resources
+// of the current snapshot for all types they subscribed to. With delta xDS, types
+// a snapshot didn't change are not sent again, so they count as accepted if the
+// stream accepted the same resources with an earlier version.
+func (t *snapshotTracker) acceptedAllTypes(node *nodeSnapshots) bool {
+	version := snapshotVersion(node.current)
+	subscribed := false
+	for _, stream := range node.streams {
+		for typeURL, acked := range stream.acked {
+			subscribed = true
+			if acked == version {
+				continue
+			}
+			resources, ok := stream.ackedResources[typeURL]
+			if !ok || !maps.Equal(resources, node.current.GetVersionMap(typeURL)) {
+				return false
+			}
+		}
+	}
+	return subscribed
+}
+
+// commonAcks returns the last version all open streams of the node accepted per
+// type, leaving out the types they disagree on.
+func (node *nodeSnapshots) commonAcks() map[string]string {
+	acks := make(map[string]string)
+	disagree := make(map[string]bool)
+	for _, stream := range node.streams {
+		for typeURL, acked := range stream.acked {
+			if other, ok := acks[typeURL]; ok && other != acked {
+				disagree[typeURL] = true
+			}
+			acks[typeURL] = acked
+		}
+	}
+	for typeURL := range disagree {
+		delete(acks, typeURL)
+	}
+	return acks
+}
+
+func (t *snapshotTracker) node(nodeID string) *nodeSnapshots {
+	node := t.nodes[nodeID]
+	if node == nil {
+		node = &nodeSnapshots{
+			nacked:  make(map[string]Rejection),
+			streams: make(map[int64]*streamAcks),
+		}
+		t.nodes[nodeID] = node
+	}
+	return node
+}
+
+func (t *snapshotTracker) stream(streamID int64) *streamAcks {
+	stream := t.streams[streamID]
+	if stream == nil {
+		stream = &streamAcks{
+			acked:          make(map[string]string),
+			ackedResources: make(map[string]map[string]string),
+			responses:      make(map[string]response),
+		}
+		t.streams[streamID] = stream
+	}
+	return stream
+}
+
+func (t *snapshotTracker) forgetStream(streamID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stream := t.streams[streamID]
+	delete(t.streams, streamID)
+	if stream == nil || stream.nodeID == "" {
+		return
+	}
+	node := t.nodes[stream.nodeID]
+	delete(node.streams, streamID)
+	// The stream might have been the last one yet to accept the current snapshot.
+	t.checkAccepted(stream.nodeID, node)
+}
+
+// snapshotVersion returns the version of the snapshot. All resource types of the
+// snapshots generated by Kourier share the same version.
+func snapshotVersion(snapshot cache.ResourceSnapshot) string {
+	return snapshot.GetVersion(resource.ListenerType)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/networking/pkg/certificates"
+)
+
+// CertificateReloader holds the certificate the management server presents to
+// gateways and the CA used to verify the gateways' client certificates. Both are
+// read from a Secret and replaced whenever the Secret is updated, so that rotated
+// certificates are used for new connections without a restart.
+type CertificateReloader struct {
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// Update replaces the certificates with the ones from the given Secret. The Secret
+// must contain a certificate and key. If it also contains a CA, gateways must
+// present a client certificate signed by it.
+func (r *CertificateReloader) Update(secret *corev1.Secret) error {
+	cert, err := tls.X509KeyPair(secret.Data[certificates.CertName], secret.Data[certificates.PrivateKeyName])
+	if err != nil {
+		return fmt.Errorf("invalid certificate in secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+
+	var clientCAs *x509.CertPool
+	if ca := secret.Data[certificates.CaCertName]; len(ca) > 0 {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("invalid CA in secret %s/%s", secret.Namespace, secret.Name)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	return nil
+}
+
+// verifiesClients returns true if gateways must present a client certificate.
+func (r *CertificateReloader) verifiesClients() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCAs != nil
+}
+
+// TLSConfig returns a TLS config that always uses the latest certificates.
+func (r *CertificateReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			if r.cert == nil {
+				return nil, errors.New("no certificate loaded")
+			}
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				// gRPC requires HTTP/2 to be negotiated.
+				NextProtos: []string{"h2"},
+			}
+			if r.clientCAs != nil {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = r.clientCAs
+			}
+			return cfg, nil
+		},
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/networking/pkg/certificates"
+)
+
+func TestCertificateReloaderRequiresClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "net-kourier-controller.knative-serving")
+	clientCert, clientKey := ca.issue(t, "3scale-kourier-gateway")
+
+	reloader := &CertificateReloader{}
+	assert.NilError(t, reloader.Update(xdsSecret(serverCert, serverKey, ca.pem)))
+
+	// A gateway presenting a certificate signed by the CA is accepted.
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	assert.NilError(t, err)
+	assert.NilError(t, handshake(reloader, &tls.Config{
+		RootCAs:      ca.pool(),
+		ServerName:   "net-kourier-controller.knative-serving",
+		Certificates: []tls.Certificate{pair},
+	}))
+
+	// A gateway without a client certificate is rejected.
+	assert.Assert(t, handshake(reloader, &tls.Config{
+		RootCAs:    ca.pool(),
+		ServerName: "net-kourier-controller.knative-serving",
+	}) != nil)
+}
+
+func TestCertificateReloaderWithoutCA(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "net-kourier-controller.knative-serving")
+
+	reloader := &CertificateReloader{}
+	assert.NilError(t, reloader.Update(xdsSecret(serverCert, serverKey, nil)))
+
+	// Without a CA, client certificates aren't required.
+	assert.NilError(t, handshake(reloader, &tls.Config{
+		RootCAs:    ca.pool(),
+		ServerName: "net-kourier-controller.knative-serving",
+	}))
+}
+
+func TestCertificateReloaderRotation(t *testing.T) {
+	oldCA, newCA := newTestCA(t), newTestCA(t)
+	oldCert, oldKey := oldCA.issue(t, "net-kourier-controller.knative-serving")
+	newCert, newKey := newCA.issue(t, "net-kourier-controller.knative-serving")
+	clientConfig := func(ca *testCA) *tls.Config {
+		return &tls.Config{RootCAs: ca.pool(), ServerName: "net-kourier-controller.knative-serving"}
+	}
+
+	reloader := &CertificateReloader{}
+	tlsConfig := reloader.TLSConfig()
+	assert.NilError(t, reloader.Update(xdsSecret(oldCert, oldKey, nil)))
+	assert.NilError(t, handshake(reloader, clientConfig(oldCA)))
+
+	// New connections use the rotated certificate, even with a config obtained before.
+	assert.NilError(t, reloader.Update(xdsSecret(newCert, newKey, nil)))
+	assert.NilError(t, handshakeWith(tlsConfig, clientConfig(newCA)))
+	assert.Assert(t, handshakeWith(tlsConfig, clientConfig(oldCA)) != nil)
+
+	// An invalid update keeps the current certificate.
+	assert.ErrorContains(t, reloader.Update(xdsSecret([]byte("invalid"), newKey, nil)), "invalid certificate")
+	assert.NilError(t, handshakeWith(tlsConfig, clientConfig(newCA)))
+}
+
+func TestCertificateReloaderWithoutCertificate(t *testing.T) {
+	reloader := &CertificateReloader{}
+	assert.Assert(t, handshake(reloader, &tls.Config{InsecureSkipVerify: true}) != nil) //nolint:gosec // No certificate to verify.
+}
+
+func handshake(reloader *CertificateReloader, clientConfig *tls.Config) error {
+	return handshakeWith(reloader.TLSConfig(), clientConfig)
+}
+
+// handshakeWith performs a TLS handshake between a server using serverConfig and a
+// client using clientConfig and returns the error of either side, if any.
+func handshakeWith(serverConfig, clientConfig *tls.Config) error {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- tls.Server(conn, serverConfig).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), clientConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return <-serverErr
+}
+
+func xdsSecret(cert, key, ca []byte) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "knative-serving",
+			Name:      "net-kourier-xds-tls",
+		},
+		Data: map[string][]byte{
+			certificates.CertName:       cert,
+			certificates.PrivateKeyName: key,
+		},
+	}
+	if ca != nil {
+		secret.Data[certificates.CaCertName] = ca
+	}
+	return secret
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NilError(t, err)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// issue returns a PEM encoded certificate and key for the given DNS name, usable
+// both as a server and as a client certificate.
+func (ca *testCA) issue(t *testing.T, dnsName string) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NilError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
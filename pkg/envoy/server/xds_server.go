@@ -24,11 +24,14 @@ import (
 
 	cluster "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
 	route "github.com/envoyproxy/go-control-plane/envoy/service/route/v3"
+	secret "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	health "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 )
@@ -39,22 +42,83 @@ const (
 
 type XdsServer struct {
 	managementPort uint
+	healthPort     uint
 	ctx            context.Context
 	server         xds.Server
 	snapshotCache  cache.SnapshotCache
+	tracker        *snapshotTracker
+	authenticator  *nodeAuthenticator
+	certificates   *CertificateReloader
 }
 
-func NewXdsServer(managementPort uint, callbacks xds.Callbacks) *XdsServer {
+// Option configures optional behavior of the XdsServer.
+type Option func(*XdsServer)
+
+// WithRollbackFunc sets a function that is called whenever a node rejected a
+// snapshot and was rolled back to the last snapshot it accepted.
+func WithRollbackFunc(f RollbackFunc) Option {
+	return func(s *XdsServer) {
+		s.tracker.onRollback = f
+	}
+}
+
+// WithAcceptFunc sets a function that is called whenever a node accepted a
+// snapshot for all types it subscribed to.
+func WithAcceptFunc(f AcceptFunc) Option {
+	return func(s *XdsServer) {
+		s.tracker.onAccept = f
+	}
+}
+
+// WithTLS makes the management server serve over TLS using the certificates of
+// the given reloader. Gateways are required to present a client certificate if
+// the reloader holds a CA, in which case gateways are only allowed to use the node
+// IDs their client certificate names.
+func WithTLS(certificates *CertificateReloader) Option {
+	return func(s *XdsServer) {
+		s.certificates = certificates
+		s.authenticator.certificates = certificates
+	}
+}
+
+// WithUnauthenticatedNodeIDs allows gateways to use the given node IDs without
+// authenticating, which is the case unless the management server verifies client
+// certificates, see WithTLS. Gateways can't use any other node ID then.
+func WithUnauthenticatedNodeIDs(nodeIDs ...string) Option {
+	return func(s *XdsServer) {
+		s.authenticator.unauthenticatedNodeIDs = nodeIDs
+	}
+}
+
+// WithHealthPort additionally serves the gRPC health service over plaintext on the
+// given port. This allows probing the server even if it is serving over TLS.
+func WithHealthPort(port uint) Option {
+	return func(s *XdsServer) {
+		s.healthPort = port
+	}
+}
+
+func NewXdsServer(managementPort uint, callbacks xds.Callbacks, opts ...Option) *XdsServer {
 	ctx := context.Background()
 	snapshotCache := cache.NewSnapshotCache(true, cache.IDHash{}, nil)
-	srv := xds.NewServer(ctx, snapshotCache, callbacks)
+	metrics := newMetrics(nil)
+	tracker := newSnapshotTracker(callbacks, snapshotCache, metrics)
+	// Authenticate gateways before anything else gets to see their requests.
+	authenticator := newNodeAuthenticator(tracker, snapshotCache, metrics)
+	srv := xds.NewServer(ctx, snapshotCache, authenticator)
 
-	return &XdsServer{
+	s := &XdsServer{
 		managementPort: managementPort,
 		ctx:            ctx,
 		server:         srv,
 		snapshotCache:  snapshotCache,
+		tracker:        tracker,
+		authenticator:  authenticator,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 type healthServer struct {
@@ -66,15 +130,22 @@ func (healthServer) Check(context.Context, *health.HealthCheckRequest) (*health.
 	return &health.HealthCheckResponse{Status: health.HealthCheckResponse_SERVING}, nil
 }
 
-// RunManagementServer starts an xDS server at the given Port.
+// RunManagementServer starts an xDS server at the given Port. Gateways can use
+// either the state-of-the-world or the incremental (delta) variant of the
+// protocol. In the latter case, resources are versioned individually and only
+// the ones that changed between snapshots are sent.
 func (envoyXdsServer *XdsServer) RunManagementServer() error {
 	port := envoyXdsServer.managementPort
 	server := envoyXdsServer.server
 
-	grpcServer := grpc.NewServer(
+	opts := []grpc.ServerOption{
 		grpc.MaxConcurrentStreams(grpcMaxConcurrentStreams),
 		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: 20 * time.Second, PermitWithoutStream: true}),
-	)
+	}
+	if envoyXdsServer.certificates != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(envoyXdsServer.certificates.TLSConfig())))
+	}
+	grpcServer := grpc.NewServer(opts...)
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return fmt.Errorf("failed to listen: %w", err)
@@ -84,25 +155,80 @@ func (envoyXdsServer *XdsServer) RunManagementServer() error {
 	discovery.RegisterAggregatedDiscoveryServiceServer(grpcServer, server)
 	health.RegisterHealthServer(grpcServer, healthServer{})
 	cluster.RegisterClusterDiscoveryServiceServer(grpcServer, server)
+	endpoint.RegisterEndpointDiscoveryServiceServer(grpcServer, server)
 	listener.RegisterListenerDiscoveryServiceServer(grpcServer, server)
 	route.RegisterRouteDiscoveryServiceServer(grpcServer, server)
+	secret.RegisterSecretDiscoveryServiceServer(grpcServer, server)
 
-	errCh := make(chan error)
+	// Both the management and the health server report to errCh.
+	errCh := make(chan error, 2)
 	go func() {
-		if err = grpcServer.Serve(lis); err != nil {
-			errCh <- err
+		if err := grpcServer.Serve(lis); err != nil {
+			errCh <- fmt.Errorf("failed to serve: %w", err)
 		}
 	}()
 
+	if envoyXdsServer.healthPort != 0 {
+		healthServer, err := envoyXdsServer.runHealthServer(errCh)
+		if err != nil {
+			grpcServer.Stop()
+			return err
+		}
+		defer healthServer.GracefulStop()
+	}
+
 	select {
 	case <-envoyXdsServer.ctx.Done():
 		grpcServer.GracefulStop()
 		return nil
 	case err := <-errCh:
-		return fmt.Errorf("failed to serve: %w", err)
+		grpcServer.Stop()
+		return err
 	}
 }
 
+// runHealthServer serves the gRPC health service over plaintext on the health port.
+// Should serving fail, the error is sent to errCh.
+func (envoyXdsServer *XdsServer) runHealthServer(errCh chan<- error) (*grpc.Server, error) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", envoyXdsServer.healthPort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	grpcServer := grpc.NewServer()
+	health.RegisterHealthServer(grpcServer, healthServer{})
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			errCh <- fmt.Errorf("failed to serve the health service: %w", err)
+		}
+	}()
+	return grpcServer, nil
+}
+
+// SetSnapshot serves the given snapshot to the node. Should the node reject it,
+// it is rolled back to the last snapshot it accepted.
 func (envoyXdsServer *XdsServer) SetSnapshot(nodeID string, snapshot cache.ResourceSnapshot) error {
-	return envoyXdsServer.snapshotCache.SetSnapshot(context.Background(), nodeID, snapshot)
+	return envoyXdsServer.tracker.setSnapshot(context.Background(), nodeID, snapshot)
+}
+
+// LastAcceptedVersion returns the version of the last snapshot the node accepted.
+func (envoyXdsServer *XdsServer) LastAcceptedVersion(nodeID string) (string, bool) {
+	return envoyXdsServer.tracker.lastGoodVersion(nodeID)
+}
+
+// ConnectedGateways returns the gateways currently connected to the management
+// server, sorted by node ID.
+func (envoyXdsServer *XdsServer) ConnectedGateways() []Gateway {
+	return envoyXdsServer.authenticator.connectedGateways()
+}
+
+// AuthenticatesGateways returns true if the management server currently verifies
+// the client certificates of gateways.
+func (envoyXdsServer *XdsServer) AuthenticatesGateways() bool {
+	return envoyXdsServer.authenticator.authenticates()
+}
+
+// NodeStatuses returns the status of the config served to each known node.
+func (envoyXdsServer *XdsServer) NodeStatuses() map[string]NodeStatus {
+	return envoyXdsServer.tracker.nodeStatuses()
 }
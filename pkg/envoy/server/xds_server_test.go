@@ -0,0 +1,365 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	v3Cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	stream "github.com/envoyproxy/go-control-plane/pkg/server/stream/v3"
+	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gotest.tools/v3/assert"
+)
+
+const testNodeID = "test-gateway"
+
+func TestDeltaOnlySendsChangedResources(t *testing.T) {
+	xdsServer := NewXdsServer(18000, &xds.CallbackFuncs{})
+
+	setClusters(t, xdsServer, "1", testCluster("foo", time.Second), testCluster("bar", time.Second))
+	resp := deltaWatch(t, xdsServer, nil)
+	assert.DeepEqual(t, resourceNames(t, resp), []string{"bar", "foo"})
+
+	// Only "foo" changes, so a gateway that already has the previous
+	// resources must only receive "foo" again.
+	setClusters(t, xdsServer, "2", testCluster("foo", 2*time.Second), testCluster("bar", time.Second))
+	resp = deltaWatch(t, xdsServer, resp.GetNextVersionMap())
+	assert.DeepEqual(t, resourceNames(t, resp), []string{"foo"})
+
+	// Removed resources are reported by name.
+	setClusters(t, xdsServer, "3", testCluster("foo", 2*time.Second))
+	resp = deltaWatch(t, xdsServer, resp.GetNextVersionMap())
+	assert.DeepEqual(t, resourceNames(t, resp), []string(nil))
+	out, err := resp.GetDeltaDiscoveryResponse()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, out.GetRemovedResources(), []string{"bar"})
+}
+
+func TestRollbackToLastAcceptedSnapshot(t *testing.T) {
+	type rollback struct {
+		nodeID, version string
+	}
+	rollbacks := make(chan rollback, 1)
+	xdsServer := NewXdsServer(18000, &xds.CallbackFuncs{},
+		WithRollbackFunc(func(nodeID, version string, _ *rpcstatus.Status) {
+			rollbacks <- rollback{nodeID: nodeID, version: version}
+		}))
+	callbacks := xdsServer.tracker
+	const streamID = 1
+
+	// respond simulates the server pushing the given version of a type and the
+	// gateway answering with an ACK, or a NACK if errorDetail is set.
+	respond := func(typeURL, nonce, version string, errorDetail *rpcstatus.Status) {
+		t.Helper()
+		assert.NilError(t, callbacks.OnStreamRequest(streamID, &discovery.DiscoveryRequest{
+			Node:    &core.Node{Id: testNodeID},
+			TypeUrl: typeURL,
+		}))
+		callbacks.OnStreamResponse(context.Background(), streamID, nil, &discovery.DiscoveryResponse{
+			TypeUrl:     typeURL,
+			Nonce:       nonce,
+			VersionInfo: version,
+		})
+		assert.NilError(t, callbacks.OnStreamRequest(streamID, &discovery.DiscoveryRequest{
+			TypeUrl:       typeURL,
+			ResponseNonce: nonce,
+			ErrorDetail:   errorDetail,
+		}))
+	}
+
+	setListeners(t, xdsServer, "1")
+	_, ok := xdsServer.LastAcceptedVersion(testNodeID)
+	assert.Assert(t, !ok)
+
+	respond(resource.ClusterType, "a", "1", nil)
+	respond(resource.ListenerType, "b", "1", nil)
+	version, ok := xdsServer.LastAcceptedVersion(testNodeID)
+	assert.Assert(t, ok)
+	assert.Equal(t, version, "1")
+
+	// Version 2 is only accepted for clusters but rejected for listeners.
+	setListeners(t, xdsServer, "2")
+	respond(resource.ClusterType, "c", "2", nil)
+	version, _ = xdsServer.LastAcceptedVersion(testNodeID)
+	assert.Equal(t, version, "1")
+	respond(resource.ListenerType, "d", "2", &rpcstatus.Status{Message: "bad listener"})
+
+	select {
+	case got := <-rollbacks:
+		assert.Equal(t, got, rollback{nodeID: testNodeID, version: "2"})
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for rollback")
+	}
+	snapshot, err := xdsServer.snapshotCache.GetSnapshot(testNodeID)
+	assert.NilError(t, err)
+	assert.Equal(t, snapshot.GetVersion(resource.ListenerType), "1")
+
+	status := xdsServer.NodeStatuses()[testNodeID]
+	assert.Equal(t, status.Snapshot.GetVersion(resource.ListenerType), "1")
+	assert.Equal(t, status.LastAcceptedVersion, "1")
+	assert.DeepEqual(t, status.Acked, map[string]string{resource.ClusterType: "2", resource.ListenerType: "1"})
+	assert.DeepEqual(t, status.Nacked, map[string]Rejection{
+		resource.ListenerType: {Version: "2", Message: "bad listener"},
+	})
+
+	// A NACK for a version that is no longer served doesn't roll back again.
+	setListeners(t, xdsServer, "3")
+	respond(resource.ListenerType, "e", "2", &rpcstatus.Status{Message: "bad listener"})
+	snapshot, err = xdsServer.snapshotCache.GetSnapshot(testNodeID)
+	assert.NilError(t, err)
+	assert.Equal(t, snapshot.GetVersion(resource.ListenerType), "3")
+	assert.Equal(t, len(rollbacks), 0)
+}
+
+func TestAcceptedByAllStreamsOfNode(t *testing.T) {
+	rollbacks := make(chan string, 1)
+	accepted := make(chan string, 3)
+	xdsServer := NewXdsServer(18000, &xds.CallbackFuncs{},
+		WithRollbackFunc(func(_, version string, _ *rpcstatus.Status) {
+			rollbacks <- version
+		}),
+		WithAcceptFunc(func(_, version string) {
+			accepted <- version
+		}))
+	callbacks := xdsServer.tracker
+
+	// push simulates the server pushing the given version of the listeners on a
+	// stream of the gateways sharing testNodeID.
+	push := func(streamID int64, nonce, version string) {
+		t.Helper()
+		assert.NilError(t, callbacks.OnStreamRequest(streamID, &discovery.DiscoveryRequest{
+			Node:    &core.Node{Id: testNodeID},
+			TypeUrl: resource.ListenerType,
+		}))
+		callbacks.OnStreamResponse(context.Background(), streamID, nil, &discovery.DiscoveryResponse{
+			TypeUrl:     resource.ListenerType,
+			Nonce:       nonce,
+			VersionInfo: version,
+		})
+	}
+	// respond simulates the gateway of the stream answering with an ACK, or a NACK
+	// if errorDetail is set.
+	respond := func(streamID int64, nonce string, errorDetail *rpcstatus.Status) {
+		t.Helper()
+		assert.NilError(t, callbacks.OnStreamRequest(streamID, &discovery.DiscoveryRequest{
+			TypeUrl:       resource.ListenerType,
+			ResponseNonce: nonce,
+			ErrorDetail:   errorDetail,
+		}))
+	}
+	waitFor := func(versions chan string, want string) {
+		t.Helper()
+		select {
+		case got := <-versions:
+			assert.Equal(t, got, want)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for version %q", want)
+		}
+	}
+
+	// A version is only accepted once all streams of the node accepted it.
+	setListeners(t, xdsServer, "1")
+	push(1, "a", "1")
+	push(2, "b", "1")
+	respond(1, "a", nil)
+	_, ok := xdsServer.LastAcceptedVersion(testNodeID)
+	assert.Assert(t, !ok)
+	respond(2, "b", nil)
+	waitFor(accepted, "1")
+
+	// Stream 1 rejecting version 2 rolls the node back, even though stream 2 would
+	// have accepted it.
+	setListeners(t, xdsServer, "2")
+	push(1, "c", "2")
+	push(2, "d", "2")
+	respond(1, "c", &rpcstatus.Status{Message: "bad listener"})
+	waitFor(rollbacks, "2")
+
+	// The ACK of stream 2 arriving after the rollback doesn't make version 2 good.
+	respond(2, "d", nil)
+	version, _ := xdsServer.LastAcceptedVersion(testNodeID)
+	assert.Equal(t, version, "1")
+	status := xdsServer.NodeStatuses()[testNodeID]
+	assert.Equal(t, status.LastAcceptedVersion, "1")
+	assert.DeepEqual(t, status.Acked, map[string]string{})
+
+	// Once the rolled back config is served again, the streams agree again.
+	push(1, "e", "1")
+	push(2, "f", "1")
+	respond(1, "e", nil)
+	respond(2, "f", nil)
+	assert.DeepEqual(t, xdsServer.NodeStatuses()[testNodeID].Acked, map[string]string{resource.ListenerType: "1"})
+
+	// A stream that closes without accepting a version doesn't hold it back.
+	setListeners(t, xdsServer, "3")
+	push(1, "g", "3")
+	push(2, "h", "3")
+	respond(1, "g", nil)
+	callbacks.OnStreamClosed(2, &core.Node{Id: testNodeID})
+	waitFor(accepted, "3")
+	assert.Equal(t, len(accepted), 0)
+	assert.Equal(t, len(rollbacks), 0)
+}
+
+func TestDeltaRollbackToLastAcceptedSnapshot(t *testing.T) {
+	rollbacks := make(chan string, 1)
+	accepted := make(chan string, 3)
+	xdsServer := NewXdsServer(18000, &xds.CallbackFuncs{},
+		WithRollbackFunc(func(_, version string, _ *rpcstatus.Status) {
+			rollbacks <- version
+		}),
+		WithAcceptFunc(func(_, version string) {
+			accepted <- version
+		}))
+	callbacks := xdsServer.tracker
+	const streamID = 1
+
+	// respond simulates the server pushing the changed resources of a type in the
+	// given version and the gateway answering with an ACK, or a NACK if
+	// errorDetail is set.
+	respond := func(typeURL, nonce, version string, errorDetail *rpcstatus.Status) {
+		t.Helper()
+		assert.NilError(t, callbacks.OnStreamDeltaRequest(streamID, &discovery.DeltaDiscoveryRequest{
+			Node:    &core.Node{Id: testNodeID},
+			TypeUrl: typeURL,
+		}))
+		callbacks.OnStreamDeltaResponse(streamID, nil, &discovery.DeltaDiscoveryResponse{
+			TypeUrl:           typeURL,
+			Nonce:             nonce,
+			SystemVersionInfo: version,
+		})
+		assert.NilError(t, callbacks.OnStreamDeltaRequest(streamID, &discovery.DeltaDiscoveryRequest{
+			TypeUrl:       typeURL,
+			ResponseNonce: nonce,
+			ErrorDetail:   errorDetail,
+		}))
+	}
+	waitFor := func(versions chan string, want string) {
+		t.Helper()
+		select {
+		case got := <-versions:
+			assert.Equal(t, got, want)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for version %q", want)
+		}
+	}
+
+	setListeners(t, xdsServer, "1")
+	respond(resource.ClusterType, "a", "1", nil)
+	respond(resource.ListenerType, "b", "1", nil)
+	waitFor(accepted, "1")
+
+	// Version 2 only changes the listeners, so the clusters are not sent again.
+	setSnapshot(t, xdsServer, "2", "listener-2", "cluster-1")
+	respond(resource.ListenerType, "c", "2", nil)
+	waitFor(accepted, "2")
+	version, _ := xdsServer.LastAcceptedVersion(testNodeID)
+	assert.Equal(t, version, "2")
+
+	// Rejecting version 3 rolls back to version 2 rather than to version 1.
+	setSnapshot(t, xdsServer, "3", "listener-3", "cluster-1")
+	respond(resource.ListenerType, "d", "3", &rpcstatus.Status{Message: "bad listener"})
+	waitFor(rollbacks, "3")
+	snapshot, err := xdsServer.snapshotCache.GetSnapshot(testNodeID)
+	assert.NilError(t, err)
+	assert.Equal(t, snapshot.GetVersion(resource.ListenerType), "2")
+	assert.Equal(t, len(accepted), 0)
+}
+
+// setListeners serves a snapshot whose resources differ per version.
+func setListeners(t *testing.T, xdsServer *XdsServer, version string) {
+	t.Helper()
+
+	setSnapshot(t, xdsServer, version, "listener-"+version, "cluster-"+version)
+}
+
+// setSnapshot serves a snapshot with a listener and a cluster that have the given
+// stat prefixes.
+func setSnapshot(t *testing.T, xdsServer *XdsServer, version, listenerStats, clusterStats string) {
+	t.Helper()
+
+	snapshot, err := cache.NewSnapshot(version, map[resource.Type][]types.Resource{
+		resource.ListenerType: {&listener.Listener{Name: "listener", StatPrefix: listenerStats}},
+		resource.ClusterType:  {&v3Cluster.Cluster{Name: "cluster", AltStatName: clusterStats}},
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, xdsServer.SetSnapshot(testNodeID, snapshot))
+}
+
+func testCluster(name string, connectTimeout time.Duration) types.Resource {
+	return &v3Cluster.Cluster{
+		Name:           name,
+		ConnectTimeout: durationpb.New(connectTimeout),
+	}
+}
+
+func setClusters(t *testing.T, xdsServer *XdsServer, version string, clusters ...types.Resource) {
+	t.Helper()
+
+	snapshot, err := cache.NewSnapshot(version, map[resource.Type][]types.Resource{
+		resource.ClusterType: clusters,
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, xdsServer.SetSnapshot(testNodeID, snapshot))
+}
+
+func deltaWatch(t *testing.T, xdsServer *XdsServer, versions map[string]string) cache.DeltaResponse {
+	t.Helper()
+
+	state := stream.NewStreamState(true, versions)
+	responses := make(chan cache.DeltaResponse, 1)
+	cancel := xdsServer.snapshotCache.CreateDeltaWatch(&cache.DeltaRequest{
+		Node:    &core.Node{Id: testNodeID},
+		TypeUrl: resource.ClusterType,
+	}, state, responses)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	select {
+	case resp := <-responses:
+		return resp
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for delta response")
+		return nil
+	}
+}
+
+func resourceNames(t *testing.T, resp cache.DeltaResponse) []string {
+	t.Helper()
+
+	out, err := resp.GetDeltaDiscoveryResponse()
+	assert.NilError(t, err)
+
+	var names []string
+	for _, r := range out.GetResources() {
+		names = append(names, r.GetName())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -18,8 +18,13 @@ package generator
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	envoyclusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -27,10 +32,11 @@ import (
 	v3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	httpconnmanagerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	cachetypes "github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
-	"github.com/google/uuid"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -56,34 +62,56 @@ type Caches struct {
 	translatedIngresses map[types.NamespacedName]*translatedIngress
 	clusters            *ClustersCache
 	domainsInUse        sets.Set[string]
-	statusVirtualHost   *route.VirtualHost
+	// nodeIDs are the node IDs of all fleets of gateways that have been configured.
+	// Fleets are never forgotten, so that they get an empty config when their last
+	// ingress is gone.
+	nodeIDs           sets.Set[string]
+	statusVirtualHost *route.VirtualHost
 
 	kubeClient kubeclient.Interface
+	// endpointSlicesGetter returns the EndpointSlices of the given service.
+	endpointSlicesGetter func(ns, serviceName string) ([]*discoveryv1.EndpointSlice, error)
+	metrics              *metrics
 }
 
-func NewCaches(ctx context.Context, kubernetesClient kubeclient.Interface) (*Caches, error) {
+// NewCaches creates new caches. The endpointSlicesGetter is expected to return all
+// the EndpointSlices belonging to the given service, it finds the gateways of the
+// local cluster of zone aware routing.
+func NewCaches(
+	ctx context.Context,
+	kubernetesClient kubeclient.Interface,
+	endpointSlicesGetter func(ns, serviceName string) ([]*discoveryv1.EndpointSlice, error),
+) (*Caches, error) {
 	c := &Caches{
-		translatedIngresses: make(map[types.NamespacedName]*translatedIngress),
-		clusters:            newClustersCache(),
-		domainsInUse:        sets.New[string](),
-		statusVirtualHost:   statusVHost(),
-		kubeClient:          kubernetesClient,
+		translatedIngresses:  make(map[types.NamespacedName]*translatedIngress),
+		clusters:             newClustersCache(),
+		domainsInUse:         sets.New[string](),
+		nodeIDs:              sets.New(config.DefaultGatewayNodeID),
+		statusVirtualHost:    statusVHost(),
+		kubeClient:           kubernetesClient,
+		endpointSlicesGetter: endpointSlicesGetter,
+		metrics:              newMetrics(nil),
 	}
 
 	if config.FromContext(ctx).Kourier.ExternalAuthz.Enabled {
-		c.clusters.set(config.FromContext(ctx).Kourier.ExternalAuthz.Cluster(), "__extAuthZCluster", "_internal")
+		// The external authorization cluster is used by all fleets of gateways.
+		c.clusters.set(config.FromContext(ctx).Kourier.ExternalAuthz.Cluster(), "", "__extAuthZCluster", "_internal")
 	}
 	return c, nil
 }
 
-func (caches *Caches) UpdateIngress(_ context.Context, ingressTranslation *translatedIngress) error {
+func (caches *Caches) UpdateIngress(ctx context.Context, ingressTranslation *translatedIngress) error {
 	// we hold a lock for Updating the ingress, to avoid another worker to generate an snapshot just when we have
 	// deleted the ingress before adding it.
 	caches.mu.Lock()
 	defer caches.mu.Unlock()
 
 	caches.deleteTranslatedIngress(ingressTranslation.name.Name, ingressTranslation.name.Namespace)
-	return caches.addTranslatedIngress(ingressTranslation)
+	err := caches.addTranslatedIngress(ingressTranslation)
+	if errors.Is(err, ErrDomainConflict) {
+		caches.metrics.domainConflicts.Add(ctx, 1)
+	}
+	return err
 }
 
 func (caches *Caches) validateIngress(translatedIngress *translatedIngress) error {
@@ -106,9 +134,10 @@ func (caches *Caches) addTranslatedIngress(translatedIngress *translatedIngress)
 	}
 
 	caches.translatedIngresses[translatedIngress.name] = translatedIngress
+	caches.nodeIDs.Insert(translatedIngress.nodeID)
 
 	for _, cluster := range translatedIngress.clusters {
-		caches.clusters.set(cluster, translatedIngress.name.Name, translatedIngress.name.Namespace)
+		caches.clusters.set(cluster, translatedIngress.nodeID, translatedIngress.name.Name, translatedIngress.name.Namespace)
 	}
 
 	return nil
@@ -125,10 +154,47 @@ func (caches *Caches) SetOnEvicted(f func(types.NamespacedName, interface{})) {
 	})
 }
 
+// ToEnvoySnapshots generates a snapshot for each fleet of gateways, keyed by the
+// node ID of the fleet. Each snapshot only contains the config of the ingresses
+// assigned to that fleet.
+func (caches *Caches) ToEnvoySnapshots(ctx context.Context) (map[string]*cache.Snapshot, error) {
+	caches.mu.Lock()
+	defer caches.mu.Unlock()
+
+	snapshots := make(map[string]*cache.Snapshot, caches.nodeIDs.Len())
+	for _, nodeID := range sets.List(caches.nodeIDs) {
+		snapshot, err := caches.toEnvoySnapshot(ctx, nodeID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate snapshot for gateway %q: %w", nodeID, err)
+		}
+		snapshots[nodeID] = snapshot
+	}
+	return snapshots, nil
+}
+
+// ToEnvoySnapshot generates the snapshot of the default fleet of gateways.
 func (caches *Caches) ToEnvoySnapshot(ctx context.Context) (*cache.Snapshot, error) {
 	caches.mu.Lock()
 	defer caches.mu.Unlock()
 
+	return caches.toEnvoySnapshot(ctx, config.DefaultGatewayNodeID)
+}
+
+// ToEnvoySnapshotForNode generates the snapshot of the given fleet of gateways,
+// nil if no ingress was ever assigned to it.
+func (caches *Caches) ToEnvoySnapshotForNode(ctx context.Context, nodeID string) (*cache.Snapshot, error) {
+	caches.mu.Lock()
+	defer caches.mu.Unlock()
+
+	if !caches.nodeIDs.Has(nodeID) {
+		return nil, nil
+	}
+	return caches.toEnvoySnapshot(ctx, nodeID)
+}
+
+func (caches *Caches) toEnvoySnapshot(ctx context.Context, nodeID string) (*cache.Snapshot, error) {
+	start := time.Now()
+
 	localVHosts := make([]*route.VirtualHost, 0, len(caches.translatedIngresses)+1)
 	localTLSVHosts := make([]*route.VirtualHost, 0, len(caches.translatedIngresses)+1)
 	externalVHosts := make([]*route.VirtualHost, 0, len(caches.translatedIngresses))
@@ -136,7 +202,20 @@ func (caches *Caches) ToEnvoySnapshot(ctx context.Context) (*cache.Snapshot, err
 	localSNIs := sniMatches{}
 	externalSNIs := sniMatches{}
 
-	for _, translatedIngress := range caches.translatedIngresses {
+	// Walk the ingresses in a stable order so that the same set of ingresses always
+	// yields the same resources and thus the same snapshot version.
+	names := make([]types.NamespacedName, 0, len(caches.translatedIngresses))
+	for name, translatedIngress := range caches.translatedIngresses {
+		if translatedIngress.nodeID == nodeID {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].String() < names[j].String()
+	})
+
+	for _, name := range names {
+		translatedIngress := caches.translatedIngresses[name]
 		localVHosts = append(localVHosts, translatedIngress.localVirtualHosts...)
 		localTLSVHosts = append(localTLSVHosts, translatedIngress.localTLSVirtualHosts...)
 		externalVHosts = append(externalVHosts, translatedIngress.externalVirtualHosts...)
@@ -153,7 +232,7 @@ func (caches *Caches) ToEnvoySnapshot(ctx context.Context) (*cache.Snapshot, err
 	// Append the statusHost too.
 	localVHosts = append(localVHosts, caches.statusVirtualHost)
 
-	listeners, routes, clusters, err := generateListenersAndRouteConfigsAndClusters(
+	listeners, routes, clusters, secrets, err := generateListenersAndRouteConfigsAndClustersAndSecrets(
 		ctx,
 		externalVHosts,
 		externalTLSVHosts,
@@ -167,16 +246,91 @@ func (caches *Caches) ToEnvoySnapshot(ctx context.Context) (*cache.Snapshot, err
 		return nil, err
 	}
 
-	clusters = append(caches.clusters.list(), clusters...)
+	clusters = append(caches.clusters.list(nodeID), clusters...)
 
-	return cache.NewSnapshot(
-		uuid.NewString(),
-		map[resource.Type][]cachetypes.Resource{
-			resource.ClusterType:  clusters,
-			resource.RouteType:    routes,
-			resource.ListenerType: listeners,
-		},
-	)
+	// Serve the endpoints of all clusters through EDS, so that changing endpoints
+	// don't change the clusters themselves, which would drain their connection pools.
+	endpoints := make([]cachetypes.Resource, 0, len(clusters))
+	for i, c := range clusters {
+		edsCluster, loadAssignment := envoy.NewEDSCluster(c.(*envoyclusterv3.Cluster))
+		clusters[i] = edsCluster
+		if loadAssignment != nil {
+			endpoints = append(endpoints, loadAssignment)
+		}
+	}
+
+	// Zone aware routing compares the zones of the endpoints of a cluster to the
+	// zones of the gateways themselves, which are the endpoints of the local cluster.
+	if cfg := config.FromContextOrDefaults(ctx).Kourier; cfg.LocalityLBPolicy == config.LocalityLBPolicyZoneAware {
+		localCluster, err := caches.localClusterLoadAssignment(nodeID, cfg)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, localCluster)
+	}
+
+	resources := map[resource.Type][]cachetypes.Resource{
+		resource.ClusterType:  clusters,
+		resource.EndpointType: endpoints,
+		resource.RouteType:    routes,
+		resource.ListenerType: listeners,
+		resource.SecretType:   secrets,
+	}
+	version, err := snapshotVersion(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := cache.NewSnapshot(version, resources)
+	if err != nil {
+		return nil, err
+	}
+	caches.metrics.recordSnapshot(ctx, nodeID, time.Since(start), len(names), resources)
+	return snapshot, nil
+}
+
+// localClusterLoadAssignment returns the endpoints of the local cluster of the
+// given fleet of gateways: the gateways themselves, grouped by zone.
+func (caches *Caches) localClusterLoadAssignment(nodeID string, cfg *config.Kourier) (*endpoint.ClusterLoadAssignment, error) {
+	_, internalServiceName := config.ServiceNames(nodeID)
+	gatewaySlices, err := caches.endpointSlicesGetter(config.GatewayNamespace(), internalServiceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the endpoints of the gateways: %w", err)
+	}
+
+	addressType := discoveryv1.AddressTypeIPv4
+	if cfg.ListenerIPFamily == config.ListenerIPFamilyIPv6 {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+	return &endpoint.ClusterLoadAssignment{
+		ClusterName: cfg.LocalityLBLocalCluster,
+		Endpoints:   localityLbEndpointsForEndpointSlices(gatewaySlices, addressType, config.InternalServiceHTTPPortName, int32(config.HTTPPortLocal)),
+	}, nil
+}
+
+// snapshotVersion derives a version from the content of the given resources, so
+// that regenerating an unchanged config yields the same version and gateways
+// aren't pushed an identical config again. The per-resource versions used by
+// the delta protocol are computed by the snapshot cache in the same fashion.
+func snapshotVersion(resources map[resource.Type][]cachetypes.Resource) (string, error) {
+	typeURLs := make([]resource.Type, 0, len(resources))
+	for typeURL := range resources {
+		typeURLs = append(typeURLs, typeURL)
+	}
+	sort.Strings(typeURLs)
+
+	hasher := sha256.New()
+	for _, typeURL := range typeURLs {
+		hasher.Write([]byte(typeURL))
+		for _, r := range resources[typeURL] {
+			marshaled, err := cache.MarshalResource(r)
+			if err != nil {
+				return "", fmt.Errorf("failed to marshal resource %q: %w", cache.GetResourceName(r), err)
+			}
+			hasher.Write([]byte(cache.HashResource(marshaled)))
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
 // DeleteIngressInfo removes an ingress from the caches.
@@ -211,7 +365,7 @@ func (caches *Caches) deleteTranslatedIngress(ingressName, ingressNamespace stri
 	}
 }
 
-func generateListenersAndRouteConfigsAndClusters(
+func generateListenersAndRouteConfigsAndClustersAndSecrets(
 	ctx context.Context,
 	externalVirtualHosts []*route.VirtualHost,
 	externalTLSVirtualHosts []*route.VirtualHost,
@@ -220,7 +374,7 @@ func generateListenersAndRouteConfigsAndClusters(
 	localSNIMatches []*envoy.SNIMatch,
 	externalSNIMatches []*envoy.SNIMatch,
 	kubeclient kubeclient.Interface,
-) ([]cachetypes.Resource, []cachetypes.Resource, []cachetypes.Resource, error) {
+) ([]cachetypes.Resource, []cachetypes.Resource, []cachetypes.Resource, []cachetypes.Resource, error) {
 	// This has to be "OrDefaults" because this path is called before the informers are
 	// running when booting the controller up and prefilling the config before making it
 	// ready.
@@ -236,23 +390,28 @@ func generateListenersAndRouteConfigsAndClusters(
 	externalTLSManager := envoy.NewHTTPConnectionManager(externalTLSRouteConfig.GetName(), cfg.Kourier)
 	localManager := envoy.NewHTTPConnectionManager(localRouteConfig.GetName(), cfg.Kourier)
 
-	externalHTTPEnvoyListener, err := envoy.NewHTTPListener(externalManager, config.HTTPPortExternal, cfg.Kourier.EnableProxyProtocol)
+	// All listeners bind to the addresses of the configured IP family.
+	ipFamily := envoy.WithIPFamily(cfg.Kourier.ListenerIPFamily)
+
+	externalHTTPEnvoyListener, err := envoy.NewHTTPListener(externalManager, config.HTTPPortExternal, cfg.Kourier.EnableProxyProtocol, ipFamily)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
-	localEnvoyListener, err := envoy.NewHTTPListener(localManager, config.HTTPPortLocal, false)
+	localEnvoyListener, err := envoy.NewHTTPListener(localManager, config.HTTPPortLocal, false, ipFamily)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	listeners := []cachetypes.Resource{externalHTTPEnvoyListener, localEnvoyListener}
 	routes := []cachetypes.Resource{externalRouteConfig, localRouteConfig}
 	clusters := make([]cachetypes.Resource, 0, 1)
+	// The certificates referenced by the TLS listeners are served through SDS.
+	secrets := make([]cachetypes.Resource, 0, len(localSNIMatches)+len(externalSNIMatches))
 
 	// create probe listeners
-	probHTTPListener, err := envoy.NewHTTPListener(externalManager, config.HTTPPortProb, false)
+	probHTTPListener, err := envoy.NewHTTPListener(externalManager, config.HTTPPortProb, false, ipFamily)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 	listeners = append(listeners, probHTTPListener)
 
@@ -260,15 +419,21 @@ func generateListenersAndRouteConfigsAndClusters(
 	// If there's at least one ingress that contains the TLS field, that takes precedence.
 	// If there is not, TLS will be configured using a single cert for all the services when the certificate is configured.
 	if len(localSNIMatches) > 0 {
+		sniSecrets, err := newSecretsForSNIMatches(localSNIMatches)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		secrets = append(secrets, sniSecrets...)
+
 		localTLSRouteConfig := envoy.NewRouteConfig(localTLSRouteConfigName, localTLSVirtualHosts)
 		localTLSManager := envoy.NewHTTPConnectionManager(localTLSRouteConfig.GetName(), cfg.Kourier)
 
 		localHTTPSEnvoyListener, err := envoy.NewHTTPSListenerWithSNI(
 			localTLSManager, config.HTTPSPortLocal,
-			localSNIMatches, cfg.Kourier,
+			localSNIMatches, cfg.Kourier, ipFamily,
 		)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 
 		probeConfig := cfg.Kourier
@@ -277,20 +442,21 @@ func generateListenersAndRouteConfigsAndClusters(
 		// create https prob listener with SNI
 		probHTTPSListener, err := envoy.NewHTTPSListenerWithSNI(
 			localManager, config.HTTPSPortProb,
-			localSNIMatches, probeConfig,
+			localSNIMatches, probeConfig, ipFamily,
 		)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 
 		// if a single certificate is additionally configured, add a new filter chain to TLS listener
 		if cfg.Kourier.ClusterCertSecret != "" {
-			localHTTPSEnvoyListenerWithOneCertFilterChain, err := newLocalEnvoyListenerWithOneCertFilterChain(
+			localHTTPSEnvoyListenerWithOneCertFilterChain, secret, err := newLocalEnvoyListenerWithOneCertFilterChain(
 				ctx, localTLSManager, kubeclient, cfg.Kourier,
 			)
 			if err != nil {
-				return nil, nil, nil, err
+				return nil, nil, nil, nil, err
 			}
+			secrets = append(secrets, secret)
 
 			localHTTPSEnvoyListener.FilterChains = append(localHTTPSEnvoyListener.FilterChains,
 				localHTTPSEnvoyListenerWithOneCertFilterChain)
@@ -304,13 +470,14 @@ func generateListenersAndRouteConfigsAndClusters(
 		localTLSRouteConfig := envoy.NewRouteConfig(localTLSRouteConfigName, localVirtualHosts)
 		localTLSManager := envoy.NewHTTPConnectionManager(localTLSRouteConfig.GetName(), cfg.Kourier)
 
-		localHTTPSEnvoyListener, err := newLocalEnvoyListenerWithOneCert(
+		localHTTPSEnvoyListener, secret, err := newLocalEnvoyListenerWithOneCert(
 			ctx, localTLSManager, kubeclient,
 			cfg.Kourier,
 		)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
+		secrets = append(secrets, secret)
 
 		listeners = append(listeners, localHTTPSEnvoyListener)
 		routes = append(routes, localTLSRouteConfig)
@@ -320,12 +487,18 @@ func generateListenersAndRouteConfigsAndClusters(
 	// TLS field, that takes precedence. If there is not, TLS will be configured
 	// using a single cert for all the services if the creds are given via ENV.
 	if len(externalSNIMatches) > 0 {
+		sniSecrets, err := newSecretsForSNIMatches(externalSNIMatches)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		secrets = append(secrets, sniSecrets...)
+
 		externalHTTPSEnvoyListener, err := envoy.NewHTTPSListenerWithSNI(
 			externalTLSManager, config.HTTPSPortExternal,
-			externalSNIMatches, cfg.Kourier,
+			externalSNIMatches, cfg.Kourier, ipFamily,
 		)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 
 		probeConfig := cfg.Kourier
@@ -334,20 +507,21 @@ func generateListenersAndRouteConfigsAndClusters(
 		// create https prob listener with SNI
 		probHTTPSListener, err := envoy.NewHTTPSListenerWithSNI(
 			externalManager, config.HTTPSPortProb,
-			externalSNIMatches, probeConfig,
+			externalSNIMatches, probeConfig, ipFamily,
 		)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 
 		// if a single certificate is additionally configured, add a new filter chain to TLS listener
 		if cfg.Kourier.UseHTTPSListenerWithOneCert() {
-			externalHTTPSEnvoyListenerWithOneCertFilterChain, err := newExternalEnvoyListenerWithOneCertFilterChain(
+			externalHTTPSEnvoyListenerWithOneCertFilterChain, secret, err := newExternalEnvoyListenerWithOneCertFilterChain(
 				ctx, externalTLSManager, kubeclient, cfg.Kourier,
 			)
 			if err != nil {
-				return nil, nil, nil, err
+				return nil, nil, nil, nil, err
 			}
+			secrets = append(secrets, secret)
 
 			externalHTTPSEnvoyListener.FilterChains = append(externalHTTPSEnvoyListener.FilterChains,
 				externalHTTPSEnvoyListenerWithOneCertFilterChain)
@@ -358,18 +532,19 @@ func generateListenersAndRouteConfigsAndClusters(
 		listeners = append(listeners, externalHTTPSEnvoyListener, probHTTPSListener)
 		routes = append(routes, externalTLSRouteConfig)
 	} else if cfg.Kourier.UseHTTPSListenerWithOneCert() {
-		externalHTTPSEnvoyListener, err := newExternalEnvoyListenerWithOneCert(
+		externalHTTPSEnvoyListener, secret, err := newExternalEnvoyListenerWithOneCert(
 			ctx, externalTLSManager, kubeclient,
 			cfg.Kourier,
 		)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
+		secrets = append(secrets, secret)
 
 		// create https prob listener
-		probHTTPSListener, err := envoy.NewHTTPSListener(config.HTTPSPortProb, externalHTTPSEnvoyListener.GetFilterChains(), false)
+		probHTTPSListener, err := envoy.NewHTTPSListener(config.HTTPSPortProb, externalHTTPSEnvoyListener.GetFilterChains(), false, ipFamily)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 
 		listeners = append(listeners, externalHTTPSEnvoyListener, probHTTPSListener)
@@ -408,7 +583,7 @@ func generateListenersAndRouteConfigsAndClusters(
 		clusters = append(clusters, jaegerCluster)
 	}
 
-	return listeners, routes, clusters, nil
+	return listeners, routes, clusters, secrets, nil
 }
 
 func sslCreds(ctx context.Context, kubeClient kubeclient.Interface, secretNamespace string, secretName string) (certificateChain []byte, privateKey []byte, err error) {
@@ -420,50 +595,78 @@ func sslCreds(ctx context.Context, kubeClient kubeclient.Interface, secretNamesp
 	return secret.Data[certificates.CertName], secret.Data[certificates.PrivateKeyName], nil
 }
 
-func newExternalEnvoyListenerWithOneCertFilterChain(ctx context.Context, manager *httpconnmanagerv3.HttpConnectionManager, kubeClient kubeclient.Interface, cfg *config.Kourier) (*v3.FilterChain, error) {
-	certificateChain, privateKey, err := sslCreds(
-		ctx, kubeClient, cfg.CertsSecretNamespace, cfg.CertsSecretName,
-	)
+func newExternalEnvoyListenerWithOneCertFilterChain(ctx context.Context, manager *httpconnmanagerv3.HttpConnectionManager, kubeClient kubeclient.Interface, cfg *config.Kourier) (*v3.FilterChain, *tlsv3.Secret, error) {
+	return newFilterChainWithOneCert(ctx, manager, kubeClient, cfg, types.NamespacedName{
+		Namespace: cfg.CertsSecretNamespace,
+		Name:      cfg.CertsSecretName,
+	})
+}
+
+func newExternalEnvoyListenerWithOneCert(ctx context.Context, manager *httpconnmanagerv3.HttpConnectionManager, kubeClient kubeclient.Interface, cfg *config.Kourier) (*v3.Listener, *tlsv3.Secret, error) {
+	filterChain, secret, err := newExternalEnvoyListenerWithOneCertFilterChain(ctx, manager, kubeClient, cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return envoy.CreateFilterChainFromCertificateAndPrivateKey(manager, &envoy.Certificate{
-		Certificate:        certificateChain,
-		PrivateKey:         privateKey,
-		PrivateKeyProvider: privateKeyProvider(cfg.EnableCryptoMB),
-		CipherSuites:       sets.List(cfg.CipherSuites),
+	listener, err := envoy.NewHTTPSListener(config.HTTPSPortExternal, []*v3.FilterChain{filterChain}, cfg.EnableProxyProtocol, envoy.WithIPFamily(cfg.ListenerIPFamily))
+	return listener, secret, err
+}
+
+func newLocalEnvoyListenerWithOneCertFilterChain(ctx context.Context, manager *httpconnmanagerv3.HttpConnectionManager, kubeClient kubeclient.Interface, cfg *config.Kourier) (*v3.FilterChain, *tlsv3.Secret, error) {
+	return newFilterChainWithOneCert(ctx, manager, kubeClient, cfg, types.NamespacedName{
+		Namespace: system.Namespace(),
+		Name:      cfg.ClusterCertSecret,
 	})
 }
 
-func newExternalEnvoyListenerWithOneCert(ctx context.Context, manager *httpconnmanagerv3.HttpConnectionManager, kubeClient kubeclient.Interface, cfg *config.Kourier) (*v3.Listener, error) {
-	filterChain, err := newExternalEnvoyListenerWithOneCertFilterChain(ctx, manager, kubeClient, cfg)
+func newLocalEnvoyListenerWithOneCert(ctx context.Context, manager *httpconnmanagerv3.HttpConnectionManager, kubeClient kubeclient.Interface, cfg *config.Kourier) (*v3.Listener, *tlsv3.Secret, error) {
+	filterChain, secret, err := newLocalEnvoyListenerWithOneCertFilterChain(ctx, manager, kubeClient, cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return envoy.NewHTTPSListener(config.HTTPSPortExternal, []*v3.FilterChain{filterChain}, cfg.EnableProxyProtocol)
+	listener, err := envoy.NewHTTPSListener(config.HTTPSPortLocal, []*v3.FilterChain{filterChain}, cfg.EnableProxyProtocol, envoy.WithIPFamily(cfg.ListenerIPFamily))
+	return listener, secret, err
 }
 
-func newLocalEnvoyListenerWithOneCertFilterChain(ctx context.Context, manager *httpconnmanagerv3.HttpConnectionManager, kubeClient kubeclient.Interface, cfg *config.Kourier) (*v3.FilterChain, error) {
-	certificateChain, privateKey, err := sslCreds(ctx, kubeClient, system.Namespace(), cfg.ClusterCertSecret)
+// newFilterChainWithOneCert creates a filter chain serving the certificate of the
+// given secret for all hosts, along with the SDS Secret the filter chain refers to.
+func newFilterChainWithOneCert(ctx context.Context, manager *httpconnmanagerv3.HttpConnectionManager, kubeClient kubeclient.Interface, cfg *config.Kourier, source types.NamespacedName) (*v3.FilterChain, *tlsv3.Secret, error) {
+	certificateChain, privateKey, err := sslCreds(ctx, kubeClient, source.Namespace, source.Name)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return envoy.CreateFilterChainFromCertificateAndPrivateKey(manager, &envoy.Certificate{
+
+	provider := privateKeyProvider(cfg.EnableCryptoMB)
+	cert := &envoy.Certificate{
+		Name:               envoy.SecretName(source, provider),
 		Certificate:        certificateChain,
 		PrivateKey:         privateKey,
-		PrivateKeyProvider: privateKeyProvider(cfg.EnableCryptoMB),
+		PrivateKeyProvider: provider,
 		CipherSuites:       sets.List(cfg.CipherSuites),
-	})
-}
+	}
 
-func newLocalEnvoyListenerWithOneCert(ctx context.Context, manager *httpconnmanagerv3.HttpConnectionManager, kubeClient kubeclient.Interface, cfg *config.Kourier) (*v3.Listener, error) {
-	filterChain, err := newLocalEnvoyListenerWithOneCertFilterChain(ctx, manager, kubeClient, cfg)
+	secret, err := cert.NewSecret()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	filterChain, err := envoy.CreateFilterChainFromCertificateAndPrivateKey(manager, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	return filterChain, secret, nil
+}
+
+func newSecretsForSNIMatches(sniMatches []*envoy.SNIMatch) ([]cachetypes.Resource, error) {
+	secrets := make([]cachetypes.Resource, 0, len(sniMatches))
+	for _, match := range sniMatches {
+		secret, err := match.NewSecret()
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
 	}
-	return envoy.NewHTTPSListener(config.HTTPSPortLocal, []*v3.FilterChain{filterChain}, cfg.EnableProxyProtocol)
+	return secrets, nil
 }
 
 func privateKeyProvider(mbEnabled bool) string {
@@ -20,6 +20,7 @@ import (
 	"context"
 	"sort"
 	"testing"
+	"time"
 
 	v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -28,7 +29,10 @@ import (
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	tracev3 "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
 	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	stream "github.com/envoyproxy/go-control-plane/pkg/server/stream/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/protobuf/proto"
@@ -37,11 +41,14 @@ import (
 	"google.golang.org/protobuf/types/known/wrapperspb"
 	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
 	envoy "knative.dev/net-kourier/pkg/envoy/api"
 	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
 	"knative.dev/networking/pkg/certificates"
 	netconfig "knative.dev/networking/pkg/config"
 )
@@ -51,7 +58,7 @@ func TestDeleteIngressInfo(t *testing.T) {
 
 	ctx := config.ToContext(context.Background(), config.FromContextOrDefaults(context.Background()))
 
-	caches, err := NewCaches(ctx, &kubeClient)
+	caches, err := NewCaches(ctx, &kubeClient, nil)
 	assert.NilError(t, err)
 
 	// Add info for an ingress
@@ -117,7 +124,7 @@ func TestDeleteIngressInfoWhenDoesNotExist(t *testing.T) {
 	kubeClient := fake.Clientset{}
 	ctx := config.ToContext(context.Background(), config.FromContextOrDefaults(context.Background()))
 
-	caches, err := NewCaches(ctx, &kubeClient)
+	caches, err := NewCaches(ctx, &kubeClient, nil)
 	assert.NilError(t, err)
 
 	// Add info for an ingress
@@ -182,6 +189,7 @@ func runExternalTLSListenerTests(t *testing.T, ctx context.Context, caches *Cach
 
 	t.Run("without SNI matches", func(t *testing.T) {
 		translatedIngress := &translatedIngress{
+			nodeID:             config.DefaultGatewayNodeID,
 			externalSNIMatches: nil,
 		}
 		err := caches.addTranslatedIngress(translatedIngress)
@@ -197,6 +205,7 @@ func runExternalTLSListenerTests(t *testing.T, ctx context.Context, caches *Cach
 
 	t.Run("with a single SNI match", func(t *testing.T) {
 		translatedIngress := &translatedIngress{
+			nodeID:             config.DefaultGatewayNodeID,
 			externalSNIMatches: []*envoy.SNIMatch{fooSNIMatch},
 		}
 		err := caches.addTranslatedIngress(translatedIngress)
@@ -224,6 +233,7 @@ func runExternalTLSListenerTests(t *testing.T, ctx context.Context, caches *Cach
 
 	t.Run("with multiple SNI matches", func(t *testing.T) {
 		translatedIngress := &translatedIngress{
+			nodeID:             config.DefaultGatewayNodeID,
 			externalSNIMatches: []*envoy.SNIMatch{fooSNIMatch, barSNIMatch},
 		}
 		err := caches.addTranslatedIngress(translatedIngress)
@@ -248,6 +258,13 @@ func runExternalTLSListenerTests(t *testing.T, ctx context.Context, caches *Cach
 		assert.Check(t, filterChainsByServerName["foo.example.com"] != nil)
 		assert.Check(t, filterChainsByServerName["bar.example.com"] != nil)
 		assert.Check(t, filterChainsByServerName[""] != nil) // filter chain without server name, "default" one
+
+		// The certificates are served through SDS rather than inlined into the listener.
+		secrets := snapshot.GetResources(resource.SecretType)
+		assert.Check(t, len(secrets) == 3)
+		assert.Check(t, secrets["secretns/secretname1"] != nil)
+		assert.Check(t, secrets["secretns/secretname2"] != nil)
+		assert.Check(t, secrets["certns/secretname"] != nil) // the single certificate of the "default" filter chain
 	})
 }
 
@@ -259,7 +276,7 @@ func TestExternalTLSListener(t *testing.T) {
 
 		kubeClient := fake.Clientset{}
 		ctx := config.ToContext(context.Background(), c)
-		caches, err := NewCaches(ctx, &kubeClient)
+		caches, err := NewCaches(ctx, &kubeClient, nil)
 		assert.NilError(t, err)
 		runExternalTLSListenerTests(t, ctx, caches)
 	})
@@ -271,7 +288,7 @@ func TestExternalTLSListener(t *testing.T) {
 
 		kubeClient := fake.Clientset{}
 		ctx := config.ToContext(context.Background(), c)
-		caches, err := NewCaches(ctx, &kubeClient)
+		caches, err := NewCaches(ctx, &kubeClient, nil)
 		assert.NilError(t, err)
 		runExternalTLSListenerTests(t, ctx, caches)
 	})
@@ -317,11 +334,12 @@ func TestLocalTLSListener(t *testing.T) {
 	_, err := kubeClient.CoreV1().Secrets("knative-serving").Create(ctx, oneCertSecret, metav1.CreateOptions{})
 	assert.NilError(t, err)
 
-	caches, err := NewCaches(ctx, &kubeClient)
+	caches, err := NewCaches(ctx, &kubeClient, nil)
 	assert.NilError(t, err)
 
 	t.Run("without SNI matches", func(t *testing.T) {
 		translatedIngress := &translatedIngress{
+			nodeID:             config.DefaultGatewayNodeID,
 			externalSNIMatches: nil,
 		}
 		err := caches.addTranslatedIngress(translatedIngress)
@@ -337,6 +355,7 @@ func TestLocalTLSListener(t *testing.T) {
 
 	t.Run("with a single SNI match", func(t *testing.T) {
 		translatedIngress := &translatedIngress{
+			nodeID:          config.DefaultGatewayNodeID,
 			localSNIMatches: []*envoy.SNIMatch{fooSNIMatch},
 		}
 		err := caches.addTranslatedIngress(translatedIngress)
@@ -364,6 +383,7 @@ func TestLocalTLSListener(t *testing.T) {
 
 	t.Run("with multiple SNI matches", func(t *testing.T) {
 		translatedIngress := &translatedIngress{
+			nodeID:          config.DefaultGatewayNodeID,
 			localSNIMatches: []*envoy.SNIMatch{fooSNIMatch, barSNIMatch},
 		}
 		err := caches.addTranslatedIngress(translatedIngress)
@@ -409,11 +429,11 @@ func TestListenersAndClustersWithTracing(t *testing.T) {
 	cfg := testConfig.DeepCopy()
 	ctx := (&testConfigStore{config: cfg}).ToContext(context.Background())
 
-	caches, err := NewCaches(ctx, &kubeClient)
+	caches, err := NewCaches(ctx, &kubeClient, nil)
 	assert.NilError(t, err)
 
 	t.Run("check a tracing cluster exist, and tracing is configured on listeners", func(t *testing.T) {
-		translatedIngress := &translatedIngress{}
+		translatedIngress := &translatedIngress{nodeID: config.DefaultGatewayNodeID}
 		err := caches.addTranslatedIngress(translatedIngress)
 		assert.NilError(t, err)
 
@@ -504,6 +524,7 @@ func createTestDataForIngress(
 			Namespace: ingressNamespace,
 			Name:      ingressName,
 		},
+		nodeID:                  config.DefaultGatewayNodeID,
 		clusters:                []*v3.Cluster{{Name: clusterName}},
 		externalVirtualHosts:    []*route.VirtualHost{{Name: externalVHostName, Domains: []string{externalVHostName}}},
 		externalTLSVirtualHosts: []*route.VirtualHost{{Name: externalTLSVHostName, Domains: []string{externalTLSVHostName}}},
@@ -519,12 +540,236 @@ func createTestDataForIngress(
 	caches.addTranslatedIngress(translatedIngress)
 }
 
+func TestIngressChangeOnlySendsChangedRouteConfigs(t *testing.T) {
+	kubeClient := fake.Clientset{}
+	ctx := config.ToContext(context.Background(), config.FromContextOrDefaults(context.Background()))
+
+	caches, err := NewCaches(ctx, &kubeClient, nil)
+	assert.NilError(t, err)
+
+	for _, name := range []string{"ingress_1", "ingress_2"} {
+		createTestDataForIngress(caches, name, "ns", "cluster_for_"+name,
+			"internal_host_for_"+name, "external_host_for_"+name, "external_tls_host_for_"+name)
+	}
+
+	snapshotCache := cache.NewSnapshotCache(true, cache.IDHash{}, nil)
+	setSnapshot := func() {
+		snapshot, err := caches.ToEnvoySnapshot(ctx)
+		assert.NilError(t, err)
+		assert.NilError(t, snapshotCache.SetSnapshot(ctx, config.DefaultGatewayNodeID, snapshot))
+	}
+	setSnapshot()
+
+	versions := deltaWatch(t, snapshotCache, resource.RouteType, nil).GetNextVersionMap()
+
+	// Only the external host of the second ingress changes.
+	assert.NilError(t, caches.DeleteIngressInfo(ctx, "ingress_2", "ns"))
+	createTestDataForIngress(caches, "ingress_2", "ns", "cluster_for_ingress_2",
+		"internal_host_for_ingress_2", "new_external_host_for_ingress_2", "external_tls_host_for_ingress_2")
+	setSnapshot()
+
+	// The route configs of the other listeners are not sent again.
+	resp := deltaWatch(t, snapshotCache, resource.RouteType, versions)
+	out, err := resp.GetDeltaDiscoveryResponse()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deltaResourceNames(out), []string{externalRouteConfigName})
+	assert.Equal(t, len(out.GetRemovedResources()), 0)
+}
+
+func deltaWatch(t *testing.T, snapshotCache cache.SnapshotCache, typeURL string, versions map[string]string) cache.DeltaResponse {
+	t.Helper()
+
+	responses := make(chan cache.DeltaResponse, 1)
+	cancel := snapshotCache.CreateDeltaWatch(&cache.DeltaRequest{
+		Node:    &core.Node{Id: config.DefaultGatewayNodeID},
+		TypeUrl: typeURL,
+	}, stream.NewStreamState(true, versions), responses)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	select {
+	case resp := <-responses:
+		return resp
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for delta response")
+		return nil
+	}
+}
+
+func deltaResourceNames(resp *discovery.DeltaDiscoveryResponse) []string {
+	names := make([]string, 0, len(resp.GetResources()))
+	for _, r := range resp.GetResources() {
+		names = append(names, r.GetName())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestClusterEndpointsServedViaEDS(t *testing.T) {
+	kubeClient := fake.Clientset{}
+	ctx := config.ToContext(context.Background(), config.FromContextOrDefaults(context.Background()))
+
+	caches, err := NewCaches(ctx, &kubeClient, nil)
+	assert.NilError(t, err)
+
+	staticCluster := envoy.NewCluster("servicens/servicename", 5*time.Second, lbEndpoints, false, nil, v3.Cluster_STATIC)
+	dnsCluster := envoy.NewCluster("servicens/external", 5*time.Second,
+		[]*endpoint.LbEndpoint{envoy.NewLBEndpoint("example.com", 80)}, false, nil, v3.Cluster_LOGICAL_DNS)
+	assert.NilError(t, caches.addTranslatedIngress(&translatedIngress{
+		name:     types.NamespacedName{Namespace: "ingressns", Name: "ingressname"},
+		nodeID:   config.DefaultGatewayNodeID,
+		clusters: []*v3.Cluster{staticCluster, dnsCluster},
+	}))
+
+	snapshot, err := caches.ToEnvoySnapshot(ctx)
+	assert.NilError(t, err)
+
+	clusters := snapshot.GetResources(resource.ClusterType)
+	assert.Equal(t, clusters["servicens/servicename"].(*v3.Cluster).GetType(), v3.Cluster_EDS)
+	assert.Assert(t, clusters["servicens/servicename"].(*v3.Cluster).GetLoadAssignment() == nil)
+	assert.DeepEqual(t, clusters["servicens/external"], dnsCluster, protocmp.Transform())
+
+	endpoints := snapshot.GetResources(resource.EndpointType)
+	assert.Equal(t, len(endpoints), 1)
+	assert.DeepEqual(t, endpoints["servicens/servicename"], staticCluster.GetLoadAssignment(), protocmp.Transform())
+	assert.NilError(t, snapshot.Consistent())
+}
+
+func TestSnapshotVersionIsDeterministic(t *testing.T) {
+	kubeClient := fake.Clientset{}
+	ctx := config.ToContext(context.Background(), config.FromContextOrDefaults(context.Background()))
+
+	newCachesWithIngresses := func(names ...string) *Caches {
+		caches, err := NewCaches(ctx, &kubeClient, nil)
+		assert.NilError(t, err)
+		for _, name := range names {
+			createTestDataForIngress(caches, name, "ns", "cluster_for_"+name,
+				"internal_host_for_"+name, "external_host_for_"+name, "external_tls_host_for_"+name)
+		}
+		return caches
+	}
+
+	caches := newCachesWithIngresses("ingress_1", "ingress_2", "ingress_3")
+	snapshot, err := caches.ToEnvoySnapshot(ctx)
+	assert.NilError(t, err)
+	version := snapshot.GetVersion(resource.ListenerType)
+
+	// Regenerating the same config yields the same version.
+	snapshot, err = caches.ToEnvoySnapshot(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, snapshot.GetVersion(resource.ListenerType), version)
+
+	// The order in which the ingresses were added doesn't matter either.
+	snapshot, err = newCachesWithIngresses("ingress_3", "ingress_1", "ingress_2").ToEnvoySnapshot(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, snapshot.GetVersion(resource.ListenerType), version)
+
+	// Ingresses with several headers to match and to append yield the same version
+	// too, no matter in which order the maps of headers are walked.
+	newCachesWithHeaders := func() *Caches {
+		caches, err := NewCaches(ctx, &kubeClient, nil)
+		assert.NilError(t, err)
+		httpPath := v1alpha1.HTTPIngressPath{
+			Headers: map[string]v1alpha1.HeaderMatch{
+				"k-match-a": {Exact: "a"},
+				"k-match-b": {Exact: "b"},
+				"k-match-c": {},
+				"k-match-d": {Exact: "d"},
+			},
+			AppendHeaders: map[string]string{
+				"k-append-a": "a",
+				"k-append-b": "b",
+				"k-append-c": "c",
+				"k-append-d": "d",
+			},
+		}
+		assert.NilError(t, caches.addTranslatedIngress(&translatedIngress{
+			name:   types.NamespacedName{Namespace: "ns", Name: "headers"},
+			nodeID: config.DefaultGatewayNodeID,
+			externalVirtualHosts: []*route.VirtualHost{envoy.NewVirtualHost("headers", []string{"headers.example.com"}, []*route.Route{
+				envoy.NewRoute("headers", matchHeadersFromHTTPPath(httpPath), "/", nil, 0, httpPath.AppendHeaders, ""),
+			})},
+		}))
+		return caches
+	}
+	snapshot, err = newCachesWithHeaders().ToEnvoySnapshot(ctx)
+	assert.NilError(t, err)
+	headersVersion := snapshot.GetVersion(resource.ListenerType)
+	for range 20 {
+		snapshot, err = newCachesWithHeaders().ToEnvoySnapshot(ctx)
+		assert.NilError(t, err)
+		assert.Equal(t, snapshot.GetVersion(resource.ListenerType), headersVersion)
+	}
+
+	// Changing the config changes the version.
+	createTestDataForIngress(caches, "ingress_4", "ns", "cluster_for_ingress_4",
+		"internal_host_for_ingress_4", "external_host_for_ingress_4", "external_tls_host_for_ingress_4")
+	snapshot, err = caches.ToEnvoySnapshot(ctx)
+	assert.NilError(t, err)
+	assert.Assert(t, snapshot.GetVersion(resource.ListenerType) != version)
+}
+
+func TestSnapshotsPerGatewayFleet(t *testing.T) {
+	kubeClient := fake.Clientset{}
+	ctx := config.ToContext(context.Background(), config.FromContextOrDefaults(context.Background()))
+
+	caches, err := NewCaches(ctx, &kubeClient, nil)
+	assert.NilError(t, err)
+
+	addIngress := func(name, nodeID string) {
+		assert.NilError(t, caches.addTranslatedIngress(&translatedIngress{
+			name:                 types.NamespacedName{Namespace: "ns", Name: name},
+			nodeID:               nodeID,
+			clusters:             []*v3.Cluster{{Name: "cluster_for_" + name}},
+			externalVirtualHosts: []*route.VirtualHost{{Name: name, Domains: []string{name + ".example.com"}}},
+			externalSNIMatches: []*envoy.SNIMatch{{
+				Hosts:      []string{name + ".example.com"},
+				CertSource: types.NamespacedName{Namespace: "ns", Name: "secret_for_" + name},
+			}},
+		}))
+	}
+	addIngress("default", config.DefaultGatewayNodeID)
+	addIngress("tenant-a", "tenant-a")
+	addIngress("tenant-b", "tenant-b")
+
+	snapshots, err := caches.ToEnvoySnapshots(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snapshots), 3)
+
+	for nodeID, name := range map[string]string{
+		config.DefaultGatewayNodeID: "default",
+		"tenant-a":                  "tenant-a",
+		"tenant-b":                  "tenant-b",
+	} {
+		snapshot := snapshots[nodeID]
+
+		clusters := snapshot.GetResources(resource.ClusterType)
+		assert.Equal(t, len(clusters), 1)
+		assert.Check(t, clusters["cluster_for_"+name] != nil)
+
+		routeConfig := snapshot.GetResources(resource.RouteType)[externalRouteConfigName].(*route.RouteConfiguration)
+		assert.DeepEqual(t, getVHostsNames([]*route.RouteConfiguration{routeConfig}), []string{name})
+
+		secrets := snapshot.GetResources(resource.SecretType)
+		assert.Equal(t, len(secrets), 1)
+		assert.Check(t, secrets["ns/secret_for_"+name] != nil)
+	}
+
+	// A fleet that lost all its ingresses still gets an empty config.
+	assert.NilError(t, caches.DeleteIngressInfo(ctx, "tenant-b", "ns"))
+	snapshots, err = caches.ToEnvoySnapshots(ctx)
+	assert.NilError(t, err)
+	routeConfig := snapshots["tenant-b"].GetResources(resource.RouteType)[externalRouteConfigName].(*route.RouteConfiguration)
+	assert.Equal(t, len(routeConfig.GetVirtualHosts()), 0)
+}
+
 func TestValidateIngress(t *testing.T) {
 	kubeClient := fake.Clientset{}
 
 	ctx := config.ToContext(context.Background(), config.FromContextOrDefaults(context.Background()))
 
-	caches, err := NewCaches(ctx, &kubeClient)
+	caches, err := NewCaches(ctx, &kubeClient, nil)
 	assert.NilError(t, err)
 
 	createTestDataForIngress(
@@ -542,6 +787,7 @@ func TestValidateIngress(t *testing.T) {
 			Namespace: "ingress_2_namespace",
 			Name:      "ingress_2",
 		},
+		nodeID:                  config.DefaultGatewayNodeID,
 		clusters:                []*v3.Cluster{{Name: "cluster_for_ingress_2"}},
 		externalVirtualHosts:    []*route.VirtualHost{{Name: "external_host_for_ingress_2", Domains: []string{"external_host_for_ingress_2"}}},
 		externalTLSVirtualHosts: []*route.VirtualHost{{Name: "external_tls_host_for_ingress_2", Domains: []string{"external__tlshost_for_ingress_2"}}},
@@ -570,3 +816,53 @@ func getVHostsNames(routeConfigs []*route.RouteConfiguration) []string {
 
 	return res
 }
+
+func TestToEnvoySnapshotForNodeZoneAware(t *testing.T) {
+	kubeClient := fake.Clientset{}
+	cfg := config.FromContextOrDefaults(context.Background()).DeepCopy()
+	cfg.Kourier.LocalityLBPolicy = config.LocalityLBPolicyZoneAware
+	cfg.Kourier.LocalityLBLocalCluster = "kourier-local"
+	ctx := config.ToContext(context.Background(), cfg)
+
+	var gotNamespace, gotService string
+	caches, err := NewCaches(ctx, &kubeClient, func(ns, serviceName string) ([]*discoveryv1.EndpointSlice, error) {
+		gotNamespace, gotService = ns, serviceName
+		return []*discoveryv1.EndpointSlice{{
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Ports: []discoveryv1.EndpointPort{{
+				Name: ptr.To(config.InternalServiceHTTPPortName),
+				Port: ptr.To(int32(config.HTTPPortLocal)),
+			}},
+			Endpoints: []discoveryv1.Endpoint{{
+				Addresses:  []string{"10.0.0.1"},
+				Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+				Zone:       ptr.To("zone-a"),
+			}},
+		}}, nil
+	})
+	assert.NilError(t, err)
+
+	// Fleets that were never assigned an ingress have no snapshot.
+	snapshot, err := caches.ToEnvoySnapshotForNode(ctx, "tenant-a")
+	assert.NilError(t, err)
+	assert.Check(t, snapshot == nil)
+
+	assert.NilError(t, caches.addTranslatedIngress(&translatedIngress{
+		name:   types.NamespacedName{Namespace: "ns", Name: "name"},
+		nodeID: "tenant-a",
+	}))
+	snapshot, err = caches.ToEnvoySnapshotForNode(ctx, "tenant-a")
+	assert.NilError(t, err)
+	assert.Assert(t, snapshot != nil)
+
+	_, internalServiceName := config.ServiceNames("tenant-a")
+	assert.Equal(t, gotNamespace, config.GatewayNamespace())
+	assert.Equal(t, gotService, internalServiceName)
+
+	localCluster := snapshot.GetResources(resource.EndpointType)["kourier-local"].(*endpoint.ClusterLoadAssignment)
+	assert.Assert(t, localCluster != nil)
+	assert.Equal(t, len(localCluster.Endpoints), 1)
+	assert.Equal(t, localCluster.Endpoints[0].Locality.Zone, "zone-a")
+	assert.Equal(t, len(localCluster.Endpoints[0].LbEndpoints), 1)
+	assert.Equal(t, localCluster.Endpoints[0].LbEndpoints[0].GetEndpoint().GetAddress().GetSocketAddress().GetPortValue(), uint32(config.HTTPPortLocal))
+}
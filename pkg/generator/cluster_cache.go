@@ -37,6 +37,7 @@ limitations under the License.
 package generator
 
 import (
+	"sort"
 	"strings"
 	"time"
 
@@ -64,9 +65,16 @@ func newClustersCacheWithExpAndCleanupIntervals(expiration time.Duration, cleanu
 	return &ClustersCache{clusters: goCache, clusterExpiration: expiration}
 }
 
-func (cc *ClustersCache) set(cluster *v3.Cluster, ingressName string, ingressNamespace string) {
+// cachedCluster is a cluster along with the node ID of the fleet of gateways it is
+// served to. Clusters without a node ID are served to all fleets.
+type cachedCluster struct {
+	cluster *v3.Cluster
+	nodeID  string
+}
+
+func (cc *ClustersCache) set(cluster *v3.Cluster, nodeID string, ingressName string, ingressNamespace string) {
 	key := key(cluster.GetName(), ingressName, ingressNamespace)
-	cc.clusters.Set(key, cluster, gocache.NoExpiration)
+	cc.clusters.Set(key, cachedCluster{cluster: cluster, nodeID: nodeID}, gocache.NoExpiration)
 }
 
 func (cc *ClustersCache) setExpiration(clusterName string, ingressName string, ingressNamespace string) {
@@ -76,10 +84,22 @@ func (cc *ClustersCache) setExpiration(clusterName string, ingressName string, i
 	}
 }
 
-func (cc *ClustersCache) list() []cachetypes.Resource {
-	res := make([]cachetypes.Resource, 0, cc.clusters.ItemCount())
-	for _, cluster := range cc.clusters.Items() {
-		res = append(res, cluster.Object.(cachetypes.Resource))
+// list returns the clusters served to the fleet of gateways with the given node ID.
+func (cc *ClustersCache) list(nodeID string) []cachetypes.Resource {
+	items := cc.clusters.Items()
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	// Sort for a stable order, as the clusters end up in the generated snapshot.
+	sort.Strings(keys)
+
+	res := make([]cachetypes.Resource, 0, len(keys))
+	for _, key := range keys {
+		cached := items[key].Object.(cachedCluster)
+		if cached.nodeID == "" || cached.nodeID == nodeID {
+			res = append(res, cached.cluster)
+		}
 	}
 
 	return res
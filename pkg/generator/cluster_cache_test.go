@@ -23,11 +23,14 @@ import (
 	"time"
 
 	envoy_api_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	cachetypes "github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+const testNodeID = "test-gateway"
+
 var testCluster1 = envoy_api_v3.Cluster{
 	Name: "test_cluster_1",
 }
@@ -38,9 +41,9 @@ var testCluster2 = envoy_api_v3.Cluster{
 
 func TestSetCluster(t *testing.T) {
 	cache := newClustersCache()
-	cache.set(&testCluster1, "some_ingress_name", "some_ingress_namespace")
+	cache.set(&testCluster1, testNodeID, "some_ingress_name", "some_ingress_namespace")
 
-	list := cache.list()
+	list := cache.list(testNodeID)
 
 	assert.Assert(t, is.Len(list, 1))
 	assert.Equal(t, testCluster1.Name, list[0].(*envoy_api_v3.Cluster).Name)
@@ -48,10 +51,10 @@ func TestSetCluster(t *testing.T) {
 
 func TestSetSeveralClusters(t *testing.T) {
 	cache := newClustersCache()
-	cache.set(&testCluster1, "some_ingress_name", "some_ingress_namespace")
-	cache.set(&testCluster2, "some_ingress_name", "some_ingress_namespace")
+	cache.set(&testCluster1, testNodeID, "some_ingress_name", "some_ingress_namespace")
+	cache.set(&testCluster2, testNodeID, "some_ingress_name", "some_ingress_namespace")
 
-	list := cache.list()
+	list := cache.list(testNodeID)
 	names := make([]string, 0, len(list))
 	for _, cluster := range list {
 		names = append(names, cluster.(*envoy_api_v3.Cluster).Name)
@@ -68,24 +71,43 @@ func TestSetSeveralClusters(t *testing.T) {
 func TestClustersExpire(t *testing.T) {
 	interval := 10 * time.Millisecond
 	cache := newClustersCacheWithExpAndCleanupIntervals(interval, interval)
-	cache.set(&testCluster1, "some_ingress_name", "some_ingress_namespace")
-	assert.Assert(t, is.Len(cache.list(), 1))
+	cache.set(&testCluster1, testNodeID, "some_ingress_name", "some_ingress_namespace")
+	assert.Assert(t, is.Len(cache.list(testNodeID), 1))
 
 	// Wait for twice the interval and assert that the cluster is still there.
 	time.Sleep(2 * interval)
-	assert.Assert(t, is.Len(cache.list(), 1))
+	assert.Assert(t, is.Len(cache.list(testNodeID), 1))
 
 	// Mark the cluster to be expired.
 	cache.setExpiration(testCluster1.Name, "some_ingress_name", "some_ingress_namespace")
 
 	// The cluster should eventually disappear.
 	wait.PollUntilContextTimeout(context.Background(), interval, 5*time.Second, true, func(_ context.Context) (bool, error) {
-		return len(cache.list()) == 0, nil
+		return len(cache.list(testNodeID)) == 0, nil
 	})
-	assert.Assert(t, is.Len(cache.list(), 0))
+	assert.Assert(t, is.Len(cache.list(testNodeID), 0))
 }
 
 func TestListWhenThereAreNoClusters(t *testing.T) {
 	cache := newClustersCache()
-	assert.Assert(t, is.Len(cache.list(), 0))
+	assert.Assert(t, is.Len(cache.list(testNodeID), 0))
+}
+
+func TestListClustersOfNode(t *testing.T) {
+	cache := newClustersCache()
+	cache.set(&testCluster1, testNodeID, "some_ingress_name", "some_ingress_namespace")
+	cache.set(&testCluster2, "other-gateway", "other_ingress_name", "some_ingress_namespace")
+	cache.set(&envoy_api_v3.Cluster{Name: "shared"}, "", "__shared", "_internal")
+
+	names := func(list []cachetypes.Resource) []string {
+		names := make([]string, 0, len(list))
+		for _, cluster := range list {
+			names = append(names, cluster.(*envoy_api_v3.Cluster).Name)
+		}
+		return names
+	}
+
+	assert.DeepEqual(t, names(cache.list(testNodeID)), []string{"shared", testCluster1.Name})
+	assert.DeepEqual(t, names(cache.list("other-gateway")), []string{"shared", testCluster2.Name})
+	assert.DeepEqual(t, names(cache.list("unknown-gateway")), []string{"shared"})
 }
@@ -18,14 +18,16 @@ package generator
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"strings"
-	"time"
 
 	v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	envoycorev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -37,14 +39,19 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/anypb"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
 	envoy "knative.dev/net-kourier/pkg/envoy/api"
 	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
 	"knative.dev/networking/pkg/apis/networking"
 	"knative.dev/networking/pkg/apis/networking/v1alpha1"
 	"knative.dev/networking/pkg/certificates"
 	netconfig "knative.dev/networking/pkg/config"
+	"knative.dev/networking/pkg/http/header"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/system"
@@ -52,7 +59,9 @@ import (
 )
 
 type translatedIngress struct {
-	name                    types.NamespacedName
+	name types.NamespacedName
+	// nodeID is the node ID of the fleet of gateways serving the ingress.
+	nodeID                  string
 	localSNIMatches         []*envoy.SNIMatch
 	externalSNIMatches      []*envoy.SNIMatch
 	clusters                []*v3.Cluster
@@ -63,29 +72,37 @@ type translatedIngress struct {
 }
 
 type IngressTranslator struct {
-	secretGetter      func(ns, name string) (*corev1.Secret, error)
-	nsConfigmapGetter func(label string) ([]*corev1.ConfigMap, error)
-	endpointsGetter   func(ns, name string) (*corev1.Endpoints, error)
-	serviceGetter     func(ns, name string) (*corev1.Service, error)
-	tracker           tracker.Interface
+	secretGetter         func(ns, name string) (*corev1.Secret, error)
+	nsConfigmapGetter    func(label string) ([]*corev1.ConfigMap, error)
+	endpointSlicesGetter func(ns, serviceName string) ([]*discoveryv1.EndpointSlice, error)
+	serviceGetter        func(ns, name string) (*corev1.Service, error)
+	tracker              tracker.Interface
 }
 
+// NewIngressTranslator creates a new IngressTranslator. The endpointSlicesGetter is
+// expected to return all the EndpointSlices belonging to the given service.
 func NewIngressTranslator(
 	secretGetter func(ns, name string) (*corev1.Secret, error),
 	nsConfigmapGetter func(label string) ([]*corev1.ConfigMap, error),
-	endpointsGetter func(ns, name string) (*corev1.Endpoints, error),
+	endpointSlicesGetter func(ns, serviceName string) ([]*discoveryv1.EndpointSlice, error),
 	serviceGetter func(ns, name string) (*corev1.Service, error),
 	tracker tracker.Interface,
 ) IngressTranslator {
 	return IngressTranslator{
-		secretGetter:      secretGetter,
-		nsConfigmapGetter: nsConfigmapGetter,
-		endpointsGetter:   endpointsGetter,
-		serviceGetter:     serviceGetter,
-		tracker:           tracker,
+		secretGetter:         secretGetter,
+		nsConfigmapGetter:    nsConfigmapGetter,
+		endpointSlicesGetter: endpointSlicesGetter,
+		serviceGetter:        serviceGetter,
+		tracker:              tracker,
 	}
 }
 
+// VirtualHostNamePrefix returns the prefix of the names of all virtual hosts
+// generated for the given ingress.
+func VirtualHostNamePrefix(namespace, name string) string {
+	return fmt.Sprintf("(%s/%s).", namespace, name)
+}
+
 func (translator *IngressTranslator) translateIngress(ctx context.Context, ingress *v1alpha1.Ingress, extAuthzEnabled bool) (*translatedIngress, error) {
 	logger := logging.FromContext(ctx)
 
@@ -129,8 +146,60 @@ func (translator *IngressTranslator) translateIngress(ctx context.Context, ingre
 		}
 	}
 
+	matches, err := routeMatchesForIngress(ingress)
+	if err != nil {
+		return nil, err
+	}
+	timeouts, err := config.RouteTimeoutsForIngress(ingress.Annotations, cfg.Kourier.RouteTimeouts)
+	if err != nil {
+		return nil, err
+	}
+	retryPolicy, err := config.RetryPolicyForIngress(ingress.Annotations, cfg.Kourier.RetryPolicy)
+	if err != nil {
+		return nil, err
+	}
+	outlierDetection, err := config.OutlierDetectionForIngress(ingress.Annotations, cfg.Kourier.OutlierDetection)
+	if err != nil {
+		return nil, err
+	}
+	circuitBreakers, err := config.CircuitBreakersForIngress(ingress.Annotations, cfg.Kourier.CircuitBreakers)
+	if err != nil {
+		return nil, err
+	}
+	healthCheck, err := config.HealthCheckForIngress(ingress.Annotations, cfg.Kourier.HealthCheck)
+	if err != nil {
+		return nil, err
+	}
+	lb, err := config.LoadBalancingForIngress(ingress.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	connectionPool, err := config.ConnectionPoolForIngress(ingress.Annotations, cfg.Kourier.ConnectionPool)
+	if err != nil {
+		return nil, err
+	}
+	upstreamProtocol, err := config.UpstreamProtocolForIngress(ingress.Annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := clusterSettings{
+		OutlierDetection: outlierDetection,
+		CircuitBreakers:  circuitBreakers,
+		HealthCheck:      healthCheck,
+		LBPolicy:         lb.Policy,
+		ConnectionPool:   connectionPool,
+		UpstreamProtocol: upstreamProtocol,
+	}
+	defaultSettings := clusterSettings{
+		OutlierDetection: cfg.Kourier.OutlierDetection,
+		CircuitBreakers:  cfg.Kourier.CircuitBreakers,
+		HealthCheck:      cfg.Kourier.HealthCheck,
+		ConnectionPool:   cfg.Kourier.ConnectionPool,
+	}
+
 	for i, rule := range ingress.Spec.Rules {
-		ruleName := fmt.Sprintf("(%s/%s).Rules[%d]", ingress.Namespace, ingress.Name, i)
+		ruleName := fmt.Sprintf("%sRules[%d]", VirtualHostNamePrefix(ingress.Namespace, ingress.Name), i)
 
 		routes := make([]*route.Route, 0, len(rule.HTTP.Paths))
 		tlsRoutes := make([]*route.Route, 0, len(rule.HTTP.Paths))
@@ -142,12 +211,22 @@ func (translator *IngressTranslator) translateIngress(ctx context.Context, ingre
 			}
 
 			pathName := fmt.Sprintf("%s.Paths[%s]", ruleName, path)
+			routeOpts := matches.options(httpPath, path)
+			if timeouts.IdleTimeout > 0 {
+				routeOpts = append(routeOpts, envoy.WithIdleTimeout(timeouts.IdleTimeout))
+			}
+			if retryPolicy.Enabled() {
+				routeOpts = append(routeOpts, envoy.WithRetryPolicy(retryPolicy))
+			}
+			if lb.SessionAffinity.Enabled() {
+				routeOpts = append(routeOpts, envoy.WithSessionAffinity(lb.SessionAffinity))
+			}
 
 			wrs := make([]*route.WeightedCluster_ClusterWeight, 0, len(httpPath.Splits))
 			for _, split := range httpPath.Splits {
-				// The FQN of the service is sufficient here, as clusters towards the
-				// same service are supposed to be deduplicated anyway.
-				splitName := fmt.Sprintf("%s/%s", split.ServiceNamespace, split.ServiceName)
+				// Clusters towards the same service with the same settings are
+				// deduplicated, so that ingresses share them.
+				splitName := settings.clusterName(split.ServiceNamespace, split.ServiceName, defaultSettings)
 
 				if err := trackService(translator.tracker, split.ServiceNamespace, split.ServiceName, ingress); err != nil {
 					return nil, err
@@ -163,29 +242,37 @@ func (translator *IngressTranslator) translateIngress(ctx context.Context, ingre
 				}
 
 				// Match the ingress' port with a port on the Service to find the target.
-				// Also find out if the target supports HTTP2.
+				// Named target ports are resolved per endpoint later on, so targetPort is
+				// only a fallback for those.
 				var (
 					externalPort = int32(80)
 					targetPort   = int32(80)
-					http2        = false
+					portName     = ""
+					selectedPort *corev1.ServicePort
 				)
-				for _, port := range service.Spec.Ports {
+				for i, port := range service.Spec.Ports {
 					if port.Port == split.ServicePort.IntVal || port.Name == split.ServicePort.StrVal {
 						externalPort = port.Port
 						targetPort = port.TargetPort.IntVal
-					}
-					if port.Name == "http2" || port.Name == "h2c" {
-						http2 = true
+						portName = port.Name
+						selectedPort = &service.Spec.Ports[i]
 					}
 				}
 
-				// Disable HTTP2 if the annotation is specified.
-				if strings.EqualFold(config.GetDisableHTTP2(ingress.Annotations), "true") {
+				// Find out if the target supports HTTP2, unless the ingress forces a protocol.
+				var http2 bool
+				switch upstreamProtocol {
+				case config.UpstreamProtocolHTTP1:
 					http2 = false
+				case config.UpstreamProtocolHTTP2:
+					http2 = true
+				default:
+					http2 = isHTTP2Port(service, selectedPort)
 				}
 
 				var (
 					publicLbEndpoints []*endpoint.LbEndpoint
+					localities        []*endpoint.LocalityLbEndpoints
 					typ               v3.Cluster_DiscoveryType
 				)
 				if service.Spec.Type == corev1.ServiceTypeExternalName {
@@ -195,21 +282,26 @@ func (translator *IngressTranslator) translateIngress(ctx context.Context, ingre
 						envoy.NewLBEndpoint(service.Spec.ExternalName, uint32(externalPort)), //#nosec G115
 					}
 				} else {
-					// For all other types, fetch the endpoints object.
-					endpoints, err := translator.endpointsGetter(split.ServiceNamespace, split.ServiceName)
-					if apierrors.IsNotFound(err) {
-						logger.Warnf("Endpoints '%s/%s' not yet created", split.ServiceNamespace, split.ServiceName)
+					// For all other types, fetch the endpoint slices of the service.
+					slices, err := translator.endpointSlicesGetter(split.ServiceNamespace, split.ServiceName)
+					if err != nil {
+						return nil, fmt.Errorf("failed to fetch endpoint slices '%s/%s': %w", split.ServiceNamespace, split.ServiceName, err)
+					}
+					if len(slices) == 0 {
+						logger.Warnf("EndpointSlices for '%s/%s' not yet created", split.ServiceNamespace, split.ServiceName)
 						// TODO(markusthoemmes): Find out if we should actually `continue` here.
 						return nil, nil
-					} else if err != nil {
-						return nil, fmt.Errorf("failed to fetch endpoints '%s/%s': %w", split.ServiceNamespace, split.ServiceName, err)
 					}
 
 					typ = v3.Cluster_STATIC
-					publicLbEndpoints = lbEndpointsForKubeEndpoints(endpoints, targetPort)
+					localities = localityLbEndpointsForEndpointSlices(slices, addressTypeForService(service), portName, targetPort)
+					publicLbEndpoints = lbEndpointsForLocalities(localities)
 				}
 
-				connectTimeout := 5 * time.Second
+				connectTimeout := connectionPool.ConnectTimeout
+				if connectTimeout == 0 {
+					connectTimeout = config.DefaultConnectTimeout
+				}
 
 				var transportSocket *envoycorev3.TransportSocket
 
@@ -221,7 +313,35 @@ func (translator *IngressTranslator) translateIngress(ctx context.Context, ingre
 						return nil, err
 					}
 				}
-				cluster := envoy.NewCluster(splitName, connectTimeout, publicLbEndpoints, http2, transportSocket, typ)
+				var clusterOpts []envoy.ClusterOption
+				// Hash based policies don't take localities into account, so their
+				// endpoints don't need to be grouped by locality either.
+				if cfg.Kourier.LocalityLBPolicy != config.LocalityLBPolicyDisabled && len(localities) != 0 && !lb.Policy.IsHashBased() {
+					clusterOpts = append(clusterOpts, envoy.WithLocalityLB(localities, cfg.Kourier.LocalityLBPolicy))
+				}
+				if lb.Policy != "" {
+					clusterOpts = append(clusterOpts, envoy.WithLBPolicy(lb.Policy))
+				}
+				if connectionPool.HasHTTPProtocolOptions() {
+					clusterOpts = append(clusterOpts, envoy.WithConnectionPool(connectionPool, http2))
+				}
+				if outlierDetection.Enabled() {
+					clusterOpts = append(clusterOpts, envoy.WithOutlierDetection(outlierDetection))
+				}
+				if circuitBreakers.Enabled() {
+					clusterOpts = append(clusterOpts, envoy.WithCircuitBreakers(circuitBreakers))
+				}
+				if healthCheck.Enabled() {
+					// Envoy rejects gRPC health checks of HTTP/1 clusters, which would
+					// reject the whole snapshot.
+					if healthCheck.Type == config.HealthCheckGRPC && !http2 {
+						logger.Warnf("Not health checking '%s/%s' with gRPC, as it doesn't support HTTP/2", split.ServiceNamespace, split.ServiceName)
+					} else {
+						clusterOpts = append(clusterOpts, envoy.WithHealthCheck(healthCheck, http2))
+					}
+				}
+
+				cluster := envoy.NewCluster(splitName, connectTimeout, publicLbEndpoints, http2, transportSocket, typ, clusterOpts...)
 				logger.Debugf("adding cluster: %v", cluster)
 				clusters = append(clusters, cluster)
 
@@ -233,19 +353,19 @@ func (translator *IngressTranslator) translateIngress(ctx context.Context, ingre
 				// disable ext_authz filter for HTTP01 challenge when the feature is enabled
 				if extAuthzEnabled && strings.HasPrefix(path, "/.well-known/acme-challenge/") {
 					routes = append(routes, envoy.NewRouteExtAuthzDisabled(
-						pathName, matchHeadersFromHTTPPath(httpPath), path, wrs, 0, httpPath.AppendHeaders, httpPath.RewriteHost))
+						pathName, matchHeadersFromHTTPPath(httpPath), path, wrs, timeouts.Timeout, httpPath.AppendHeaders, httpPath.RewriteHost, routeOpts...))
 				} else if _, ok := os.LookupEnv("KOURIER_HTTPOPTION_DISABLED"); !ok && ingress.Spec.HTTPOption == v1alpha1.HTTPOptionRedirected && rule.Visibility == v1alpha1.IngressVisibilityExternalIP {
 					// Do not create redirect route when KOURIER_HTTPOPTION_DISABLED is set. This option is useful when front end proxy handles the redirection.
 					// e.g. Kourier on OpenShift handles HTTPOption by OpenShift Route so KOURIER_HTTPOPTION_DISABLED should be set.
 					routes = append(routes, envoy.NewRedirectRoute(
-						pathName, matchHeadersFromHTTPPath(httpPath), path))
+						pathName, matchHeadersFromHTTPPath(httpPath), path, routeOpts...))
 				} else {
 					routes = append(routes, envoy.NewRoute(
-						pathName, matchHeadersFromHTTPPath(httpPath), path, wrs, 0, httpPath.AppendHeaders, httpPath.RewriteHost))
+						pathName, matchHeadersFromHTTPPath(httpPath), path, wrs, timeouts.Timeout, httpPath.AppendHeaders, httpPath.RewriteHost, routeOpts...))
 				}
 				if len(ingress.Spec.TLS) != 0 || cfg.Kourier.UseHTTPSListenerWithOneCert() {
 					tlsRoutes = append(tlsRoutes, envoy.NewRoute(
-						pathName, matchHeadersFromHTTPPath(httpPath), path, wrs, 0, httpPath.AppendHeaders, httpPath.RewriteHost))
+						pathName, matchHeadersFromHTTPPath(httpPath), path, wrs, timeouts.Timeout, httpPath.AppendHeaders, httpPath.RewriteHost, routeOpts...))
 				}
 			}
 		}
@@ -288,6 +408,7 @@ func (translator *IngressTranslator) translateIngress(ctx context.Context, ingre
 			Namespace: ingress.Namespace,
 			Name:      ingress.Name,
 		},
+		nodeID:                  config.GatewayNodeID(ingress.Labels, ingress.Annotations),
 		localSNIMatches:         localSNIMatches,
 		externalSNIMatches:      externalSNIMatches,
 		clusters:                clusters,
@@ -451,41 +572,261 @@ func trackService(t tracker.Interface, svcNs, svcName string, ingress *v1alpha1.
 		return fmt.Errorf("could not track service reference: %w", err)
 	}
 
+	// EndpointSlices have generated names, so they're tracked through the label
+	// that ties them to their service.
 	if err := t.TrackReference(tracker.Reference{
-		Kind:       "Endpoints",
-		APIVersion: "v1",
+		Kind:       "EndpointSlice",
+		APIVersion: "discovery.k8s.io/v1",
 		Namespace:  svcNs,
-		Name:       svcName,
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{discoveryv1.LabelServiceName: svcName},
+		},
 	}, ingress); err != nil {
-		return fmt.Errorf("could not track endpoints reference: %w", err)
+		return fmt.Errorf("could not track endpoint slices reference: %w", err)
 	}
 	return nil
 }
 
-func lbEndpointsForKubeEndpoints(kubeEndpoints *corev1.Endpoints, targetPort int32) []*endpoint.LbEndpoint {
-	var readyAddressCount int
-	for _, subset := range kubeEndpoints.Subsets {
-		readyAddressCount += len(subset.Addresses)
+// isHTTP2Port returns whether the given port of the service, if any, serves HTTP/2
+// without TLS. Its appProtocol tells, falling back to its name.
+//
+// Knative only tells the protocol of a revision by its plain text port, which its
+// TLS port named "https" shares. The TLS port thus serves HTTP/2 if another port
+// of the service does.
+func isHTTP2Port(service *corev1.Service, port *corev1.ServicePort) bool {
+	if port == nil {
+		return false
+	}
+	if port.AppProtocol != nil {
+		switch *port.AppProtocol {
+		case "kubernetes.io/h2c", "grpc":
+			return true
+		case "http":
+			return false
+		}
 	}
 
-	if readyAddressCount == 0 {
+	switch port.Name {
+	case "http2", "h2c":
+		return true
+	case "https":
+		for i := range service.Spec.Ports {
+			if other := &service.Spec.Ports[i]; other.Name != "https" && isHTTP2Port(service, other) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addressTypeForService returns the address type of the EndpointSlices that
+// carry the service's primary IP family.
+func addressTypeForService(service *corev1.Service) discoveryv1.AddressType {
+	if len(service.Spec.IPFamilies) > 0 && service.Spec.IPFamilies[0] == corev1.IPv6Protocol {
+		return discoveryv1.AddressTypeIPv6
+	}
+	return discoveryv1.AddressTypeIPv4
+}
+
+// localityLbEndpointsForEndpointSlices merges the endpoints of all slices of a
+// service and groups them into localities by the zone they're in.
+//
+// Ready endpoints are preferred. If there are none, endpoints that are terminating
+// but still serving are used instead, so that traffic can drain gracefully rather
+// than failing outright while a service is rolled.
+//
+// The port of each endpoint is taken from the slice's port matching the given
+// service port name, as slices carry the resolved container port. That way named
+// target ports work, even if they resolve to different numbers across pods.
+// targetPort is used for slices that don't list any ports.
+func localityLbEndpointsForEndpointSlices(slices []*discoveryv1.EndpointSlice, addressType discoveryv1.AddressType, servicePortName string, targetPort int32) []*endpoint.LocalityLbEndpoints {
+	ready, terminating := map[string][]*endpoint.LbEndpoint{}, map[string][]*endpoint.LbEndpoint{}
+	seen := sets.New[string]()
+	for _, slice := range slices {
+		if slice.AddressType != addressType {
+			continue
+		}
+		port := endpointSlicePort(slice, servicePortName, targetPort)
+		if port == 0 {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			zone := ptr.Deref(ep.Zone, "")
+			switch {
+			case IsEndpointReady(ep.Conditions):
+				ready[zone] = appendUnseen(ready[zone], seen, ep.Addresses, port)
+			case IsEndpointServingAndTerminating(ep.Conditions):
+				terminating[zone] = appendUnseen(terminating[zone], seen, ep.Addresses, port)
+			}
+		}
+	}
+
+	byZone := ready
+	if len(byZone) == 0 {
+		byZone = terminating
+	}
+	if len(byZone) == 0 {
 		return nil
 	}
 
-	eps := make([]*endpoint.LbEndpoint, 0, readyAddressCount)
-	for _, subset := range kubeEndpoints.Subsets {
-		for _, address := range subset.Addresses {
-			eps = append(eps, envoy.NewLBEndpoint(address.IP, uint32(targetPort))) //#nosec G115
+	localities := make([]*endpoint.LocalityLbEndpoints, 0, len(byZone))
+	for _, zone := range sets.List(sets.KeySet(byZone)) {
+		locality := &endpoint.LocalityLbEndpoints{
+			LbEndpoints: byZone[zone],
+		}
+		if zone != "" {
+			locality.Locality = &envoycorev3.Locality{Zone: zone}
 		}
+		localities = append(localities, locality)
 	}
+	return localities
+}
 
+// lbEndpointsForLocalities returns the endpoints of all the given localities.
+func lbEndpointsForLocalities(localities []*endpoint.LocalityLbEndpoints) []*endpoint.LbEndpoint {
+	var eps []*endpoint.LbEndpoint
+	for _, locality := range localities {
+		eps = append(eps, locality.GetLbEndpoints()...)
+	}
 	return eps
 }
 
+// endpointSlicePort returns the port of the slice backing the service port with the
+// given name, falling back to targetPort if the slice doesn't list any ports. It
+// returns 0 if the slice doesn't serve the service port at all.
+func endpointSlicePort(slice *discoveryv1.EndpointSlice, servicePortName string, targetPort int32) int32 {
+	if len(slice.Ports) == 0 {
+		return targetPort
+	}
+	for _, port := range slice.Ports {
+		if ptr.Deref(port.Name, "") == servicePortName && port.Port != nil {
+			return *port.Port
+		}
+	}
+	return 0
+}
+
+// appendUnseen appends endpoints for the addresses not yet recorded in seen to the
+// given list. The same endpoint can show up in more than one slice while it's moved
+// between them.
+func appendUnseen(list []*endpoint.LbEndpoint, seen sets.Set[string], addresses []string, port int32) []*endpoint.LbEndpoint {
+	for _, address := range addresses {
+		key := net.JoinHostPort(address, strconv.Itoa(int(port)))
+		if !seen.Has(key) {
+			seen.Insert(key)
+			list = append(list, envoy.NewLBEndpoint(address, uint32(port))) //#nosec G115
+		}
+	}
+	return list
+}
+
+// IsEndpointReady returns whether an endpoint is ready. A nil condition must be
+// interpreted as ready, as per the EndpointSlice API.
+func IsEndpointReady(conditions discoveryv1.EndpointConditions) bool {
+	return conditions.Ready == nil || *conditions.Ready
+}
+
+// IsEndpointServingAndTerminating returns whether an endpoint is shutting down but
+// still able to serve traffic.
+func IsEndpointServingAndTerminating(conditions discoveryv1.EndpointConditions) bool {
+	return conditions.Serving != nil && *conditions.Serving &&
+		conditions.Terminating != nil && *conditions.Terminating
+}
+
+// clusterSettings are the settings of the clusters of an ingress that its
+// annotations can change.
+type clusterSettings struct {
+	OutlierDetection config.OutlierDetection
+	CircuitBreakers  config.CircuitBreakers
+	HealthCheck      config.HealthCheck
+	LBPolicy         config.LBPolicy
+	ConnectionPool   config.ConnectionPool
+	UpstreamProtocol config.UpstreamProtocol
+}
+
+// clusterName returns the name of the cluster towards the given service with
+// these settings. Clusters with the defaults of config-kourier are named after
+// the service. Otherwise, a hash of the settings is appended, so that ingresses
+// routing to the same service with different annotations each get their own
+// cluster instead of one of them silently winning.
+func (s clusterSettings) clusterName(namespace, name string, defaults clusterSettings) string {
+	if s == defaults {
+		return fmt.Sprintf("%s/%s", namespace, name)
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", s)))
+	return fmt.Sprintf("%s/%s/%x", namespace, name, sum[:4])
+}
+
+// ServiceOfCluster returns the service the cluster with the given name routes to,
+// whether its settings are the defaults or not.
+func ServiceOfCluster(clusterName string) (types.NamespacedName, bool) {
+	parts := strings.SplitN(clusterName, "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, true
+}
+
+// routeMatches are the ways the annotations of an ingress match requests to its
+// paths, keyed by path.
+type routeMatches struct {
+	pathTypes   map[string]config.PathMatchType
+	headers     map[string][]config.ValueMatch
+	queryParams map[string][]config.ValueMatch
+}
+
+func routeMatchesForIngress(ingress *v1alpha1.Ingress) (routeMatches, error) {
+	var (
+		matches routeMatches
+		err     error
+	)
+	if matches.pathTypes, err = config.PathMatchTypes(ingress.Annotations); err != nil {
+		return matches, err
+	}
+	if matches.headers, err = config.HeaderMatches(ingress.Annotations); err != nil {
+		return matches, err
+	}
+	if matches.queryParams, err = config.QueryParameterMatches(ingress.Annotations); err != nil {
+		return matches, err
+	}
+	return matches, nil
+}
+
+// options returns the options matching requests against the given path of the
+// ingress.
+//
+// The prober of the ingress requests /healthz with a header only matched by the
+// probe copies of the paths. Those keep matching by the prefix / instead of an
+// exact path or regex and ignore the header and query parameter matches, which
+// the probe wouldn't match.
+func (m routeMatches) options(httpPath v1alpha1.HTTPIngressPath, path string) []envoy.RouteOption {
+	if httpPath.Headers[header.HashKey].Exact == header.HashValueOverride {
+		if matchType := m.pathTypes[path]; matchType != "" && matchType != config.PathMatchPrefix {
+			return []envoy.RouteOption{envoy.WithPathMatch("/", config.PathMatchPrefix)}
+		}
+		return nil
+	}
+
+	var opts []envoy.RouteOption
+	if matchType := m.pathTypes[path]; matchType != "" && matchType != config.PathMatchPrefix {
+		opts = append(opts, envoy.WithPathMatch(path, matchType))
+	}
+	if headers := m.headers[path]; len(headers) != 0 {
+		opts = append(opts, envoy.WithHeaderMatches(headers))
+	}
+	if queryParams := m.queryParams[path]; len(queryParams) != 0 {
+		opts = append(opts, envoy.WithQueryParameterMatches(queryParams))
+	}
+	return opts
+}
+
 func matchHeadersFromHTTPPath(httpPath v1alpha1.HTTPIngressPath) []*route.HeaderMatcher {
 	matchHeaders := make([]*route.HeaderMatcher, 0, len(httpPath.Headers))
 
-	for header, matchType := range httpPath.Headers {
+	// Walk the headers in a stable order, so the same path always yields the same
+	// route and thus the same snapshot version.
+	for _, header := range sets.List(sets.KeySet(httpPath.Headers)) {
+		matchType := httpPath.Headers[header]
 		matchHeader := &route.HeaderMatcher{
 			Name: header,
 		}
@@ -497,6 +838,12 @@ func matchHeadersFromHTTPPath(httpPath v1alpha1.HTTPIngressPath) []*route.Header
 					},
 				},
 			}
+		} else {
+			// Without a value to match, the header only has to be present. Say so
+			// explicitly rather than relying on Envoy's default.
+			matchHeader.HeaderMatchSpecifier = &route.HeaderMatcher_PresentMatch{
+				PresentMatch: true,
+			}
 		}
 		matchHeaders = append(matchHeaders, matchHeader)
 	}
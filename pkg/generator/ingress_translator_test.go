@@ -34,11 +34,13 @@ import (
 	"google.golang.org/protobuf/types/known/anypb"
 	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
 	envoy "knative.dev/net-kourier/pkg/envoy/api"
 	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
 	"knative.dev/networking/pkg/apis/networking"
@@ -97,6 +99,7 @@ func TestIngressTranslator(t *testing.T) {
 					Namespace: "simplens",
 					Name:      "simplename",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -115,6 +118,78 @@ func TestIngressTranslator(t *testing.T) {
 				localTLSVirtualHosts:    []*route.VirtualHost{},
 			}
 		}(),
+	}, {
+		name: "named target port",
+		in:   ing("simplens", "simplename"),
+		state: []runtime.Object{
+			svc("servicens", "servicename", func(service *corev1.Service) {
+				service.Spec.Ports[1].TargetPort = intstr.FromString("http-app")
+			}),
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Ports = []discoveryv1.EndpointPort{{
+					Name: ptr.To("http"),
+					Port: ptr.To(int32(9090)),
+				}}
+			}),
+		},
+		want: func() *translatedIngress {
+			vHosts := []*route.VirtualHost{
+				envoy.NewVirtualHost(
+					"(simplens/simplename).Rules[0]",
+					[]string{"foo.example.com", "foo.example.com:*"},
+					[]*route.Route{
+						envoy.NewRoute(
+							"(simplens/simplename).Rules[0].Paths[/test]",
+							[]*route.HeaderMatcher{{
+								Name: "testheader",
+								HeaderMatchSpecifier: &route.HeaderMatcher_StringMatch{
+									StringMatch: &envoymatcherv3.StringMatcher{
+										MatchPattern: &envoymatcherv3.StringMatcher_Exact{
+											Exact: "foo",
+										},
+									},
+								},
+							}},
+							"/test",
+							[]*route.WeightedCluster_ClusterWeight{
+								envoy.NewWeightedCluster("servicens/servicename", 100, map[string]string{"baz": "gna"}),
+							},
+							0,
+							map[string]string{"foo": "bar"},
+							"rewritten.example.com"),
+					},
+				),
+			}
+
+			return &translatedIngress{
+				name: types.NamespacedName{
+					Namespace: "simplens",
+					Name:      "simplename",
+				},
+				nodeID:             config.DefaultGatewayNodeID,
+				externalSNIMatches: []*envoy.SNIMatch{},
+				localSNIMatches:    []*envoy.SNIMatch{},
+				clusters: []*v3.Cluster{
+					envoy.NewCluster(
+						"servicens/servicename",
+						5*time.Second,
+						[]*endpoint.LbEndpoint{
+							envoy.NewLBEndpoint("2.2.2.2", 9090),
+							envoy.NewLBEndpoint("3.3.3.3", 9090),
+							envoy.NewLBEndpoint("4.4.4.4", 9090),
+							envoy.NewLBEndpoint("5.5.5.5", 9090),
+						},
+						false,
+						nil,
+						v3.Cluster_STATIC,
+					),
+				},
+				externalVirtualHosts:    vHosts,
+				externalTLSVirtualHosts: []*route.VirtualHost{},
+				localVirtualHosts:       vHosts,
+				localTLSVirtualHosts:    []*route.VirtualHost{},
+			}
+		}(),
 	}, {
 		name: "external-domain-tls",
 		in: ing("testspace", "testname", func(ing *v1alpha1.Ingress) {
@@ -163,6 +238,7 @@ func TestIngressTranslator(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID: config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{{
 					Hosts: []string{"foo.example.com"},
 					CertSource: types.NamespacedName{
@@ -239,6 +315,7 @@ func TestIngressTranslator(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID: config.DefaultGatewayNodeID,
 				localSNIMatches: []*envoy.SNIMatch{{
 					Hosts: []string{"foo.ns.svc.cluster.local", "foo.ns.svc", "foo.ns"},
 					CertSource: types.NamespacedName{
@@ -335,6 +412,7 @@ func TestIngressTranslator(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID: config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{{
 					Hosts: []string{"foo.example.com"},
 					CertSource: types.NamespacedName{
@@ -412,6 +490,7 @@ func TestIngressTranslator(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches: []*envoy.SNIMatch{{
 					Hosts: []string{"foo.example.com"},
@@ -536,6 +615,7 @@ func TestIngressTranslator(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -613,6 +693,7 @@ func TestIngressTranslator(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -674,6 +755,7 @@ func TestIngressTranslator(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -736,6 +818,7 @@ func TestIngressTranslator(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -777,8 +860,8 @@ func TestIngressTranslator(t *testing.T) {
 				func(_ string) ([]*corev1.ConfigMap, error) {
 					return getConfigmaps(ctx, kubeclient)
 				},
-				func(ns, name string) (*corev1.Endpoints, error) {
-					return kubeclient.CoreV1().Endpoints(ns).Get(ctx, name, metav1.GetOptions{})
+				func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+					return getEndpointSlices(ctx, kubeclient, ns, name)
 				},
 				func(ns, name string) (*corev1.Service, error) {
 					return kubeclient.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
@@ -875,6 +958,7 @@ func TestIngressTranslatorWithHTTPOptionDisabled(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID: config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{{
 					Hosts: []string{"foo.example.com"},
 					CertSource: types.NamespacedName{
@@ -952,6 +1036,7 @@ func TestIngressTranslatorWithHTTPOptionDisabled(t *testing.T) {
 					Namespace: "testspace",
 					Name:      "testname",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches: []*envoy.SNIMatch{{
 					Hosts: []string{"foo.example.com"},
@@ -994,8 +1079,8 @@ func TestIngressTranslatorWithHTTPOptionDisabled(t *testing.T) {
 				func(_ string) ([]*corev1.ConfigMap, error) {
 					return getConfigmaps(ctx, kubeclient)
 				},
-				func(ns, name string) (*corev1.Endpoints, error) {
-					return kubeclient.CoreV1().Endpoints(ns).Get(ctx, name, metav1.GetOptions{})
+				func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+					return getEndpointSlices(ctx, kubeclient, ns, name)
 				},
 				func(ns, name string) (*corev1.Service, error) {
 					return kubeclient.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
@@ -1065,6 +1150,7 @@ func TestIngressTranslatorWithUpstreamTLS(t *testing.T) {
 					Namespace: "simplens",
 					Name:      "simplename",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -1140,6 +1226,7 @@ func TestIngressTranslatorWithUpstreamTLS(t *testing.T) {
 					Namespace: "simplens",
 					Name:      "simplename",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -1216,6 +1303,7 @@ func TestIngressTranslatorWithUpstreamTLS(t *testing.T) {
 					Namespace: "simplens",
 					Name:      "simplename",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -1292,6 +1380,7 @@ func TestIngressTranslatorWithUpstreamTLS(t *testing.T) {
 					Namespace: "simplens",
 					Name:      "simplename",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -1359,6 +1448,7 @@ func TestIngressTranslatorWithUpstreamTLS(t *testing.T) {
 					Namespace: "simplens",
 					Name:      "simplename",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -1430,6 +1520,7 @@ func TestIngressTranslatorWithUpstreamTLS(t *testing.T) {
 					Namespace: "simplens",
 					Name:      "simplename",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -1501,8 +1592,8 @@ func TestIngressTranslatorWithUpstreamTLS(t *testing.T) {
 				func(_ string) ([]*corev1.ConfigMap, error) {
 					return getConfigmaps(ctx, kubeclient)
 				},
-				func(ns, name string) (*corev1.Endpoints, error) {
-					return kubeclient.CoreV1().Endpoints(ns).Get(ctx, name, metav1.GetOptions{})
+				func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+					return getEndpointSlices(ctx, kubeclient, ns, name)
 				},
 				func(ns, name string) (*corev1.Service, error) {
 					return kubeclient.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
@@ -1520,6 +1611,161 @@ func TestIngressTranslatorWithUpstreamTLS(t *testing.T) {
 	}
 }
 
+func TestLocalityLbEndpointsForEndpointSlices(t *testing.T) {
+	tests := []struct {
+		name        string
+		slices      []*discoveryv1.EndpointSlice
+		addressType discoveryv1.AddressType
+		want        []*endpoint.LbEndpoint
+	}{{
+		name:        "merges all slices of a service",
+		addressType: discoveryv1.AddressTypeIPv4,
+		slices: []*discoveryv1.EndpointSlice{
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Endpoints = slice.Endpoints[:2]
+			}),
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Name = "servicename-fghij"
+				slice.Endpoints = slice.Endpoints[2:]
+			}),
+		},
+		want: lbEndpoints,
+	}, {
+		name:        "deduplicates endpoints across slices",
+		addressType: discoveryv1.AddressTypeIPv4,
+		slices: []*discoveryv1.EndpointSlice{
+			eps("servicens", "servicename"),
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Name = "servicename-fghij"
+			}),
+		},
+		want: lbEndpoints,
+	}, {
+		name:        "skips endpoints that are not ready",
+		addressType: discoveryv1.AddressTypeIPv4,
+		slices: []*discoveryv1.EndpointSlice{
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Endpoints[0].Conditions.Ready = ptr.To(false)
+				slice.Endpoints[1].Conditions = discoveryv1.EndpointConditions{
+					Ready:       ptr.To(false),
+					Serving:     ptr.To(true),
+					Terminating: ptr.To(true),
+				}
+			}),
+		},
+		want: lbEndpoints[2:],
+	}, {
+		name:        "falls back to serving terminating endpoints",
+		addressType: discoveryv1.AddressTypeIPv4,
+		slices: []*discoveryv1.EndpointSlice{
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				for i := range slice.Endpoints {
+					slice.Endpoints[i].Conditions = discoveryv1.EndpointConditions{
+						Ready:       ptr.To(false),
+						Serving:     ptr.To(i%2 == 0),
+						Terminating: ptr.To(true),
+					}
+				}
+			}),
+		},
+		want: []*endpoint.LbEndpoint{lbEndpoints[0], lbEndpoints[2]},
+	}, {
+		name:        "ignores slices of other address types",
+		addressType: discoveryv1.AddressTypeIPv6,
+		slices: []*discoveryv1.EndpointSlice{
+			eps("servicens", "servicename"),
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Name = "servicename-fghij"
+				slice.AddressType = discoveryv1.AddressTypeIPv6
+				slice.Endpoints = []discoveryv1.Endpoint{{
+					Addresses: []string{"2001:db8::1"},
+				}}
+			}),
+		},
+		want: []*endpoint.LbEndpoint{envoy.NewLBEndpoint("2001:db8::1", 8080)},
+	}, {
+		name:        "resolves ports per slice",
+		addressType: discoveryv1.AddressTypeIPv4,
+		slices: []*discoveryv1.EndpointSlice{
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Endpoints = slice.Endpoints[:2]
+				slice.Ports = []discoveryv1.EndpointPort{{
+					Name: ptr.To("foo"),
+					Port: ptr.To(int32(1338)),
+				}, {
+					Name: ptr.To("http"),
+					Port: ptr.To(int32(9090)),
+				}}
+			}),
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Name = "servicename-fghij"
+				slice.Endpoints = slice.Endpoints[2:]
+				slice.Ports = []discoveryv1.EndpointPort{{
+					Name: ptr.To("http"),
+					Port: ptr.To(int32(9091)),
+				}}
+			}),
+		},
+		want: []*endpoint.LbEndpoint{
+			envoy.NewLBEndpoint("2.2.2.2", 9090),
+			envoy.NewLBEndpoint("3.3.3.3", 9090),
+			envoy.NewLBEndpoint("4.4.4.4", 9091),
+			envoy.NewLBEndpoint("5.5.5.5", 9091),
+		},
+	}, {
+		name:        "skips slices not serving the port",
+		addressType: discoveryv1.AddressTypeIPv4,
+		slices: []*discoveryv1.EndpointSlice{
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Ports = []discoveryv1.EndpointPort{{
+					Name: ptr.To("foo"),
+					Port: ptr.To(int32(1338)),
+				}}
+			}),
+		},
+	}, {
+		name:        "no ready endpoints",
+		addressType: discoveryv1.AddressTypeIPv4,
+		slices: []*discoveryv1.EndpointSlice{
+			eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+				slice.Endpoints = nil
+			}),
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := lbEndpointsForLocalities(localityLbEndpointsForEndpointSlices(test.slices, test.addressType, "http", 8080))
+			assert.DeepEqual(t, got, test.want, protocmp.Transform())
+		})
+	}
+}
+
+func TestLocalityLbEndpointsGroupedByZone(t *testing.T) {
+	slices := []*discoveryv1.EndpointSlice{
+		eps("servicens", "servicename", func(slice *discoveryv1.EndpointSlice) {
+			slice.Endpoints[0].Zone = ptr.To("zone-b")
+			slice.Endpoints[1].Zone = ptr.To("zone-a")
+			slice.Endpoints[2].Zone = ptr.To("zone-b")
+		}),
+	}
+
+	got := localityLbEndpointsForEndpointSlices(slices, discoveryv1.AddressTypeIPv4, "http", 8080)
+	want := []*endpoint.LocalityLbEndpoints{{
+		LbEndpoints: []*endpoint.LbEndpoint{envoy.NewLBEndpoint("5.5.5.5", 8080)},
+	}, {
+		Locality:    &envoycorev3.Locality{Zone: "zone-a"},
+		LbEndpoints: []*endpoint.LbEndpoint{envoy.NewLBEndpoint("3.3.3.3", 8080)},
+	}, {
+		Locality: &envoycorev3.Locality{Zone: "zone-b"},
+		LbEndpoints: []*endpoint.LbEndpoint{
+			envoy.NewLBEndpoint("2.2.2.2", 8080),
+			envoy.NewLBEndpoint("4.4.4.4", 8080),
+		},
+	}}
+	assert.DeepEqual(t, got, want, protocmp.Transform())
+}
+
 func TestIngressTranslatorHTTP01Challenge(t *testing.T) {
 	test := struct {
 		name  string
@@ -1536,11 +1782,9 @@ func TestIngressTranslatorHTTP01Challenge(t *testing.T) {
 					TargetPort: intstr.FromInt(8089),
 				}}
 			}),
-			eps("simplens", "cm-acme-http-solver", func(endpoint *corev1.Endpoints) {
-				endpoint.Subsets = []corev1.EndpointSubset{{
-					Addresses: []corev1.EndpointAddress{{
-						IP: "2.2.2.2",
-					}},
+			eps("simplens", "cm-acme-http-solver", func(slice *discoveryv1.EndpointSlice) {
+				slice.Endpoints = []discoveryv1.Endpoint{{
+					Addresses: []string{"2.2.2.2"},
 				}}
 			}),
 		},
@@ -1570,6 +1814,7 @@ func TestIngressTranslatorHTTP01Challenge(t *testing.T) {
 					Namespace: "simplens",
 					Name:      "simplename",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
@@ -1604,8 +1849,8 @@ func TestIngressTranslatorHTTP01Challenge(t *testing.T) {
 			func(_ string) ([]*corev1.ConfigMap, error) {
 				return getConfigmaps(ctx, kubeclient)
 			},
-			func(ns, name string) (*corev1.Endpoints, error) {
-				return kubeclient.CoreV1().Endpoints(ns).Get(ctx, name, metav1.GetOptions{})
+			func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+				return getEndpointSlices(ctx, kubeclient, ns, name)
 			},
 			func(ns, name string) (*corev1.Service, error) {
 				return kubeclient.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
@@ -1650,6 +1895,8 @@ func TestIngressTranslatorDomainMappingDisableHTTP2(t *testing.T) {
 			caSecret,
 		},
 		want: func() *translatedIngress {
+			// Forcing HTTP/1 gives the ingress a cluster of its own.
+			const clusterName = "servicens/servicename/9320a7bf"
 			vHosts := []*route.VirtualHost{
 				envoy.NewVirtualHost(
 					"(simplens/simplename).Rules[0]",
@@ -1669,7 +1916,7 @@ func TestIngressTranslatorDomainMappingDisableHTTP2(t *testing.T) {
 							}},
 							"/test",
 							[]*route.WeightedCluster_ClusterWeight{
-								envoy.NewWeightedCluster("servicens/servicename", 100, map[string]string{"baz": "gna"}),
+								envoy.NewWeightedCluster(clusterName, 100, map[string]string{"baz": "gna"}),
 							},
 							0,
 							map[string]string{"foo": "bar"},
@@ -1683,11 +1930,12 @@ func TestIngressTranslatorDomainMappingDisableHTTP2(t *testing.T) {
 					Namespace: "simplens",
 					Name:      "simplename",
 				},
+				nodeID:             config.DefaultGatewayNodeID,
 				externalSNIMatches: []*envoy.SNIMatch{},
 				localSNIMatches:    []*envoy.SNIMatch{},
 				clusters: []*v3.Cluster{
 					envoy.NewCluster(
-						"servicens/servicename",
+						clusterName,
 						5*time.Second,
 						[]*endpoint.LbEndpoint{
 							envoy.NewLBEndpoint("kourier-internal.kourier-system.svc.cluster.local", 80),
@@ -1718,8 +1966,8 @@ func TestIngressTranslatorDomainMappingDisableHTTP2(t *testing.T) {
 			func(_ string) ([]*corev1.ConfigMap, error) {
 				return getConfigmaps(ctx, kubeclient)
 			},
-			func(ns, name string) (*corev1.Endpoints, error) {
-				return kubeclient.CoreV1().Endpoints(ns).Get(ctx, name, metav1.GetOptions{})
+			func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+				return getEndpointSlices(ctx, kubeclient, ns, name)
 			},
 			func(ns, name string) (*corev1.Service, error) {
 				return kubeclient.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
@@ -1736,6 +1984,165 @@ func TestIngressTranslatorDomainMappingDisableHTTP2(t *testing.T) {
 	})
 }
 
+func TestIngressTranslatorUpstreamProtocol(t *testing.T) {
+	h2c, grpc, http := "kubernetes.io/h2c", "grpc", "http"
+
+	tests := []struct {
+		name        string
+		ports       []corev1.ServicePort
+		servicePort intstr.IntOrString
+		annotations map[string]string
+		want        bool
+		wantErr     bool
+	}{{
+		name:        "http",
+		ports:       []corev1.ServicePort{{Name: "http", Port: 80}},
+		servicePort: intstr.FromInt(80),
+	}, {
+		name:        "named http2",
+		ports:       []corev1.ServicePort{{Name: "http2", Port: 80}},
+		servicePort: intstr.FromInt(80),
+		want:        true,
+	}, {
+		name:        "named h2c",
+		ports:       []corev1.ServicePort{{Name: "h2c", Port: 80}},
+		servicePort: intstr.FromString("h2c"),
+		want:        true,
+	}, {
+		name:        "only the selected port counts",
+		ports:       []corev1.ServicePort{{Name: "http", Port: 80}, {Name: "http2", Port: 81}},
+		servicePort: intstr.FromInt(80),
+	}, {
+		name:        "https port shares the protocol of the plain text port",
+		ports:       []corev1.ServicePort{{Name: "http2", Port: 80}, {Name: "https", Port: 443}},
+		servicePort: intstr.FromInt(443),
+		want:        true,
+	}, {
+		name:        "appProtocol h2c",
+		ports:       []corev1.ServicePort{{Name: "web", Port: 80, AppProtocol: &h2c}},
+		servicePort: intstr.FromInt(80),
+		want:        true,
+	}, {
+		name:        "appProtocol grpc",
+		ports:       []corev1.ServicePort{{Name: "web", Port: 80, AppProtocol: &grpc}},
+		servicePort: intstr.FromInt(80),
+		want:        true,
+	}, {
+		name:        "appProtocol http takes precedence over the name",
+		ports:       []corev1.ServicePort{{Name: "http2", Port: 80, AppProtocol: &http}},
+		servicePort: intstr.FromInt(80),
+	}, {
+		name:        "no port selected",
+		ports:       []corev1.ServicePort{{Name: "http2", Port: 81}},
+		servicePort: intstr.FromInt(80),
+	}, {
+		name:        "forced http2",
+		ports:       []corev1.ServicePort{{Name: "http", Port: 80}},
+		servicePort: intstr.FromInt(80),
+		annotations: map[string]string{"kourier.knative.dev/upstream-protocol": "http2"},
+		want:        true,
+	}, {
+		name:        "forced http1",
+		ports:       []corev1.ServicePort{{Name: "web", Port: 80, AppProtocol: &grpc}},
+		servicePort: intstr.FromInt(80),
+		annotations: map[string]string{"kourier.knative.dev/upstream-protocol": "http1"},
+	}, {
+		name:        "disabled http2",
+		ports:       []corev1.ServicePort{{Name: "http2", Port: 80}},
+		servicePort: intstr.FromInt(80),
+		annotations: map[string]string{"kourier.knative.dev/disable-http2": "true"},
+	}, {
+		name:        "contradicting annotations",
+		ports:       []corev1.ServicePort{{Name: "http2", Port: 80}},
+		servicePort: intstr.FromInt(80),
+		annotations: map[string]string{
+			"kourier.knative.dev/disable-http2":     "true",
+			"kourier.knative.dev/upstream-protocol": "http2",
+		},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := (&testConfigStore{config: defaultConfig.DeepCopy()}).ToContext(context.Background())
+
+			translator := newTestIngressTranslator(ctx,
+				svc("servicens", "servicename", func(service *corev1.Service) {
+					service.Spec.Ports = test.ports
+				}),
+				eps("servicens", "servicename"),
+			)
+
+			got, err := translator.translateIngress(ctx, ing("testspace", "testname", func(ing *v1alpha1.Ingress) {
+				ing.Annotations = test.annotations
+				ing.Spec.Rules[0].HTTP.Paths[0].Splits[0].ServicePort = test.servicePort
+			}), false)
+			if test.wantErr {
+				assert.Assert(t, err != nil)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, len(got.clusters), 1)
+			http2 := got.clusters[0].TypedExtensionProtocolOptions["envoy.extensions.upstreams.http.v3.HttpProtocolOptions"] != nil
+			assert.Equal(t, http2, test.want)
+		})
+	}
+}
+
+// TestIngressTranslatorInvalidAnnotations covers that an ingress with an invalid
+// annotation isn't translated, whichever feature the annotation configures.
+func TestIngressTranslatorInvalidAnnotations(t *testing.T) {
+	tests := map[string]map[string]string{
+		"path match":        {"kourier.knative.dev/path-match": `{"/test/": "path-separated-prefix"}`},
+		"header match":      {"kourier.knative.dev/header-match": `{"/test": [{"name": "x-canary"}]}`},
+		"query match":       {"kourier.knative.dev/query-match": `{"/test": "canary"}`},
+		"timeout":           {"kourier.knative.dev/route-timeout": "ten minutes"},
+		"retry policy":      {"kourier.knative.dev/retry-on": "sometimes"},
+		"outlier detection": {"kourier.knative.dev/outlier-detection-interval": "often"},
+		"circuit breakers":  {"kourier.knative.dev/circuit-breaker-max-requests": "unlimited"},
+		"health check":      {"kourier.knative.dev/health-check-type": "tcp"},
+		"session affinity": {
+			"kourier.knative.dev/lb-policy":        "round-robin",
+			"kourier.knative.dev/session-affinity": "cookie",
+		},
+		"connection pool":   {"kourier.knative.dev/upstream-connect-timeout": "soon"},
+		"upstream protocol": {"kourier.knative.dev/upstream-protocol": "http3"},
+	}
+
+	for name, annotations := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := (&testConfigStore{config: defaultConfig.DeepCopy()}).ToContext(context.Background())
+			translator := newTestIngressTranslator(ctx, svc("servicens", "servicename"), eps("servicens", "servicename"))
+
+			got, err := translator.translateIngress(ctx, ing("testspace", "testname", func(ing *v1alpha1.Ingress) {
+				ing.Annotations = annotations
+			}), false)
+			assert.Assert(t, err != nil)
+			assert.Assert(t, got == nil)
+		})
+	}
+}
+
+// newTestIngressTranslator returns a translator reading the given objects.
+func newTestIngressTranslator(ctx context.Context, objects ...runtime.Object) IngressTranslator {
+	kubeclient := fake.NewSimpleClientset(objects...)
+	return NewIngressTranslator(
+		func(ns, name string) (*corev1.Secret, error) {
+			return kubeclient.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(_ string) ([]*corev1.ConfigMap, error) {
+			return getConfigmaps(ctx, kubeclient)
+		},
+		func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+			return getEndpointSlices(ctx, kubeclient, ns, name)
+		},
+		func(ns, name string) (*corev1.Service, error) {
+			return kubeclient.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
+		},
+		&pkgtest.FakeTracker{},
+	)
+}
+
 func ing(ns, name string, opts ...func(*v1alpha1.Ingress)) *v1alpha1.Ingress {
 	ingress := &v1alpha1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
@@ -1812,32 +2219,46 @@ func svc(ns, name string, opts ...func(*corev1.Service)) *corev1.Service {
 	return service
 }
 
-func eps(ns, name string, opts ...func(endpoint *corev1.Endpoints)) *corev1.Endpoints {
-	serviceEndpoint := &corev1.Endpoints{
+func eps(ns, name string, opts ...func(slice *discoveryv1.EndpointSlice)) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: ns,
-			Name:      name,
+			Name:      name + "-abcde",
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: name,
+			},
 		},
-		Subsets: []corev1.EndpointSubset{{
-			Addresses: []corev1.EndpointAddress{{
-				IP: "2.2.2.2",
-			}, {
-				IP: "3.3.3.3",
-			}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{{
+			Addresses: []string{"2.2.2.2"},
 		}, {
-			Addresses: []corev1.EndpointAddress{{
-				IP: "4.4.4.4",
-			}, {
-				IP: "5.5.5.5",
-			}},
+			Addresses: []string{"3.3.3.3"},
+		}, {
+			Addresses: []string{"4.4.4.4"},
+		}, {
+			Addresses: []string{"5.5.5.5"},
 		}},
 	}
 
 	for _, opt := range opts {
-		opt(serviceEndpoint)
+		opt(slice)
 	}
 
-	return serviceEndpoint
+	return slice
+}
+
+func getEndpointSlices(ctx context.Context, kubeclient *fake.Clientset, ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+	slices, err := kubeclient.DiscoveryV1().EndpointSlices(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*discoveryv1.EndpointSlice, 0, len(slices.Items))
+	for i := range slices.Items {
+		result = append(result, &slices.Items[i])
+	}
+	return result, nil
 }
 
 func ingHTTP01Challenge(ns, name string, opts ...func(*v1alpha1.Ingress)) *v1alpha1.Ingress {
@@ -0,0 +1,102 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"context"
+	"time"
+
+	cachetypes "github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"knative.dev/pkg/observability/attributekey"
+)
+
+const scopeName = "knative.dev/net-kourier/pkg/generator"
+
+var (
+	// nodeIDAttr is the node ID of the fleet of gateways a snapshot is built for.
+	nodeIDAttr = attributekey.String("kn.kourier.node_id")
+	// resourceTypeAttr is the type URL of the resources in a snapshot.
+	resourceTypeAttr = attributekey.String("kn.kourier.resource.type")
+)
+
+type metrics struct {
+	snapshotBuildDuration metric.Float64Histogram
+	snapshotResources     metric.Int64Gauge
+	ingresses             metric.Int64Gauge
+	domainConflicts       metric.Int64Counter
+}
+
+func newMetrics(provider metric.MeterProvider) *metrics {
+	var (
+		m   metrics
+		err error
+	)
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+	meter := provider.Meter(scopeName)
+
+	m.snapshotBuildDuration, err = meter.Float64Histogram(
+		"kn.kourier.snapshot.build.duration",
+		metric.WithDescription("The duration of building the snapshot of a fleet of gateways."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	m.snapshotResources, err = meter.Int64Gauge(
+		"kn.kourier.snapshot.resources",
+		metric.WithDescription("The number of resources of a type in the last snapshot built for a fleet of gateways."),
+		metric.WithUnit("{resource}"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	m.ingresses, err = meter.Int64Gauge(
+		"kn.kourier.ingresses",
+		metric.WithDescription("The number of translated ingresses in the last snapshot built for a fleet of gateways."),
+		metric.WithUnit("{ingress}"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	m.domainConflicts, err = meter.Int64Counter(
+		"kn.kourier.domain.conflicts",
+		metric.WithDescription("The number of times an ingress was not added because of a domain conflict with another ingress."),
+		metric.WithUnit("{conflict}"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &m
+}
+
+func (m *metrics) recordSnapshot(ctx context.Context, nodeID string, d time.Duration, ingresses int, resources map[string][]cachetypes.Resource) {
+	node := metric.WithAttributes(nodeIDAttr.With(nodeID))
+	m.snapshotBuildDuration.Record(ctx, d.Seconds(), node)
+	m.ingresses.Record(ctx, int64(ingresses), node)
+	for typeURL, rs := range resources {
+		m.snapshotResources.Record(ctx, int64(len(rs)), metric.WithAttributes(nodeIDAttr.With(nodeID), resourceTypeAttr.With(typeURL)))
+	}
+}
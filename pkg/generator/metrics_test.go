@@ -0,0 +1,98 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
+)
+
+func TestCachesMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	ctx := config.ToContext(context.Background(), config.FromContextOrDefaults(context.Background()))
+
+	caches, err := NewCaches(ctx, &fake.Clientset{}, nil)
+	assert.NilError(t, err)
+	caches.metrics = newMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	ingress := func(name string) *translatedIngress {
+		return &translatedIngress{
+			name:              types.NamespacedName{Namespace: "ns", Name: name},
+			nodeID:            config.DefaultGatewayNodeID,
+			clusters:          []*v3.Cluster{{Name: "cluster_for_" + name}},
+			localVirtualHosts: []*route.VirtualHost{{Name: name, Domains: []string{"conflicting.example.com"}}},
+		}
+	}
+	assert.NilError(t, caches.UpdateIngress(ctx, ingress("foo")))
+	assert.Assert(t, errors.Is(caches.UpdateIngress(ctx, ingress("bar")), ErrDomainConflict))
+
+	_, err = caches.ToEnvoySnapshots(ctx)
+	assert.NilError(t, err)
+
+	var rm metricdata.ResourceMetrics
+	assert.NilError(t, reader.Collect(ctx, &rm))
+	node := nodeIDAttr.With(config.DefaultGatewayNodeID)
+
+	conflicts := findMetric(t, rm, "kn.kourier.domain.conflicts").(metricdata.Sum[int64])
+	assert.Equal(t, conflicts.DataPoints[0].Value, int64(1))
+
+	ingresses := findMetric(t, rm, "kn.kourier.ingresses").(metricdata.Gauge[int64])
+	assert.Equal(t, len(ingresses.DataPoints), 1)
+	assert.Equal(t, ingresses.DataPoints[0].Value, int64(1))
+	nodeSet := attribute.NewSet(node)
+	assert.Assert(t, ingresses.DataPoints[0].Attributes.Equals(&nodeSet))
+
+	resources := findMetric(t, rm, "kn.kourier.snapshot.resources").(metricdata.Gauge[int64])
+	clusters := attribute.NewSet(node, resourceTypeAttr.With(resource.ClusterType))
+	found := false
+	for _, dp := range resources.DataPoints {
+		if dp.Attributes.Equals(&clusters) {
+			found = true
+			assert.Equal(t, dp.Value, int64(1))
+		}
+	}
+	assert.Assert(t, found)
+
+	buildDuration := findMetric(t, rm, "kn.kourier.snapshot.build.duration").(metricdata.Histogram[float64])
+	assert.Equal(t, buildDuration.DataPoints[0].Count, uint64(1))
+}
+
+func findMetric(t *testing.T, rm metricdata.ResourceMetrics, name string) metricdata.Aggregation {
+	t.Helper()
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	t.Fatalf("metric %q not found", name)
+	return nil
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package generator
 
 import (
+	"sort"
+
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	envoy "knative.dev/net-kourier/pkg/envoy/api"
@@ -65,5 +67,9 @@ func (s sniMatches) list() []*envoy.SNIMatch {
 	for _, match := range s {
 		matches = append(matches, match.sniMatch)
 	}
+	// Sort for a stable order, as the matches end up in the generated listeners.
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CertSource.String() < matches[j].CertSource.String()
+	})
 	return matches
 }
@@ -0,0 +1,42 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+
+	cm "knative.dev/pkg/configmap"
+)
+
+// annotationPrefix prefixes the config map keys to get the annotations overriding
+// them for an Ingress. The keys of config-kourier configure the default of all
+// Ingresses, and the annotation with the same name, prefixed by annotationPrefix,
+// overrides the key for the routes and clusters of an Ingress.
+const annotationPrefix = "kourier.knative.dev/"
+
+// forIngress returns the settings of an Ingress with the given annotations, parsed
+// by parse from the keys with annotationPrefix. Settings not annotated are taken
+// from defaults, so parsers must replace the slices of defaults rather than modify
+// them. It returns an error if an annotation is malformed or the resulting
+// settings are invalid.
+func forIngress[T any](annotations map[string]string, defaults T, parse func(prefix string, target *T) cm.ParseFunc) (T, error) {
+	settings := defaults
+	if err := parse(annotationPrefix, &settings)(annotations); err != nil {
+		return defaults, fmt.Errorf("invalid annotation: %w", err)
+	}
+	return settings, nil
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+type annotationsTest struct {
+	name        string
+	annotations map[string]string
+	want        any
+	wantErr     string
+}
+
+func TestForIngress(t *testing.T) {
+	tests := []struct {
+		name       string
+		forIngress func(annotations map[string]string) (any, error)
+		defaults   any
+		// overridden annotates every key and want is the result.
+		overridden map[string]string
+		want       any
+		// malformed is an annotation that doesn't parse.
+		malformed map[string]string
+		// more are the cases specific to the settings.
+		more []annotationsTest
+	}{{
+		name: "circuit breakers",
+		forIngress: func(annotations map[string]string) (any, error) {
+			return CircuitBreakersForIngress(annotations, CircuitBreakers{MaxConnections: 100})
+		},
+		defaults: CircuitBreakers{MaxConnections: 100},
+		overridden: map[string]string{
+			"kourier.knative.dev/circuit-breaker-max-connections":      "10",
+			"kourier.knative.dev/circuit-breaker-max-pending-requests": "20",
+			"kourier.knative.dev/circuit-breaker-max-requests":         "30",
+			"kourier.knative.dev/circuit-breaker-max-retries":          "4",
+		},
+		want: CircuitBreakers{
+			MaxConnections:     10,
+			MaxPendingRequests: 20,
+			MaxRequests:        30,
+			MaxRetries:         4,
+		},
+		malformed: map[string]string{"kourier.knative.dev/circuit-breaker-max-retries": "-1"},
+		more: []annotationsTest{{
+			name:        "reset to Envoy's default",
+			annotations: map[string]string{"kourier.knative.dev/circuit-breaker-max-connections": "0"},
+			want:        CircuitBreakers{},
+		}},
+	}, {
+		name: "connection pool",
+		forIngress: func(annotations map[string]string) (any, error) {
+			return ConnectionPoolForIngress(annotations, ConnectionPool{ConnectTimeout: 2 * time.Second, IdleTimeout: time.Minute})
+		},
+		defaults: ConnectionPool{ConnectTimeout: 2 * time.Second, IdleTimeout: time.Minute},
+		overridden: map[string]string{
+			"kourier.knative.dev/upstream-connect-timeout":              "30s",
+			"kourier.knative.dev/upstream-max-requests-per-connection":  "1000",
+			"kourier.knative.dev/upstream-idle-timeout":                 "5m",
+			"kourier.knative.dev/upstream-http2-max-concurrent-streams": "100",
+		},
+		want: ConnectionPool{
+			ConnectTimeout:            30 * time.Second,
+			MaxRequestsPerConnection:  1000,
+			IdleTimeout:               5 * time.Minute,
+			HTTP2MaxConcurrentStreams: 100,
+		},
+		malformed: map[string]string{"kourier.knative.dev/upstream-http2-max-concurrent-streams": "many"},
+		more: []annotationsTest{{
+			name:        "negative timeout",
+			annotations: map[string]string{"kourier.knative.dev/upstream-connect-timeout": "-1s"},
+			wantErr:     "must not be negative",
+		}},
+	}, {
+		name: "health check",
+		forIngress: func(annotations map[string]string) (any, error) {
+			return HealthCheckForIngress(annotations, HealthCheck{Type: HealthCheckHTTP, Interval: 5 * time.Second})
+		},
+		defaults: HealthCheck{Type: HealthCheckHTTP, Interval: 5 * time.Second},
+		overridden: map[string]string{
+			"kourier.knative.dev/health-check-path":                "/ready",
+			"kourier.knative.dev/health-check-interval":            "2s",
+			"kourier.knative.dev/health-check-timeout":             "500ms",
+			"kourier.knative.dev/health-check-healthy-threshold":   "2",
+			"kourier.knative.dev/health-check-unhealthy-threshold": "4",
+		},
+		want: HealthCheck{
+			Type:               HealthCheckHTTP,
+			Path:               "/ready",
+			Interval:           2 * time.Second,
+			Timeout:            500 * time.Millisecond,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 4,
+		},
+		malformed: map[string]string{"kourier.knative.dev/health-check-healthy-threshold": "twice"},
+		more: []annotationsTest{{
+			name: "grpc",
+			annotations: map[string]string{
+				"kourier.knative.dev/health-check-type":              "grpc",
+				"kourier.knative.dev/health-check-grpc-service-name": "orders",
+			},
+			want: HealthCheck{
+				Type:            HealthCheckGRPC,
+				GRPCServiceName: "orders",
+				Interval:        5 * time.Second,
+			},
+		}, {
+			name:        "disabled",
+			annotations: map[string]string{"kourier.knative.dev/health-check-type": ""},
+			want:        HealthCheck{Interval: 5 * time.Second},
+		}, {
+			name:        "unknown type",
+			annotations: map[string]string{"kourier.knative.dev/health-check-type": "tcp"},
+			wantErr:     `"tcp" is invalid`,
+		}, {
+			name:        "relative path",
+			annotations: map[string]string{"kourier.knative.dev/health-check-path": "ready"},
+			wantErr:     "must start with /",
+		}},
+	}, {
+		name: "outlier detection",
+		forIngress: func(annotations map[string]string) (any, error) {
+			return OutlierDetectionForIngress(annotations, OutlierDetection{Consecutive5xx: 5, BaseEjectionTime: 30 * time.Second})
+		},
+		defaults: OutlierDetection{Consecutive5xx: 5, BaseEjectionTime: 30 * time.Second},
+		overridden: map[string]string{
+			"kourier.knative.dev/outlier-detection-consecutive-5xx":      "3",
+			"kourier.knative.dev/outlier-detection-interval":             "5s",
+			"kourier.knative.dev/outlier-detection-base-ejection-time":   "1m",
+			"kourier.knative.dev/outlier-detection-max-ejection-percent": "50",
+		},
+		want: OutlierDetection{
+			Consecutive5xx:     3,
+			Interval:           5 * time.Second,
+			BaseEjectionTime:   time.Minute,
+			MaxEjectionPercent: 50,
+		},
+		malformed: map[string]string{"kourier.knative.dev/outlier-detection-interval": "often"},
+		more: []annotationsTest{{
+			name:        "disabled",
+			annotations: map[string]string{"kourier.knative.dev/outlier-detection-consecutive-5xx": "0"},
+			want:        OutlierDetection{BaseEjectionTime: 30 * time.Second},
+		}, {
+			name:        "ejection percent above 100",
+			annotations: map[string]string{"kourier.knative.dev/outlier-detection-max-ejection-percent": "150"},
+			wantErr:     "must be at most 100",
+		}},
+	}, {
+		name: "retry policy",
+		forIngress: func(annotations map[string]string) (any, error) {
+			return RetryPolicyForIngress(annotations, RetryPolicy{RetryOn: []string{"reset", "connect-failure"}, NumRetries: 2})
+		},
+		defaults: RetryPolicy{RetryOn: []string{"reset", "connect-failure"}, NumRetries: 2},
+		overridden: map[string]string{
+			"kourier.knative.dev/retry-on":                    "5xx, retriable-status-codes",
+			"kourier.knative.dev/retry-num-retries":           "3",
+			"kourier.knative.dev/retry-per-try-timeout":       "2s",
+			"kourier.knative.dev/retry-status-codes":          "409,429",
+			"kourier.knative.dev/retry-backoff-base-interval": "50ms",
+			"kourier.knative.dev/retry-backoff-max-interval":  "1s",
+		},
+		want: RetryPolicy{
+			RetryOn:              []string{"5xx", "retriable-status-codes"},
+			NumRetries:           3,
+			PerTryTimeout:        2 * time.Second,
+			RetriableStatusCodes: []uint32{409, 429},
+			BackoffBaseInterval:  50 * time.Millisecond,
+			BackoffMaxInterval:   time.Second,
+		},
+		malformed: map[string]string{"kourier.knative.dev/retry-num-retries": "many"},
+		more: []annotationsTest{{
+			name:        "disabled",
+			annotations: map[string]string{"kourier.knative.dev/retry-on": ""},
+			want:        RetryPolicy{NumRetries: 2},
+		}, {
+			name:        "unknown condition",
+			annotations: map[string]string{"kourier.knative.dev/retry-on": "5xx,timeout"},
+			wantErr:     `unknown condition "timeout"`,
+		}, {
+			name:        "invalid status code",
+			annotations: map[string]string{"kourier.knative.dev/retry-status-codes": "42"},
+			wantErr:     `invalid status code "42"`,
+		}, {
+			name:        "status codes without condition",
+			annotations: map[string]string{"kourier.knative.dev/retry-status-codes": "503"},
+			wantErr:     "require the retriable-status-codes condition",
+		}, {
+			name:        "max interval without base interval",
+			annotations: map[string]string{"kourier.knative.dev/retry-backoff-max-interval": "1s"},
+			wantErr:     "requires a base interval",
+		}, {
+			name: "max interval less than base interval",
+			annotations: map[string]string{
+				"kourier.knative.dev/retry-backoff-base-interval": "1s",
+				"kourier.knative.dev/retry-backoff-max-interval":  "100ms",
+			},
+			wantErr: "must not be less than the base interval",
+		}},
+	}, {
+		name: "route timeouts",
+		forIngress: func(annotations map[string]string) (any, error) {
+			return RouteTimeoutsForIngress(annotations, RouteTimeouts{Timeout: time.Minute, IdleTimeout: 10 * time.Second})
+		},
+		defaults: RouteTimeouts{Timeout: time.Minute, IdleTimeout: 10 * time.Second},
+		overridden: map[string]string{
+			"kourier.knative.dev/route-timeout":      "1h",
+			"kourier.knative.dev/route-idle-timeout": "5m",
+		},
+		want:      RouteTimeouts{Timeout: time.Hour, IdleTimeout: 5 * time.Minute},
+		malformed: map[string]string{"kourier.knative.dev/route-timeout": "10"},
+		more: []annotationsTest{{
+			name:        "timeout disabled",
+			annotations: map[string]string{"kourier.knative.dev/route-timeout": "0s"},
+			want:        RouteTimeouts{Timeout: 0, IdleTimeout: 10 * time.Second},
+		}, {
+			name:        "negative",
+			annotations: map[string]string{"kourier.knative.dev/route-idle-timeout": "-1s"},
+			wantErr:     "must not be negative",
+		}},
+	}}
+
+	for _, test := range tests {
+		cases := append([]annotationsTest{{
+			name: "no annotations",
+			want: test.defaults,
+		}, {
+			name: "unrelated annotations",
+			annotations: map[string]string{
+				"networking.knative.dev/ingress.class": "kourier.ingress.networking.knative.dev",
+			},
+			want: test.defaults,
+		}, {
+			name:        "all overridden",
+			annotations: test.overridden,
+			want:        test.want,
+		}, {
+			name:        "malformed",
+			annotations: test.malformed,
+			wantErr:     "invalid annotation",
+		}}, test.more...)
+
+		for _, c := range cases {
+			t.Run(test.name+"/"+c.name, func(t *testing.T) {
+				got, err := test.forIngress(c.annotations)
+				if c.wantErr != "" {
+					assert.ErrorContains(t, err, c.wantErr)
+					return
+				}
+				assert.NilError(t, err)
+				assert.DeepEqual(t, got, c.want)
+			})
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	cm "knative.dev/pkg/configmap"
+)
+
+// The keys configuring the circuit breakers of clusters.
+const (
+	circuitBreakerMaxConnectionsKey     = "circuit-breaker-max-connections"
+	circuitBreakerMaxPendingRequestsKey = "circuit-breaker-max-pending-requests"
+	circuitBreakerMaxRequestsKey        = "circuit-breaker-max-requests"
+	circuitBreakerMaxRetriesKey         = "circuit-breaker-max-retries"
+)
+
+// CircuitBreakers specifies the thresholds at which the gateways stop sending
+// requests to a service and fail them right away. 0 leaves a threshold to Envoy,
+// which defaults to 1024 connections, pending requests and requests, and 3
+// concurrent retries.
+type CircuitBreakers struct {
+	// MaxConnections is the maximum number of connections to the endpoints of the
+	// service.
+	MaxConnections uint32
+	// MaxPendingRequests is the maximum number of requests waiting for a
+	// connection.
+	MaxPendingRequests uint32
+	// MaxRequests is the maximum number of concurrent requests.
+	MaxRequests uint32
+	// MaxRetries is the maximum number of concurrent retries.
+	MaxRetries uint32
+}
+
+// Enabled returns whether any of the thresholds is set.
+func (c CircuitBreakers) Enabled() bool {
+	return c != CircuitBreakers{}
+}
+
+// CircuitBreakersForIngress returns the circuit breakers of the clusters of an
+// Ingress with the given annotations.
+func CircuitBreakersForIngress(annotations map[string]string, defaults CircuitBreakers) (CircuitBreakers, error) {
+	return forIngress(annotations, defaults, asCircuitBreakers)
+}
+
+// asCircuitBreakers parses the circuit breaker keys with the given prefix into
+// target.
+func asCircuitBreakers(prefix string, target *CircuitBreakers) cm.ParseFunc {
+	return func(data map[string]string) error {
+		return cm.Parse(data,
+			cm.AsUint32(prefix+circuitBreakerMaxConnectionsKey, &target.MaxConnections),
+			cm.AsUint32(prefix+circuitBreakerMaxPendingRequestsKey, &target.MaxPendingRequests),
+			cm.AsUint32(prefix+circuitBreakerMaxRequestsKey, &target.MaxRequests),
+			cm.AsUint32(prefix+circuitBreakerMaxRetriesKey, &target.MaxRetries),
+		)
+	}
+}
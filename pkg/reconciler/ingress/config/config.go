@@ -18,6 +18,7 @@ package config
 
 import (
 	"os"
+	"strings"
 
 	"knative.dev/pkg/kmap"
 	"knative.dev/pkg/network"
@@ -31,6 +32,10 @@ const (
 	// InternalServiceName is the name of the internal service.
 	InternalServiceName = "kourier-internal"
 
+	// InternalServiceHTTPPortName is the name of the port of the internal service
+	// targeting HTTPPortLocal, see config/300-gateway.yaml.
+	InternalServiceHTTPPortName = "http2"
+
 	// ExternalServiceName is the name of the external service.
 	ExternalServiceName = "kourier"
 
@@ -58,9 +63,21 @@ const (
 	// GatewayNamespaceEnv is an env variable specifying where the gateway is deployed.
 	GatewayNamespaceEnv = "KOURIER_GATEWAY_NAMESPACE"
 
+	// XdsTLSSecretNameEnv is an env variable specifying the Secret in the system
+	// namespace holding the certificates of the xDS management server. The server
+	// serves plaintext if it isn't set.
+	XdsTLSSecretNameEnv = "KOURIER_XDS_TLS_SECRET_NAME"
+
 	// KourierIngressClassName is the class name to reconcile.
 	KourierIngressClassName = "kourier.ingress.networking.knative.dev"
 
+	// DefaultGatewayNodeID is the node ID of the default fleet of gateways.
+	DefaultGatewayNodeID = "3scale-kourier-gateway"
+
+	// gatewayKey is the label or annotation key attached to an Ingress to assign it to
+	// a fleet of gateways. Its value is the node ID the gateways of the fleet use.
+	gatewayKey = "kourier.knative.dev/gateway"
+
 	// disableHTTP2AnnotationKey is the annotation key attached to a Knative Domain Mapping
 	// to indicate that http2 should not be enabled for it.
 	disableHTTP2AnnotationKey = "kourier.knative.dev/disable-http2"
@@ -81,12 +98,54 @@ var disableHTTP2Annotation = kmap.KeyPriority{
 	disableHTTP2AnnotationKey,
 }
 
-// ServiceHostnames returns the external and internal service's respective hostname.
+var gatewayKeys = kmap.KeyPriority{
+	gatewayKey,
+}
+
+// ServiceHostnames returns the external and internal service's respective hostname
+// of the given fleet of gateways.
 //
 // Example: kourier.kourier-system.svc.cluster.local.
-func ServiceHostnames() (string, string) {
-	return network.GetServiceHostname(ExternalServiceName, GatewayNamespace()),
-		network.GetServiceHostname(InternalServiceName, GatewayNamespace())
+func ServiceHostnames(nodeID string) (string, string) {
+	external, internal := ServiceNames(nodeID)
+	return network.GetServiceHostname(external, GatewayNamespace()),
+		network.GetServiceHostname(internal, GatewayNamespace())
+}
+
+// ServiceNames returns the names of the external and internal service of the given
+// fleet of gateways. The services of fleets other than the default one are suffixed
+// with the fleet's node ID.
+//
+// Example: kourier-tenant-a and kourier-internal-tenant-a.
+func ServiceNames(nodeID string) (string, string) {
+	if nodeID == DefaultGatewayNodeID {
+		return ExternalServiceName, InternalServiceName
+	}
+	return ExternalServiceName + "-" + nodeID, InternalServiceName + "-" + nodeID
+}
+
+// NodeIDForInternalService returns the node ID of the fleet of gateways the given
+// internal service belongs to, the reverse of ServiceNames.
+func NodeIDForInternalService(serviceName string) (string, bool) {
+	if serviceName == InternalServiceName {
+		return DefaultGatewayNodeID, true
+	}
+	if nodeID, ok := strings.CutPrefix(serviceName, InternalServiceName+"-"); ok && nodeID != "" {
+		return nodeID, true
+	}
+	return "", false
+}
+
+// GatewayNodeID returns the node ID of the fleet of gateways an Ingress with the
+// given labels and annotations is assigned to. Labels take precedence.
+func GatewayNodeID(labels, annotations map[string]string) string {
+	if nodeID := gatewayKeys.Value(labels); nodeID != "" {
+		return nodeID
+	}
+	if nodeID := gatewayKeys.Value(annotations); nodeID != "" {
+		return nodeID
+	}
+	return DefaultGatewayNodeID
 }
 
 // GatewayNamespace returns the namespace where the gateway is deployed.
@@ -98,6 +157,12 @@ func GatewayNamespace() string {
 	return namespace
 }
 
+// XdsTLSSecretName returns the name of the Secret holding the certificates of the
+// xDS management server, if TLS is enabled.
+func XdsTLSSecretName() string {
+	return os.Getenv(XdsTLSSecretNameEnv)
+}
+
 // GetDisableHTTP2 specifies whether http2 is going to be disabled
 func GetDisableHTTP2(annotations map[string]string) (val string) {
 	return disableHTTP2Annotation.Value(annotations)
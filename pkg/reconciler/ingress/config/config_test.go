@@ -0,0 +1,94 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// TestInternalServiceHTTPPort makes sure the port of the internal service the local
+// cluster of zone aware routing is built from matches the shipped manifests.
+func TestInternalServiceHTTPPort(t *testing.T) {
+	f, err := os.Open("../../../../config/300-gateway.yaml")
+	assert.NilError(t, err)
+	defer f.Close()
+
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		// Only decode the fields of a Service, the other kinds don't fit its spec.
+		var svc struct {
+			metav1.TypeMeta   `json:",inline"`
+			metav1.ObjectMeta `json:"metadata"`
+			Spec              struct {
+				Ports []corev1.ServicePort `json:"ports"`
+			} `json:"spec"`
+		}
+		err := decoder.Decode(&svc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NilError(t, err)
+		if svc.Kind != "Service" || svc.Name != InternalServiceName {
+			continue
+		}
+
+		for _, port := range svc.Spec.Ports {
+			if port.Name == InternalServiceHTTPPortName {
+				assert.Equal(t, port.TargetPort.IntValue(), int(HTTPPortLocal))
+				return
+			}
+		}
+		t.Fatalf("Service %q has no port named %q", InternalServiceName, InternalServiceHTTPPortName)
+	}
+	t.Fatalf("Service %q not found", InternalServiceName)
+}
+
+func TestNodeIDForInternalService(t *testing.T) {
+	tests := []struct {
+		serviceName string
+		wantNodeID  string
+		wantOK      bool
+	}{{
+		serviceName: InternalServiceName,
+		wantNodeID:  DefaultGatewayNodeID,
+		wantOK:      true,
+	}, {
+		serviceName: InternalServiceName + "-tenant-a",
+		wantNodeID:  "tenant-a",
+		wantOK:      true,
+	}, {
+		serviceName: InternalServiceName + "-",
+	}, {
+		serviceName: "kourier",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.serviceName, func(t *testing.T) {
+			nodeID, ok := NodeIDForInternalService(test.serviceName)
+			assert.Equal(t, nodeID, test.wantNodeID)
+			assert.Equal(t, ok, test.wantOK)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	cm "knative.dev/pkg/configmap"
+)
+
+// DefaultConnectTimeout is the time the gateways wait for a connection to an
+// endpoint, unless configured otherwise.
+const DefaultConnectTimeout = 5 * time.Second
+
+// The keys configuring the connections of clusters to services.
+const (
+	upstreamConnectTimeoutKey            = "upstream-connect-timeout"
+	upstreamMaxRequestsPerConnectionKey  = "upstream-max-requests-per-connection"
+	upstreamIdleTimeoutKey               = "upstream-idle-timeout"
+	upstreamHTTP2MaxConcurrentStreamsKey = "upstream-http2-max-concurrent-streams"
+)
+
+// ConnectionPool specifies how the gateways connect to the endpoints of a service
+// and reuse the connections. Zero values are left to the defaults.
+type ConnectionPool struct {
+	// ConnectTimeout is the time to wait for a connection to an endpoint. 0
+	// leaves it to DefaultConnectTimeout.
+	ConnectTimeout time.Duration
+	// MaxRequestsPerConnection is the number of requests after which a
+	// connection is closed. 0 leaves connections open for any number of requests.
+	MaxRequestsPerConnection uint32
+	// IdleTimeout is the time after which a connection without requests is
+	// closed. 0 leaves it to Envoy, which defaults to 1 hour.
+	IdleTimeout time.Duration
+	// HTTP2MaxConcurrentStreams is the maximum number of concurrent requests on a
+	// connection to a service supporting HTTP/2. 0 leaves it to Envoy, which
+	// defaults to 2147483647.
+	HTTP2MaxConcurrentStreams uint32
+}
+
+// HasHTTPProtocolOptions returns whether any of the settings configured by the
+// HTTP protocol options of a cluster is set.
+func (p ConnectionPool) HasHTTPProtocolOptions() bool {
+	return p.MaxRequestsPerConnection != 0 || p.IdleTimeout != 0 || p.HTTP2MaxConcurrentStreams != 0
+}
+
+// ConnectionPoolForIngress returns the connection pool of the clusters of an
+// Ingress with the given annotations.
+func ConnectionPoolForIngress(annotations map[string]string, defaults ConnectionPool) (ConnectionPool, error) {
+	return forIngress(annotations, defaults, asConnectionPool)
+}
+
+// asConnectionPool parses the connection pool keys with the given prefix into
+// target.
+func asConnectionPool(prefix string, target *ConnectionPool) cm.ParseFunc {
+	return func(data map[string]string) error {
+		return cm.Parse(data,
+			asNonNegativeDuration(prefix+upstreamConnectTimeoutKey, &target.ConnectTimeout),
+			cm.AsUint32(prefix+upstreamMaxRequestsPerConnectionKey, &target.MaxRequestsPerConnection),
+			asNonNegativeDuration(prefix+upstreamIdleTimeoutKey, &target.IdleTimeout),
+			cm.AsUint32(prefix+upstreamHTTP2MaxConcurrentStreamsKey, &target.HTTP2MaxConcurrentStreams),
+		)
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestConnectionPoolHasHTTPProtocolOptions(t *testing.T) {
+	assert.Assert(t, !ConnectionPool{}.HasHTTPProtocolOptions())
+	assert.Assert(t, !ConnectionPool{ConnectTimeout: time.Second}.HasHTTPProtocolOptions())
+	assert.Assert(t, ConnectionPool{MaxRequestsPerConnection: 1}.HasHTTPProtocolOptions())
+	assert.Assert(t, ConnectionPool{IdleTimeout: time.Second}.HasHTTPProtocolOptions())
+	assert.Assert(t, ConnectionPool{HTTP2MaxConcurrentStreams: 1}.HasHTTPProtocolOptions())
+}
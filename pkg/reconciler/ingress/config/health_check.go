@@ -0,0 +1,122 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	cm "knative.dev/pkg/configmap"
+)
+
+// HealthCheckType specifies the protocol the endpoints of a service are actively
+// health checked with.
+type HealthCheckType string
+
+const (
+	// HealthCheckDisabled disables active health checks. This is the default.
+	HealthCheckDisabled HealthCheckType = ""
+	// HealthCheckHTTP checks endpoints with HTTP requests, which have to be
+	// answered with a 200.
+	HealthCheckHTTP HealthCheckType = "http"
+	// HealthCheckGRPC checks endpoints with the gRPC health checking protocol. It
+	// requires the service to support HTTP/2.
+	HealthCheckGRPC HealthCheckType = "grpc"
+)
+
+// The keys configuring active health checks of clusters.
+const (
+	healthCheckTypeKey               = "health-check-type"
+	healthCheckPathKey               = "health-check-path"
+	healthCheckGRPCServiceNameKey    = "health-check-grpc-service-name"
+	healthCheckIntervalKey           = "health-check-interval"
+	healthCheckTimeoutKey            = "health-check-timeout"
+	healthCheckHealthyThresholdKey   = "health-check-healthy-threshold"
+	healthCheckUnhealthyThresholdKey = "health-check-unhealthy-threshold"
+)
+
+// HealthCheck specifies how the gateways actively check the health of the
+// endpoints of a service. Zero values are left to the defaults of Kourier.
+type HealthCheck struct {
+	// Type is the protocol endpoints are checked with.
+	Type HealthCheckType
+	// Path is the path HTTP checks request.
+	Path string
+	// GRPCServiceName is the service gRPC checks ask for.
+	GRPCServiceName string
+	// Interval is the interval between checks.
+	Interval time.Duration
+	// Timeout is the time to wait for the response to a check.
+	Timeout time.Duration
+	// HealthyThreshold is the number of successful checks after which an
+	// unhealthy endpoint is healthy again.
+	HealthyThreshold uint32
+	// UnhealthyThreshold is the number of failed checks after which an endpoint is
+	// unhealthy.
+	UnhealthyThreshold uint32
+}
+
+// Enabled returns whether endpoints are checked at all.
+func (h HealthCheck) Enabled() bool {
+	return h.Type != HealthCheckDisabled
+}
+
+// HealthCheckForIngress returns the health check of the clusters of an Ingress
+// with the given annotations.
+func HealthCheckForIngress(annotations map[string]string, defaults HealthCheck) (HealthCheck, error) {
+	return forIngress(annotations, defaults, asHealthCheck)
+}
+
+// asHealthCheck parses the health check keys with the given prefix into target
+// and validates the result.
+func asHealthCheck(prefix string, target *HealthCheck) cm.ParseFunc {
+	return func(data map[string]string) error {
+		if err := cm.Parse(data,
+			asHealthCheckType(prefix+healthCheckTypeKey, &target.Type),
+			cm.AsString(prefix+healthCheckPathKey, &target.Path),
+			cm.AsString(prefix+healthCheckGRPCServiceNameKey, &target.GRPCServiceName),
+			asNonNegativeDuration(prefix+healthCheckIntervalKey, &target.Interval),
+			asNonNegativeDuration(prefix+healthCheckTimeoutKey, &target.Timeout),
+			cm.AsUint32(prefix+healthCheckHealthyThresholdKey, &target.HealthyThreshold),
+			cm.AsUint32(prefix+healthCheckUnhealthyThresholdKey, &target.UnhealthyThreshold),
+		); err != nil {
+			return err
+		}
+		if target.Path != "" && !strings.HasPrefix(target.Path, "/") {
+			return errors.New(prefix + healthCheckPathKey + " must start with /")
+		}
+		return nil
+	}
+}
+
+func asHealthCheckType(key string, target *HealthCheckType) cm.ParseFunc {
+	return func(data map[string]string) error {
+		raw, ok := data[key]
+		if !ok {
+			return nil
+		}
+		switch typ := HealthCheckType(raw); typ {
+		case HealthCheckDisabled, HealthCheckHTTP, HealthCheckGRPC:
+			*target = typ
+			return nil
+		default:
+			return fmt.Errorf("%s %q is invalid, must be one of %q, %q or empty", key, raw, HealthCheckHTTP, HealthCheckGRPC)
+		}
+	}
+}
@@ -69,6 +69,19 @@ const (
 	extauthzPathPrefixKey          = "extauthz-path-prefix"
 	extauthzPackAsBytesKey         = "extauthz-pack-as-bytes"
 
+	// localityLBPolicyKey is the config map key for the policy used to balance load
+	// between the zones the endpoints of a service are in.
+	localityLBPolicyKey = "locality-lb-policy"
+
+	// localityLBLocalClusterKey is the config map key for the name of the local
+	// cluster the bootstrap of the gateways declares, which zone aware routing
+	// requires.
+	localityLBLocalClusterKey = "locality-lb-local-cluster"
+
+	// listenerIPFamilyKey is the config map key for the IP family the listeners
+	// of the gateways bind to.
+	listenerIPFamilyKey = "listener-ip-family"
+
 	certsSecretNameKey      = "certs-secret-name"
 	certsSecretNamespaceKey = "certs-secret-namespace"
 
@@ -116,13 +129,85 @@ func NewKourierConfigFromMap(configMap map[string]string) (*Kourier, error) {
 		cm.AsBool(disableEnvoyServerHeader, &nc.DisableEnvoyServerHeader),
 		cm.AsString(certsSecretNameKey, &nc.CertsSecretName),
 		cm.AsString(certsSecretNamespaceKey, &nc.CertsSecretNamespace),
+		asLocalityLBPolicy(localityLBPolicyKey, &nc.LocalityLBPolicy),
+		cm.AsString(localityLBLocalClusterKey, &nc.LocalityLBLocalCluster),
+		asListenerIPFamily(listenerIPFamilyKey, &nc.ListenerIPFamily),
+		asRouteTimeouts("", &nc.RouteTimeouts),
+		asRetryPolicy("", &nc.RetryPolicy),
+		asOutlierDetection("", &nc.OutlierDetection),
+		asCircuitBreakers("", &nc.CircuitBreakers),
+		asHealthCheck("", &nc.HealthCheck),
+		asConnectionPool("", &nc.ConnectionPool),
 	); err != nil {
 		return nil, err
 	}
 
+	if nc.LocalityLBPolicy == LocalityLBPolicyZoneAware && nc.LocalityLBLocalCluster == "" {
+		return nil, fmt.Errorf("%s %q requires %s", localityLBPolicyKey, LocalityLBPolicyZoneAware, localityLBLocalClusterKey)
+	}
+
 	return nc, nil
 }
 
+// LocalityLBPolicy specifies how load is balanced between the localities (zones) the
+// endpoints of a service are in.
+type LocalityLBPolicy string
+
+const (
+	// LocalityLBPolicyDisabled puts all endpoints into a single locality, disregarding zones.
+	LocalityLBPolicyDisabled LocalityLBPolicy = ""
+	// LocalityLBPolicyWeighted groups endpoints by zone and weighs the zones by their size.
+	LocalityLBPolicyWeighted LocalityLBPolicy = "locality-weighted"
+	// LocalityLBPolicyZoneAware groups endpoints by zone and prefers endpoints in the
+	// gateway's own zone.
+	LocalityLBPolicyZoneAware LocalityLBPolicy = "zone-aware"
+)
+
+func asLocalityLBPolicy(key string, target *LocalityLBPolicy) cm.ParseFunc {
+	return func(data map[string]string) error {
+		raw, ok := data[key]
+		if !ok {
+			return nil
+		}
+		switch policy := LocalityLBPolicy(raw); policy {
+		case LocalityLBPolicyDisabled, LocalityLBPolicyWeighted, LocalityLBPolicyZoneAware:
+			*target = policy
+			return nil
+		default:
+			return fmt.Errorf("%s %q is invalid, must be one of %q, %q or empty", key, raw, LocalityLBPolicyWeighted, LocalityLBPolicyZoneAware)
+		}
+	}
+}
+
+// ListenerIPFamily specifies the IP family the listeners of the gateways bind to.
+type ListenerIPFamily string
+
+const (
+	// ListenerIPFamilyIPv4 binds the listeners to 0.0.0.0.
+	ListenerIPFamilyIPv4 ListenerIPFamily = ""
+	// ListenerIPFamilyIPv6 binds the listeners to ::, accepting IPv4 connections as
+	// IPv4-mapped IPv6 addresses where the gateway's kernel allows them.
+	ListenerIPFamilyIPv6 ListenerIPFamily = "ipv6"
+	// ListenerIPFamilyDualStack binds the listeners to both 0.0.0.0 and ::.
+	ListenerIPFamilyDualStack ListenerIPFamily = "dual-stack"
+)
+
+func asListenerIPFamily(key string, target *ListenerIPFamily) cm.ParseFunc {
+	return func(data map[string]string) error {
+		raw, ok := data[key]
+		if !ok {
+			return nil
+		}
+		switch family := ListenerIPFamily(raw); family {
+		case ListenerIPFamilyIPv4, ListenerIPFamilyIPv6, ListenerIPFamilyDualStack:
+			*target = family
+			return nil
+		default:
+			return fmt.Errorf("%s %q is invalid, must be one of %q, %q or empty", key, raw, ListenerIPFamilyIPv6, ListenerIPFamilyDualStack)
+		}
+	}
+}
+
 // Tracing contains all fields required to configure tracing at kourier gateway level.
 // This object is mostly filled by the asTracing method, using TracingCollectorFullEndpoint value as the source.
 type Tracing struct {
@@ -269,6 +354,38 @@ type Kourier struct {
 	CertsSecretName string
 	// CertsSecretNamespace is the namespace of the secret containing the TLS certificates for the Kourier gateway.
 	CertsSecretNamespace string
+	// LocalityLBPolicy specifies how load is balanced between the zones the endpoints
+	// of a service are in. Zones are not taken into account by default.
+	LocalityLBPolicy LocalityLBPolicy
+	// LocalityLBLocalCluster is the name of the local cluster declared by the
+	// bootstrap of the gateways. The management server serves the gateways of
+	// each fleet as its endpoints, grouped by zone. It is required by the
+	// zone-aware LocalityLBPolicy and ignored otherwise.
+	LocalityLBLocalCluster string
+	// ListenerIPFamily specifies the IP family the listeners of the gateways bind
+	// to. They bind to IPv4 only by default.
+	ListenerIPFamily ListenerIPFamily
+	// RouteTimeouts are the default timeouts of the routes of Ingresses, which
+	// they can override with annotations. No timeouts are set by default.
+	RouteTimeouts RouteTimeouts
+	// RetryPolicy is the default retry policy of the routes of Ingresses, which
+	// they can override with annotations. Requests aren't retried by default.
+	RetryPolicy RetryPolicy
+	// OutlierDetection is the default outlier detection of the clusters of
+	// Ingresses, which they can override with annotations. It is disabled by
+	// default.
+	OutlierDetection OutlierDetection
+	// CircuitBreakers are the default circuit breakers of the clusters of
+	// Ingresses, which they can override with annotations. Envoy's defaults apply
+	// by default.
+	CircuitBreakers CircuitBreakers
+	// HealthCheck is the default active health check of the clusters of
+	// Ingresses, which they can override with annotations. It is disabled by
+	// default.
+	HealthCheck HealthCheck
+	// ConnectionPool is the default connection pool of the clusters of Ingresses,
+	// which they can override with annotations.
+	ConnectionPool ConnectionPool
 }
 
 // Returns true if we need to modify the HTTPS listener with just one cert
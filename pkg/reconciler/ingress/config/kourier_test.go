@@ -153,6 +153,169 @@ func TestKourierConfig(t *testing.T) {
 		data: map[string]string{
 			useRemoteAddress: "true",
 		},
+	}, {
+		name: "locality weighted load balancing",
+		want: &Kourier{
+			EnableServiceAccessLogging: true,
+			LocalityLBPolicy:           LocalityLBPolicyWeighted,
+		},
+		data: map[string]string{
+			localityLBPolicyKey: "locality-weighted",
+		},
+	}, {
+		name: "zone aware load balancing",
+		want: &Kourier{
+			EnableServiceAccessLogging: true,
+			LocalityLBPolicy:           LocalityLBPolicyZoneAware,
+			LocalityLBLocalCluster:     "kourier-gateway",
+		},
+		data: map[string]string{
+			localityLBPolicyKey:       "zone-aware",
+			localityLBLocalClusterKey: "kourier-gateway",
+		},
+	}, {
+		name:    "zone aware load balancing without local cluster",
+		wantErr: true,
+		data: map[string]string{
+			localityLBPolicyKey: "zone-aware",
+		},
+	}, {
+		name:    "invalid locality load balancing policy",
+		wantErr: true,
+		data: map[string]string{
+			localityLBPolicyKey: "foo",
+		},
+	}, {
+		name: "ipv6 listeners",
+		want: &Kourier{
+			EnableServiceAccessLogging: true,
+			ListenerIPFamily:           ListenerIPFamilyIPv6,
+		},
+		data: map[string]string{
+			listenerIPFamilyKey: "ipv6",
+		},
+	}, {
+		name: "dual stack listeners",
+		want: &Kourier{
+			EnableServiceAccessLogging: true,
+			ListenerIPFamily:           ListenerIPFamilyDualStack,
+		},
+		data: map[string]string{
+			listenerIPFamilyKey: "dual-stack",
+		},
+	}, {
+		name:    "invalid listener IP family",
+		wantErr: true,
+		data: map[string]string{
+			listenerIPFamilyKey: "ipv5",
+		},
+	}, {
+		name: "route timeouts",
+		want: &Kourier{
+			EnableServiceAccessLogging: true,
+			RouteTimeouts: RouteTimeouts{
+				Timeout:     10 * time.Minute,
+				IdleTimeout: 30 * time.Second,
+			},
+		},
+		data: map[string]string{
+			routeTimeoutKey:     "10m",
+			routeIdleTimeoutKey: "30s",
+		},
+	}, {
+		name:    "negative route timeout",
+		wantErr: true,
+		data: map[string]string{
+			routeTimeoutKey: "-10m",
+		},
+	}, {
+		name: "retry policy",
+		want: &Kourier{
+			EnableServiceAccessLogging: true,
+			RetryPolicy: RetryPolicy{
+				RetryOn:    []string{"reset", "connect-failure"},
+				NumRetries: 2,
+			},
+		},
+		data: map[string]string{
+			retryOnKey:         "reset,connect-failure",
+			retryNumRetriesKey: "2",
+		},
+	}, {
+		name:    "invalid retry policy",
+		wantErr: true,
+		data: map[string]string{
+			retryOnKey: "sometimes",
+		},
+	}, {
+		name: "outlier detection and circuit breakers",
+		want: &Kourier{
+			EnableServiceAccessLogging: true,
+			OutlierDetection: OutlierDetection{
+				Consecutive5xx:   5,
+				BaseEjectionTime: time.Minute,
+			},
+			CircuitBreakers: CircuitBreakers{
+				MaxRequests: 500,
+			},
+		},
+		data: map[string]string{
+			outlierConsecutive5xxKey:     "5",
+			outlierBaseEjectionTimeKey:   "1m",
+			circuitBreakerMaxRequestsKey: "500",
+		},
+	}, {
+		name:    "invalid outlier detection",
+		wantErr: true,
+		data: map[string]string{
+			outlierMaxEjectionPercentKey: "101",
+		},
+	}, {
+		name:    "invalid circuit breakers",
+		wantErr: true,
+		data: map[string]string{
+			circuitBreakerMaxConnectionsKey: "-1",
+		},
+	}, {
+		name: "health check",
+		want: &Kourier{
+			EnableServiceAccessLogging: true,
+			HealthCheck: HealthCheck{
+				Type:     HealthCheckHTTP,
+				Path:     "/ready",
+				Interval: 5 * time.Second,
+			},
+		},
+		data: map[string]string{
+			healthCheckTypeKey:     "http",
+			healthCheckPathKey:     "/ready",
+			healthCheckIntervalKey: "5s",
+		},
+	}, {
+		name:    "invalid health check",
+		wantErr: true,
+		data: map[string]string{
+			healthCheckTypeKey: "tcp",
+		},
+	}, {
+		name: "connection pool",
+		want: &Kourier{
+			EnableServiceAccessLogging: true,
+			ConnectionPool: ConnectionPool{
+				ConnectTimeout:           time.Second,
+				MaxRequestsPerConnection: 100,
+			},
+		},
+		data: map[string]string{
+			upstreamConnectTimeoutKey:           "1s",
+			upstreamMaxRequestsPerConnectionKey: "100",
+		},
+	}, {
+		name:    "invalid connection pool",
+		wantErr: true,
+		data: map[string]string{
+			upstreamIdleTimeoutKey: "forever",
+		},
 	}, {
 		name: "enable use certs",
 		want: &Kourier{
@@ -0,0 +1,190 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	cm "knative.dev/pkg/configmap"
+)
+
+// LBPolicy specifies how the gateways pick the endpoint of a service a request is
+// sent to.
+type LBPolicy string
+
+const (
+	// LBPolicyRoundRobin picks the endpoints in turn. This is the default.
+	LBPolicyRoundRobin LBPolicy = "round-robin"
+	// LBPolicyLeastRequest picks the endpoint with fewer active requests out of
+	// two random ones.
+	LBPolicyLeastRequest LBPolicy = "least-request"
+	// LBPolicyRingHash picks the endpoint by the hash of the request on a ring,
+	// see SessionAffinity.
+	LBPolicyRingHash LBPolicy = "ring-hash"
+	// LBPolicyMaglev picks the endpoint by the hash of the request with Maglev
+	// hashing, see SessionAffinity.
+	LBPolicyMaglev LBPolicy = "maglev"
+	// LBPolicyRandom picks a random endpoint.
+	LBPolicyRandom LBPolicy = "random"
+)
+
+// IsHashBased returns whether the policy picks endpoints by the hash of requests.
+func (p LBPolicy) IsHashBased() bool {
+	return p == LBPolicyRingHash || p == LBPolicyMaglev
+}
+
+// SessionAffinityMode specifies what requests are hashed by to send the requests
+// of a client to the same endpoint.
+type SessionAffinityMode string
+
+const (
+	// SessionAffinityNone disables session affinity. This is the default.
+	SessionAffinityNone SessionAffinityMode = ""
+	// SessionAffinityCookie hashes requests by a cookie, which the gateways set
+	// if the request doesn't carry it.
+	SessionAffinityCookie SessionAffinityMode = "cookie"
+	// SessionAffinityHeader hashes requests by a header.
+	SessionAffinityHeader SessionAffinityMode = "header"
+	// SessionAffinitySourceIP hashes requests by the address of the client
+	// connection.
+	SessionAffinitySourceIP SessionAffinityMode = "source-ip"
+)
+
+// defaultSessionAffinityCookieName is the name of the cookie requests are hashed
+// by, unless configured otherwise.
+const defaultSessionAffinityCookieName = "kourier-affinity"
+
+const (
+	// lbPolicyAnnotationKey is the annotation key attached to an Ingress to pick
+	// the LBPolicy of the services it routes to.
+	lbPolicyAnnotationKey = "kourier.knative.dev/lb-policy"
+
+	// sessionAffinityAnnotationKey is the annotation key attached to an Ingress to
+	// pick the SessionAffinityMode of its routes. It implies the ring-hash
+	// LBPolicy unless another hash based policy is picked.
+	sessionAffinityAnnotationKey = "kourier.knative.dev/session-affinity"
+
+	// sessionAffinityCookieNameAnnotationKey and
+	// sessionAffinityCookieTTLAnnotationKey configure the cookie of the cookie
+	// mode. A TTL of 0, the default, makes it a session cookie.
+	sessionAffinityCookieNameAnnotationKey = "kourier.knative.dev/session-affinity-cookie-name"
+	sessionAffinityCookieTTLAnnotationKey  = "kourier.knative.dev/session-affinity-cookie-ttl"
+
+	// sessionAffinityHeaderNameAnnotationKey is the annotation key for the header
+	// of the header mode.
+	sessionAffinityHeaderNameAnnotationKey = "kourier.knative.dev/session-affinity-header-name"
+)
+
+// SessionAffinity specifies how the requests of a client are sent to the same
+// endpoint, as long as the endpoints of the service don't change.
+type SessionAffinity struct {
+	// Mode is what requests are hashed by.
+	Mode SessionAffinityMode
+	// CookieName is the name of the cookie of the cookie mode.
+	CookieName string
+	// CookieTTL is the lifetime of the cookie of the cookie mode. 0 makes it a
+	// session cookie.
+	CookieTTL time.Duration
+	// HeaderName is the name of the header of the header mode.
+	HeaderName string
+}
+
+// Enabled returns whether requests are hashed at all.
+func (a SessionAffinity) Enabled() bool {
+	return a.Mode != SessionAffinityNone
+}
+
+// LoadBalancing specifies how the requests to an Ingress are balanced between the
+// endpoints of its services.
+type LoadBalancing struct {
+	// Policy is the LBPolicy of the services. Empty leaves it to Envoy, which
+	// defaults to round robin.
+	Policy LBPolicy
+	// SessionAffinity is the session affinity of the routes.
+	SessionAffinity SessionAffinity
+}
+
+// LoadBalancingForIngress returns the load balancing of an Ingress with the given
+// annotations. It returns an error if an annotation is malformed or if session
+// affinity is combined with a policy that isn't hash based.
+func LoadBalancingForIngress(annotations map[string]string) (LoadBalancing, error) {
+	lb := LoadBalancing{
+		SessionAffinity: SessionAffinity{CookieName: defaultSessionAffinityCookieName},
+	}
+	if err := cm.Parse(annotations,
+		asLBPolicy(lbPolicyAnnotationKey, &lb.Policy),
+		asSessionAffinityMode(sessionAffinityAnnotationKey, &lb.SessionAffinity.Mode),
+		cm.AsString(sessionAffinityCookieNameAnnotationKey, &lb.SessionAffinity.CookieName),
+		asNonNegativeDuration(sessionAffinityCookieTTLAnnotationKey, &lb.SessionAffinity.CookieTTL),
+		cm.AsString(sessionAffinityHeaderNameAnnotationKey, &lb.SessionAffinity.HeaderName),
+	); err != nil {
+		return LoadBalancing{}, fmt.Errorf("invalid annotation: %w", err)
+	}
+
+	affinity := lb.SessionAffinity
+	if !affinity.Enabled() {
+		return lb, nil
+	}
+	switch {
+	case lb.Policy == "":
+		lb.Policy = LBPolicyRingHash
+	case !lb.Policy.IsHashBased():
+		return LoadBalancing{}, fmt.Errorf("invalid annotation: session affinity requires the %s or %s %s", LBPolicyRingHash, LBPolicyMaglev, lbPolicyAnnotationKey)
+	}
+	if affinity.Mode == SessionAffinityCookie && affinity.CookieName == "" {
+		return LoadBalancing{}, fmt.Errorf("invalid annotation: %s must not be empty", sessionAffinityCookieNameAnnotationKey)
+	}
+	if affinity.Mode == SessionAffinityHeader && affinity.HeaderName == "" {
+		return LoadBalancing{}, fmt.Errorf("invalid annotation: %s is required by the header mode", sessionAffinityHeaderNameAnnotationKey)
+	}
+	return lb, nil
+}
+
+func asLBPolicy(key string, target *LBPolicy) cm.ParseFunc {
+	return func(data map[string]string) error {
+		raw, ok := data[key]
+		if !ok {
+			return nil
+		}
+		switch policy := LBPolicy(raw); policy {
+		case LBPolicyRoundRobin, LBPolicyLeastRequest, LBPolicyRingHash, LBPolicyMaglev, LBPolicyRandom:
+			*target = policy
+			return nil
+		default:
+			return fmt.Errorf("%s %q is invalid, must be one of %q, %q, %q, %q or %q", key, raw,
+				LBPolicyRoundRobin, LBPolicyLeastRequest, LBPolicyRingHash, LBPolicyMaglev, LBPolicyRandom)
+		}
+	}
+}
+
+func asSessionAffinityMode(key string, target *SessionAffinityMode) cm.ParseFunc {
+	return func(data map[string]string) error {
+		raw, ok := data[key]
+		if !ok {
+			return nil
+		}
+		switch mode := SessionAffinityMode(raw); mode {
+		case SessionAffinityNone, SessionAffinityCookie, SessionAffinityHeader, SessionAffinitySourceIP:
+			*target = mode
+			return nil
+		default:
+			return fmt.Errorf("%s %q is invalid, must be one of %q, %q, %q or empty", key, raw,
+				SessionAffinityCookie, SessionAffinityHeader, SessionAffinitySourceIP)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLoadBalancingForIngress(t *testing.T) {
+	noAffinity := SessionAffinity{CookieName: "kourier-affinity"}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        LoadBalancing
+		wantErr     string
+	}{{
+		name: "no annotations",
+		want: LoadBalancing{SessionAffinity: noAffinity},
+	}, {
+		name:        "least request",
+		annotations: map[string]string{lbPolicyAnnotationKey: "least-request"},
+		want:        LoadBalancing{Policy: LBPolicyLeastRequest, SessionAffinity: noAffinity},
+	}, {
+		name: "cookie affinity implies ring hash",
+		annotations: map[string]string{
+			sessionAffinityAnnotationKey:          "cookie",
+			sessionAffinityCookieTTLAnnotationKey: "1h",
+		},
+		want: LoadBalancing{
+			Policy: LBPolicyRingHash,
+			SessionAffinity: SessionAffinity{
+				Mode:       SessionAffinityCookie,
+				CookieName: "kourier-affinity",
+				CookieTTL:  time.Hour,
+			},
+		},
+	}, {
+		name: "header affinity with maglev",
+		annotations: map[string]string{
+			lbPolicyAnnotationKey:                  "maglev",
+			sessionAffinityAnnotationKey:           "header",
+			sessionAffinityHeaderNameAnnotationKey: "x-user-id",
+		},
+		want: LoadBalancing{
+			Policy: LBPolicyMaglev,
+			SessionAffinity: SessionAffinity{
+				Mode:       SessionAffinityHeader,
+				CookieName: "kourier-affinity",
+				HeaderName: "x-user-id",
+			},
+		},
+	}, {
+		name:        "source ip affinity",
+		annotations: map[string]string{sessionAffinityAnnotationKey: "source-ip"},
+		want: LoadBalancing{
+			Policy:          LBPolicyRingHash,
+			SessionAffinity: SessionAffinity{Mode: SessionAffinitySourceIP, CookieName: "kourier-affinity"},
+		},
+	}, {
+		name:        "unknown policy",
+		annotations: map[string]string{lbPolicyAnnotationKey: "ROUND_ROBIN"},
+		wantErr:     `"ROUND_ROBIN" is invalid`,
+	}, {
+		name:        "unknown affinity",
+		annotations: map[string]string{sessionAffinityAnnotationKey: "ip"},
+		wantErr:     `"ip" is invalid`,
+	}, {
+		name: "affinity without hash based policy",
+		annotations: map[string]string{
+			lbPolicyAnnotationKey:        "least-request",
+			sessionAffinityAnnotationKey: "source-ip",
+		},
+		wantErr: "session affinity requires the ring-hash or maglev",
+	}, {
+		name:        "header affinity without header",
+		annotations: map[string]string{sessionAffinityAnnotationKey: "header"},
+		wantErr:     "is required by the header mode",
+	}, {
+		name: "cookie affinity without cookie",
+		annotations: map[string]string{
+			sessionAffinityAnnotationKey:           "cookie",
+			sessionAffinityCookieNameAnnotationKey: "",
+		},
+		wantErr: "must not be empty",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := LoadBalancingForIngress(test.annotations)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, got, test.want)
+		})
+	}
+}
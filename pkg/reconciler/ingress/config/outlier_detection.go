@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	cm "knative.dev/pkg/configmap"
+)
+
+// The keys configuring outlier detection of clusters.
+const (
+	// outlierConsecutive5xxKey is the key for the number of consecutive 5xx
+	// responses after which an endpoint is ejected. Outlier detection is disabled
+	// unless it is set.
+	outlierConsecutive5xxKey = "outlier-detection-consecutive-5xx"
+	// outlierIntervalKey is the key for the interval between ejection sweeps.
+	outlierIntervalKey = "outlier-detection-interval"
+	// outlierBaseEjectionTimeKey is the key for the base time an endpoint is
+	// ejected for, multiplied by the number of times it has been ejected.
+	outlierBaseEjectionTimeKey = "outlier-detection-base-ejection-time"
+	// outlierMaxEjectionPercentKey is the key for the maximum percentage of the
+	// endpoints of a cluster that can be ejected.
+	outlierMaxEjectionPercentKey = "outlier-detection-max-ejection-percent"
+)
+
+// OutlierDetection specifies when endpoints of a service are ejected from its
+// cluster for failing.
+type OutlierDetection struct {
+	// Consecutive5xx is the number of consecutive 5xx responses after which an
+	// endpoint is ejected.
+	Consecutive5xx uint32
+	// Interval is the interval between ejection sweeps. 0 leaves it to Envoy,
+	// which defaults to 10s.
+	Interval time.Duration
+	// BaseEjectionTime is the base time an endpoint is ejected for. 0 leaves it to
+	// Envoy, which defaults to 30s.
+	BaseEjectionTime time.Duration
+	// MaxEjectionPercent is the maximum percentage of the endpoints that can be
+	// ejected. 0 leaves it to Envoy, which defaults to 10%, but always allows
+	// ejecting one endpoint.
+	MaxEjectionPercent uint32
+}
+
+// Enabled returns whether endpoints are ejected at all.
+func (o OutlierDetection) Enabled() bool {
+	return o.Consecutive5xx != 0
+}
+
+// OutlierDetectionForIngress returns the outlier detection of the clusters of an
+// Ingress with the given annotations.
+func OutlierDetectionForIngress(annotations map[string]string, defaults OutlierDetection) (OutlierDetection, error) {
+	return forIngress(annotations, defaults, asOutlierDetection)
+}
+
+// asOutlierDetection parses the outlier detection keys with the given prefix into
+// target and validates the result.
+func asOutlierDetection(prefix string, target *OutlierDetection) cm.ParseFunc {
+	return func(data map[string]string) error {
+		if err := cm.Parse(data,
+			cm.AsUint32(prefix+outlierConsecutive5xxKey, &target.Consecutive5xx),
+			asNonNegativeDuration(prefix+outlierIntervalKey, &target.Interval),
+			asNonNegativeDuration(prefix+outlierBaseEjectionTimeKey, &target.BaseEjectionTime),
+			cm.AsUint32(prefix+outlierMaxEjectionPercentKey, &target.MaxEjectionPercent),
+		); err != nil {
+			return err
+		}
+		if target.MaxEjectionPercent > 100 {
+			return fmt.Errorf("%s must be at most 100, was %d", prefix+outlierMaxEjectionPercentKey, target.MaxEjectionPercent)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"knative.dev/pkg/kmap"
+)
+
+// PathMatchType specifies how the path of an Ingress is matched against the path
+// of requests.
+type PathMatchType string
+
+const (
+	// PathMatchPrefix matches all paths starting with the Ingress path. This is the
+	// default.
+	PathMatchPrefix PathMatchType = "prefix"
+	// PathMatchPathSeparatedPrefix matches the Ingress path and all paths below it,
+	// i.e. /api matches /api and /api/v1 but not /apis.
+	PathMatchPathSeparatedPrefix PathMatchType = "path-separated-prefix"
+	// PathMatchExact only matches the Ingress path itself.
+	PathMatchExact PathMatchType = "exact"
+	// PathMatchRegex matches all paths that fully match the Ingress path as an RE2
+	// regular expression.
+	PathMatchRegex PathMatchType = "regex"
+)
+
+// pathMatchAnnotationKey is the annotation key attached to an Ingress to change how
+// its paths are matched. Its value is a JSON object from paths of the Ingress to
+// their PathMatchType, e.g. {"/api/v1/users": "exact"}. Paths not listed are
+// matched by prefix.
+const pathMatchAnnotationKey = "kourier.knative.dev/path-match"
+
+var pathMatchAnnotation = kmap.KeyPriority{
+	pathMatchAnnotationKey,
+}
+
+// PathMatchTypes returns how the paths of an Ingress with the given annotations are
+// matched, keyed by path. It returns an error if the annotation is malformed or if
+// a path isn't valid for its type.
+func PathMatchTypes(annotations map[string]string) (map[string]PathMatchType, error) {
+	value := pathMatchAnnotation.Value(annotations)
+	if value == "" {
+		return nil, nil
+	}
+
+	var types map[string]PathMatchType
+	if err := json.Unmarshal([]byte(value), &types); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", pathMatchAnnotationKey, err)
+	}
+	for path, typ := range types {
+		if err := validatePathMatch(path, typ); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation for path %q: %w", pathMatchAnnotationKey, path, err)
+		}
+	}
+	return types, nil
+}
+
+func validatePathMatch(path string, typ PathMatchType) error {
+	switch typ {
+	case PathMatchPrefix:
+		return nil
+	case PathMatchExact:
+		if !strings.HasPrefix(path, "/") {
+			return errors.New("path must start with /")
+		}
+		return nil
+	case PathMatchPathSeparatedPrefix:
+		// Envoy rejects these, see
+		// https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/route/v3/route_components.proto#envoy-v3-api-field-config-route-v3-routematch-path-separated-prefix
+		if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") || strings.ContainsAny(path, "?#") {
+			return errors.New("path must start with /, must not end with / and must not contain ? or #")
+		}
+		return nil
+	case PathMatchRegex:
+		if _, err := regexp.Compile(path); err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown type %q, must be one of %s, %s, %s or %s",
+			typ, PathMatchPrefix, PathMatchPathSeparatedPrefix, PathMatchExact, PathMatchRegex)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPathMatchTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        map[string]PathMatchType
+		wantErr     string
+	}{{
+		name: "no annotation",
+	}, {
+		name: "all types",
+		annotations: map[string]string{
+			pathMatchAnnotationKey: `{"/": "prefix", "/api": "path-separated-prefix", "/api/v1/users": "exact", "^/tenant/[a-z]+/hook$": "regex"}`,
+		},
+		want: map[string]PathMatchType{
+			"/":                     PathMatchPrefix,
+			"/api":                  PathMatchPathSeparatedPrefix,
+			"/api/v1/users":         PathMatchExact,
+			"^/tenant/[a-z]+/hook$": PathMatchRegex,
+		},
+	}, {
+		name:        "malformed",
+		annotations: map[string]string{pathMatchAnnotationKey: "exact"},
+		wantErr:     "invalid kourier.knative.dev/path-match annotation",
+	}, {
+		name:        "unknown type",
+		annotations: map[string]string{pathMatchAnnotationKey: `{"/api": "glob"}`},
+		wantErr:     `unknown type "glob"`,
+	}, {
+		name:        "relative exact path",
+		annotations: map[string]string{pathMatchAnnotationKey: `{"api": "exact"}`},
+		wantErr:     "path must start with /",
+	}, {
+		name:        "path separated prefix with trailing slash",
+		annotations: map[string]string{pathMatchAnnotationKey: `{"/api/": "path-separated-prefix"}`},
+		wantErr:     "must not end with /",
+	}, {
+		name:        "path separated prefix with query",
+		annotations: map[string]string{pathMatchAnnotationKey: `{"/api?v=1": "path-separated-prefix"}`},
+		wantErr:     "must not contain ? or #",
+	}, {
+		name:        "invalid regex",
+		annotations: map[string]string{pathMatchAnnotationKey: `{"/api/(v1": "regex"}`},
+		wantErr:     "invalid regular expression",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := PathMatchTypes(test.annotations)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, test.want)
+		})
+	}
+}
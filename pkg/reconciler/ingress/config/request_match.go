@@ -0,0 +1,130 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"knative.dev/pkg/kmap"
+)
+
+const (
+	// headerMatchAnnotationKey is the annotation key attached to an Ingress to match
+	// requests to its paths by their headers, in addition to the headers in the
+	// spec. Its value is a JSON object from paths of the Ingress to a list of
+	// ValueMatches, e.g. {"/": [{"name": "x-canary", "regex": "^beta"}]}.
+	headerMatchAnnotationKey = "kourier.knative.dev/header-match"
+
+	// queryMatchAnnotationKey is the annotation key attached to an Ingress to match
+	// requests to its paths by their query parameters. Its value has the same format
+	// as the one of headerMatchAnnotationKey, but matches can't be inverted.
+	queryMatchAnnotationKey = "kourier.knative.dev/query-match"
+)
+
+var (
+	headerMatchAnnotation = kmap.KeyPriority{
+		headerMatchAnnotationKey,
+	}
+	queryMatchAnnotation = kmap.KeyPriority{
+		queryMatchAnnotationKey,
+	}
+)
+
+// ValueMatch matches the value of a request header or query parameter. Exactly one
+// of Exact, Prefix, Suffix, Regex and Present has to be set.
+type ValueMatch struct {
+	// Name is the name of the header or query parameter.
+	Name string `json:"name"`
+	// Exact matches values equal to it.
+	Exact string `json:"exact,omitempty"`
+	// Prefix matches values starting with it.
+	Prefix string `json:"prefix,omitempty"`
+	// Suffix matches values ending with it.
+	Suffix string `json:"suffix,omitempty"`
+	// Regex matches values fully matching it as an RE2 regular expression.
+	Regex string `json:"regex,omitempty"`
+	// Present matches if the header or query parameter is present, whatever its value.
+	Present bool `json:"present,omitempty"`
+	// Invert inverts the match, e.g. to match requests without a header. It is only
+	// supported for headers.
+	Invert bool `json:"invert,omitempty"`
+}
+
+// HeaderMatches returns the header matches of the paths of an Ingress with the
+// given annotations, keyed by path. It returns an error if the annotation is
+// malformed.
+func HeaderMatches(annotations map[string]string) (map[string][]ValueMatch, error) {
+	return valueMatches(headerMatchAnnotationKey, headerMatchAnnotation.Value(annotations), true)
+}
+
+// QueryParameterMatches returns the query parameter matches of the paths of an
+// Ingress with the given annotations, keyed by path. It returns an error if the
+// annotation is malformed.
+func QueryParameterMatches(annotations map[string]string) (map[string][]ValueMatch, error) {
+	return valueMatches(queryMatchAnnotationKey, queryMatchAnnotation.Value(annotations), false)
+}
+
+func valueMatches(key, value string, invertible bool) (map[string][]ValueMatch, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var matches map[string][]ValueMatch
+	if err := json.Unmarshal([]byte(value), &matches); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", key, err)
+	}
+	for path, ms := range matches {
+		for _, m := range ms {
+			if err := m.validate(invertible); err != nil {
+				return nil, fmt.Errorf("invalid %s annotation for path %q: %w", key, path, err)
+			}
+		}
+	}
+	return matches, nil
+}
+
+func (m ValueMatch) validate(invertible bool) error {
+	if m.Name == "" {
+		return errors.New("name must be set")
+	}
+
+	set := 0
+	for _, v := range []string{m.Exact, m.Prefix, m.Suffix, m.Regex} {
+		if v != "" {
+			set++
+		}
+	}
+	if m.Present {
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of exact, prefix, suffix, regex and present must be set for %q", m.Name)
+	}
+
+	if m.Regex != "" {
+		if _, err := regexp.Compile(m.Regex); err != nil {
+			return fmt.Errorf("invalid regular expression for %q: %w", m.Name, err)
+		}
+	}
+	if m.Invert && !invertible {
+		return fmt.Errorf("match for %q can't be inverted", m.Name)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHeaderMatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        map[string][]ValueMatch
+		wantErr     string
+	}{{
+		name: "no annotation",
+	}, {
+		name: "all kinds",
+		annotations: map[string]string{
+			headerMatchAnnotationKey: `{"/": [
+				{"name": "x-exact", "exact": "a"},
+				{"name": "x-prefix", "prefix": "b"},
+				{"name": "x-suffix", "suffix": "c"},
+				{"name": "x-canary", "regex": "^beta"},
+				{"name": "x-debug", "present": true, "invert": true}
+			]}`,
+		},
+		want: map[string][]ValueMatch{"/": {
+			{Name: "x-exact", Exact: "a"},
+			{Name: "x-prefix", Prefix: "b"},
+			{Name: "x-suffix", Suffix: "c"},
+			{Name: "x-canary", Regex: "^beta"},
+			{Name: "x-debug", Present: true, Invert: true},
+		}},
+	}, {
+		name:        "malformed",
+		annotations: map[string]string{headerMatchAnnotationKey: `{"/": {"name": "x-canary"}}`},
+		wantErr:     "invalid kourier.knative.dev/header-match annotation",
+	}, {
+		name:        "missing name",
+		annotations: map[string]string{headerMatchAnnotationKey: `{"/": [{"exact": "a"}]}`},
+		wantErr:     "name must be set",
+	}, {
+		name:        "no value",
+		annotations: map[string]string{headerMatchAnnotationKey: `{"/": [{"name": "x-canary"}]}`},
+		wantErr:     "exactly one of exact, prefix, suffix, regex and present must be set",
+	}, {
+		name:        "multiple values",
+		annotations: map[string]string{headerMatchAnnotationKey: `{"/": [{"name": "x-canary", "exact": "a", "prefix": "b"}]}`},
+		wantErr:     "exactly one of exact, prefix, suffix, regex and present must be set",
+	}, {
+		name:        "invalid regex",
+		annotations: map[string]string{headerMatchAnnotationKey: `{"/": [{"name": "x-canary", "regex": "(beta"}]}`},
+		wantErr:     "invalid regular expression",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := HeaderMatches(test.annotations)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, test.want)
+		})
+	}
+}
+
+func TestQueryParameterMatches(t *testing.T) {
+	got, err := QueryParameterMatches(map[string]string{
+		queryMatchAnnotationKey: `{"/api": [{"name": "version", "exact": "2"}, {"name": "debug", "present": true}]}`,
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, map[string][]ValueMatch{"/api": {
+		{Name: "version", Exact: "2"},
+		{Name: "debug", Present: true},
+	}})
+
+	_, err = QueryParameterMatches(map[string]string{
+		queryMatchAnnotationKey: `{"/api": [{"name": "debug", "present": true, "invert": true}]}`,
+	})
+	assert.ErrorContains(t, err, `match for "debug" can't be inverted`)
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	cm "knative.dev/pkg/configmap"
+)
+
+// The keys configuring the retry policy of routes.
+const (
+	// retryOnKey is the key for the comma-separated conditions under which a
+	// request is retried, e.g. "reset,connect-failure". Retries are disabled
+	// unless it is set, so an empty annotation disables the default policy.
+	retryOnKey = "retry-on"
+	// retryNumRetriesKey is the key for the number of times a request is retried.
+	retryNumRetriesKey = "retry-num-retries"
+	// retryPerTryTimeoutKey is the key for the timeout of each attempt.
+	retryPerTryTimeoutKey = "retry-per-try-timeout"
+	// retryStatusCodesKey is the key for the comma-separated status codes retried
+	// on with the retriable-status-codes condition.
+	retryStatusCodesKey = "retry-status-codes"
+	// retryBackoffBaseIntervalKey is the key for the base interval of the
+	// exponential backoff between retries.
+	retryBackoffBaseIntervalKey = "retry-backoff-base-interval"
+	// retryBackoffMaxIntervalKey is the key for the maximum interval between retries.
+	retryBackoffMaxIntervalKey = "retry-backoff-max-interval"
+)
+
+// retryConditions are the conditions Envoy retries HTTP and gRPC requests on, see
+// https://www.envoyproxy.io/docs/envoy/latest/configuration/http/http_filters/router_filter#x-envoy-retry-on
+// and https://www.envoyproxy.io/docs/envoy/latest/configuration/http/http_filters/router_filter#x-envoy-retry-grpc-on
+var retryConditions = sets.New(
+	"5xx", "gateway-error", "reset", "reset-before-request", "connect-failure",
+	"envoy-ratelimited", "retriable-4xx", "refused-stream", "retriable-status-codes",
+	"retriable-headers", "http3-post-connect-failure",
+	"cancelled", "deadline-exceeded", "internal", "resource-exhausted", "unavailable",
+)
+
+const retriableStatusCodesCondition = "retriable-status-codes"
+
+// RetryPolicy specifies how the requests to the routes of an Ingress are retried.
+// +k8s:deepcopy-gen=true
+type RetryPolicy struct {
+	// RetryOn are the conditions under which a request is retried.
+	RetryOn []string
+	// NumRetries is the number of times a request is retried. 0 leaves it to
+	// Envoy, which defaults to 1.
+	NumRetries uint32
+	// PerTryTimeout is the timeout of each attempt. 0 leaves each attempt the
+	// whole timeout of the route.
+	PerTryTimeout time.Duration
+	// RetriableStatusCodes are the status codes retried on with the
+	// retriable-status-codes condition.
+	RetriableStatusCodes []uint32
+	// BackoffBaseInterval is the base interval of the exponential backoff between
+	// retries. 0 leaves it to Envoy, which defaults to 25ms.
+	BackoffBaseInterval time.Duration
+	// BackoffMaxInterval is the maximum interval between retries. 0 leaves it to
+	// Envoy, which defaults to 10 times the base interval.
+	BackoffMaxInterval time.Duration
+}
+
+// Enabled returns whether requests are retried at all.
+func (p RetryPolicy) Enabled() bool {
+	return len(p.RetryOn) != 0
+}
+
+// RetryPolicyForIngress returns the retry policy of the routes of an Ingress with
+// the given annotations.
+func RetryPolicyForIngress(annotations map[string]string, defaults RetryPolicy) (RetryPolicy, error) {
+	return forIngress(annotations, defaults, asRetryPolicy)
+}
+
+// asRetryPolicy parses the retry policy keys with the given prefix into target
+// and validates the result.
+func asRetryPolicy(prefix string, target *RetryPolicy) cm.ParseFunc {
+	return func(data map[string]string) error {
+		if err := cm.Parse(data,
+			asRetryConditions(prefix+retryOnKey, &target.RetryOn),
+			cm.AsUint32(prefix+retryNumRetriesKey, &target.NumRetries),
+			asNonNegativeDuration(prefix+retryPerTryTimeoutKey, &target.PerTryTimeout),
+			asStatusCodes(prefix+retryStatusCodesKey, &target.RetriableStatusCodes),
+			asNonNegativeDuration(prefix+retryBackoffBaseIntervalKey, &target.BackoffBaseInterval),
+			asNonNegativeDuration(prefix+retryBackoffMaxIntervalKey, &target.BackoffMaxInterval),
+		); err != nil {
+			return err
+		}
+		return target.validate()
+	}
+}
+
+func (p RetryPolicy) validate() error {
+	if len(p.RetriableStatusCodes) != 0 && !slices.Contains(p.RetryOn, retriableStatusCodesCondition) {
+		return fmt.Errorf("retriable status codes require the %s condition", retriableStatusCodesCondition)
+	}
+	if p.BackoffMaxInterval != 0 {
+		if p.BackoffBaseInterval == 0 {
+			return errors.New("the maximum backoff interval requires a base interval")
+		}
+		if p.BackoffMaxInterval < p.BackoffBaseInterval {
+			return errors.New("the maximum backoff interval must not be less than the base interval")
+		}
+	}
+	return nil
+}
+
+func asRetryConditions(key string, target *[]string) cm.ParseFunc {
+	return func(data map[string]string) error {
+		raw, ok := data[key]
+		if !ok {
+			return nil
+		}
+		var conditions []string
+		for _, condition := range strings.Split(raw, ",") {
+			condition = strings.TrimSpace(condition)
+			if condition == "" {
+				continue
+			}
+			if !retryConditions.Has(condition) {
+				return fmt.Errorf("%s contains unknown condition %q", key, condition)
+			}
+			conditions = append(conditions, condition)
+		}
+		*target = conditions
+		return nil
+	}
+}
+
+func asStatusCodes(key string, target *[]uint32) cm.ParseFunc {
+	return func(data map[string]string) error {
+		raw, ok := data[key]
+		if !ok {
+			return nil
+		}
+		var codes []uint32
+		for _, code := range strings.Split(raw, ",") {
+			code = strings.TrimSpace(code)
+			if code == "" {
+				continue
+			}
+			c, err := strconv.ParseUint(code, 10, 32)
+			if err != nil || c < 100 || c > 599 {
+				return fmt.Errorf("%s contains invalid status code %q", key, code)
+			}
+			codes = append(codes, uint32(c))
+		}
+		*target = codes
+		return nil
+	}
+}
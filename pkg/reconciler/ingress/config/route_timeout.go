@@ -0,0 +1,81 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	cm "knative.dev/pkg/configmap"
+)
+
+// The keys configuring the timeouts of routes.
+const (
+	// routeTimeoutKey is the key for the amount of time Envoy waits for the
+	// complete response to a request, e.g. "10m". 0s disables the timeout.
+	routeTimeoutKey = "route-timeout"
+
+	// routeIdleTimeoutKey is the key for the amount of time a request may be idle,
+	// e.g. "30s". 0s leaves it to stream-idle-timeout.
+	routeIdleTimeoutKey = "route-idle-timeout"
+)
+
+// RouteTimeouts are the timeouts of the routes of an Ingress.
+type RouteTimeouts struct {
+	// Timeout is the amount of time Envoy waits for the complete response to a
+	// request, streamed responses included. 0 disables the timeout.
+	Timeout time.Duration
+	// IdleTimeout is the amount of time a request may go without activity. It
+	// overrides stream-idle-timeout unless it is 0.
+	IdleTimeout time.Duration
+}
+
+// RouteTimeoutsForIngress returns the timeouts of the routes of an Ingress with the
+// given annotations.
+func RouteTimeoutsForIngress(annotations map[string]string, defaults RouteTimeouts) (RouteTimeouts, error) {
+	return forIngress(annotations, defaults, asRouteTimeouts)
+}
+
+// asRouteTimeouts parses the route timeout keys with the given prefix into target.
+func asRouteTimeouts(prefix string, target *RouteTimeouts) cm.ParseFunc {
+	return func(data map[string]string) error {
+		return cm.Parse(data,
+			asNonNegativeDuration(prefix+routeTimeoutKey, &target.Timeout),
+			asNonNegativeDuration(prefix+routeIdleTimeoutKey, &target.IdleTimeout),
+		)
+	}
+}
+
+// asNonNegativeDuration parses the value of key as a duration Envoy accepts. Empty
+// values are ignored.
+func asNonNegativeDuration(key string, target *time.Duration) cm.ParseFunc {
+	return func(data map[string]string) error {
+		raw := data[key]
+		if raw == "" {
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse %q: %w", key, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("%s %q must not be negative", key, raw)
+		}
+		*target = d
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	cm "knative.dev/pkg/configmap"
+)
+
+// UpstreamProtocol specifies the HTTP version the gateways speak to the services of
+// an Ingress.
+type UpstreamProtocol string
+
+const (
+	// UpstreamProtocolAuto detects the protocol from the Service port the
+	// Ingress routes to. This is the default.
+	UpstreamProtocolAuto UpstreamProtocol = ""
+	// UpstreamProtocolHTTP1 forces HTTP/1.1.
+	UpstreamProtocolHTTP1 UpstreamProtocol = "http1"
+	// UpstreamProtocolHTTP2 forces HTTP/2.
+	UpstreamProtocolHTTP2 UpstreamProtocol = "http2"
+)
+
+// upstreamProtocolAnnotationKey is the annotation key attached to an Ingress to
+// force the UpstreamProtocol of its services.
+const upstreamProtocolAnnotationKey = "kourier.knative.dev/upstream-protocol"
+
+// UpstreamProtocolForIngress returns the protocol forced for the services of an
+// Ingress with the given annotations. The disable-http2 annotation forces HTTP/1.1
+// as well. It returns an error if the annotations are malformed or contradict
+// each other.
+func UpstreamProtocolForIngress(annotations map[string]string) (UpstreamProtocol, error) {
+	protocol := UpstreamProtocolAuto
+	if err := cm.Parse(annotations, asUpstreamProtocol(upstreamProtocolAnnotationKey, &protocol)); err != nil {
+		return UpstreamProtocolAuto, fmt.Errorf("invalid annotation: %w", err)
+	}
+
+	if strings.EqualFold(GetDisableHTTP2(annotations), "true") {
+		if protocol == UpstreamProtocolHTTP2 {
+			return UpstreamProtocolAuto, fmt.Errorf("invalid annotation: %s contradicts %s", disableHTTP2AnnotationKey, upstreamProtocolAnnotationKey)
+		}
+		protocol = UpstreamProtocolHTTP1
+	}
+	return protocol, nil
+}
+
+func asUpstreamProtocol(key string, target *UpstreamProtocol) cm.ParseFunc {
+	return func(data map[string]string) error {
+		raw, ok := data[key]
+		if !ok {
+			return nil
+		}
+		switch protocol := UpstreamProtocol(raw); protocol {
+		case UpstreamProtocolAuto, UpstreamProtocolHTTP1, UpstreamProtocolHTTP2:
+			*target = protocol
+			return nil
+		default:
+			return fmt.Errorf("%s %q is invalid, must be one of %q, %q or empty", key, raw, UpstreamProtocolHTTP1, UpstreamProtocolHTTP2)
+		}
+	}
+}
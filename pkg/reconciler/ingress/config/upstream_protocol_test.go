@@ -0,0 +1,77 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestUpstreamProtocolForIngress(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        UpstreamProtocol
+		wantErr     string
+	}{{
+		name: "no annotations",
+		want: UpstreamProtocolAuto,
+	}, {
+		name:        "http1",
+		annotations: map[string]string{upstreamProtocolAnnotationKey: "http1"},
+		want:        UpstreamProtocolHTTP1,
+	}, {
+		name:        "http2",
+		annotations: map[string]string{upstreamProtocolAnnotationKey: "http2"},
+		want:        UpstreamProtocolHTTP2,
+	}, {
+		name:        "disable-http2",
+		annotations: map[string]string{disableHTTP2AnnotationKey: "True"},
+		want:        UpstreamProtocolHTTP1,
+	}, {
+		name: "disable-http2 agreeing with http1",
+		annotations: map[string]string{
+			disableHTTP2AnnotationKey:     "true",
+			upstreamProtocolAnnotationKey: "http1",
+		},
+		want: UpstreamProtocolHTTP1,
+	}, {
+		name: "disable-http2 contradicting http2",
+		annotations: map[string]string{
+			disableHTTP2AnnotationKey:     "true",
+			upstreamProtocolAnnotationKey: "http2",
+		},
+		wantErr: "contradicts",
+	}, {
+		name:        "unknown protocol",
+		annotations: map[string]string{upstreamProtocolAnnotationKey: "h2c"},
+		wantErr:     `"h2c" is invalid`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := UpstreamProtocolForIngress(test.annotations)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, got, test.want)
+		})
+	}
+}
@@ -64,6 +64,12 @@ func (in *Kourier) DeepCopyInto(out *Kourier) {
 	}
 	out.Tracing = in.Tracing
 	out.ExternalAuthz = in.ExternalAuthz
+	out.RouteTimeouts = in.RouteTimeouts
+	in.RetryPolicy.DeepCopyInto(&out.RetryPolicy)
+	out.OutlierDetection = in.OutlierDetection
+	out.CircuitBreakers = in.CircuitBreakers
+	out.HealthCheck = in.HealthCheck
+	out.ConnectionPool = in.ConnectionPool
 	return
 }
 
@@ -76,3 +82,29 @@ func (in *Kourier) DeepCopy() *Kourier {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.RetryOn != nil {
+		in, out := &in.RetryOn, &out.RetryOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RetriableStatusCodes != nil {
+		in, out := &in.RetriableStatusCodes, &out.RetriableStatusCodes
+		*out = make([]uint32, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
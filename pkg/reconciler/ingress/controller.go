@@ -26,14 +26,19 @@ import (
 	v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
 	"go.uber.org/zap"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	v1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	envoy "knative.dev/net-kourier/pkg/envoy/server"
 	"knative.dev/net-kourier/pkg/generator"
@@ -47,10 +52,10 @@ import (
 	netconfig "knative.dev/networking/pkg/config"
 	"knative.dev/networking/pkg/status"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
-	endpointsinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints"
 	podinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/pod"
 	secretfilteredinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/secret/filtered"
 	serviceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/service"
+	endpointsliceinformer "knative.dev/pkg/client/injection/kube/informers/discovery/v1/endpointslice"
 	filteredFactory "knative.dev/pkg/client/injection/kube/informers/factory/filtered"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
@@ -64,8 +69,9 @@ const (
 	gatewayLabelKey   = "app"
 	gatewayLabelValue = "3scale-kourier-gateway"
 
-	nodeID         = "3scale-kourier-gateway"
 	managementPort = 18000
+	healthPort     = 18001
+	debugPort      = 18002
 
 	unknownWeightedClusterPrefix = "route: unknown weighted cluster '"
 )
@@ -80,7 +86,7 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	kubernetesClient := kubeclient.Get(ctx)
 	knativeClient := knativeclient.Get(ctx)
 	ingressInformer := ingressinformer.Get(ctx)
-	endpointsInformer := endpointsinformer.Get(ctx)
+	endpointSliceInformer := endpointsliceinformer.Get(ctx)
 	serviceInformer := serviceinformer.Get(ctx)
 	podInformer := podinformer.Get(ctx)
 	secretInformer := getSecretInformer(ctx)
@@ -91,7 +97,9 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	ctx = ensureCtxWithConfigOrDie(ctx)
 
 	// Create a new Cache, with the Readiness endpoint enabled, and the list of current Ingresses.
-	caches, err := generator.NewCaches(ctx, kubernetesClient)
+	caches, err := generator.NewCaches(ctx, kubernetesClient, func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+		return endpointSliceInformer.Lister().EndpointSlices(ns).List(endpointSliceSelector(name))
+	})
 	if err != nil {
 		logger.Fatalw("Failed create new caches", zap.Error(err))
 	}
@@ -99,8 +107,10 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	r := &Reconciler{
 		caches:   caches,
 		extAuthz: config.FromContext(ctx).Kourier.ExternalAuthz.Enabled,
+		metrics:  newMetrics(nil),
 	}
 
+	var configStore *config.Store
 	impl := v1alpha1ingress.NewImpl(ctx, r, config.KourierIngressClassName, func(impl *controller.Impl) controller.Options {
 		configsToResync := []interface{}{
 			&netconfig.Config{},
@@ -109,7 +119,7 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 		resync := configmap.TypeFilter(configsToResync...)(func(string, interface{}) {
 			impl.FilteredGlobalResync(isKourierIngress, ingressInformer.Informer())
 		})
-		configStore := config.NewStore(logger.Named("config-store"), resync)
+		configStore = config.NewStore(logger.Named("config-store"), resync)
 		configStore.WatchConfigs(cmw)
 		return controller.Options{
 			ConfigStore:       configStore,
@@ -126,53 +136,66 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 		}, ingressInformer.Informer())
 	}
 
+	handleNACK := newNACKHandler(logger, impl.Tracker.OnChanged, func() {
+		// Fallback to a global resync of non-ready ingresses for every other error.
+		impl.FilteredGlobalResync(func(obj interface{}) bool {
+			return isKourierIngress(obj) && !obj.(*v1alpha1.Ingress).IsReady()
+		}, ingressInformer.Informer())
+	})
+
+	xdsOptions := []envoy.Option{
+		envoy.WithHealthPort(healthPort),
+		envoy.WithRollbackFunc(func(nodeID, version string, errorDetail *rpcstatus.Status) {
+			// The gateways are back on the last config they accepted. Drop the ingress that
+			// broke the config, so that it isn't part of any config pushed from now on.
+			r.configAcks.rejected(nodeID)
+			key, ok := r.rejections.reject(nodeID, version, errorDetail.GetMessage())
+			if !ok {
+				return
+			}
+			logger.Warnf("Gateway rejected the config of ingress %q, rolled back to the last accepted config", key)
+			if err := r.caches.DeleteIngressInfo(ctx, key.Name, key.Namespace); err != nil {
+				logger.Errorw("Failed to remove rejected ingress from the config", zap.Error(err))
+			}
+			impl.EnqueueKey(key)
+		}),
+		envoy.WithAcceptFunc(func(nodeID, version string) {
+			r.metrics.recordConfigAcks(ctx, nodeID, r.configAcks.accepted(nodeID, version, time.Now()))
+		}),
+		// Without client certificates, the gateways of the default fleet keep working
+		// as they did before fleets could be authenticated.
+		envoy.WithUnauthenticatedNodeIDs(config.DefaultGatewayNodeID),
+	}
+	if secretName := config.XdsTLSSecretName(); secretName != "" {
+		certs, err := watchXdsCertificates(ctx, kubernetesClient, secretName)
+		if err != nil {
+			logger.Fatalw("Failed to load the certificates of the management server", zap.Error(err))
+		}
+		xdsOptions = append(xdsOptions, envoy.WithTLS(certs))
+	}
+
 	envoyXdsServer := envoy.NewXdsServer(
 		managementPort,
 		&xds.CallbackFuncs{
 			StreamRequestFunc: func(_ int64, req *v3.DiscoveryRequest) error {
-				if req.GetErrorDetail() == nil {
-					return nil
-				}
-				logger.Warnf("Error pushing snapshot to gateway: code: %v message %s", req.GetErrorDetail().GetCode(), req.GetErrorDetail().GetMessage())
-
-				// We know we can handle this error without a global resync.
-				if strings.HasPrefix(req.GetErrorDetail().GetMessage(), unknownWeightedClusterPrefix) {
-					// The error message contains the service name as referenced by the ingress.
-					svc := strings.TrimPrefix(strings.TrimSuffix(req.GetErrorDetail().GetMessage(), "'"), unknownWeightedClusterPrefix)
-					ns, name, err := cache.SplitMetaNamespaceKey(svc)
-					if err != nil {
-						logger.Errorw("Failed to parse service name from error", zap.Error(err))
-						return nil
-					}
-
-					logger.Infof("Triggering reconcile for all ingresses referencing %q", svc)
-					impl.Tracker.OnChanged(&corev1.Service{
-						TypeMeta: metav1.TypeMeta{
-							Kind:       "Service",
-							APIVersion: "v1",
-						},
-						ObjectMeta: metav1.ObjectMeta{
-							Namespace: ns,
-							Name:      name,
-						},
-					})
-					return nil
-				}
-
-				// Fallback to a global resync of non-ready ingresses for every other error.
-				impl.FilteredGlobalResync(func(obj interface{}) bool {
-					return isKourierIngress(obj) && !obj.(*v1alpha1.Ingress).IsReady()
-				}, ingressInformer.Informer())
-
-				return nil
+				return handleNACK(req.GetErrorDetail())
+			},
+			StreamDeltaRequestFunc: func(_ int64, req *v3.DeltaDiscoveryRequest) error {
+				return handleNACK(req.GetErrorDetail())
 			},
 		},
+		xdsOptions...,
 	)
 	r.xdsServer = envoyXdsServer
+	if !envoyXdsServer.AuthenticatesGateways() {
+		logger.Warnf("The management server doesn't verify client certificates, so gateways are NOT authenticated. "+
+			"Any client reaching it receives the config of the default fleet %q and the gateways of all other fleets are rejected. "+
+			"Set %s to a Secret holding a ca.crt to authenticate gateways.", config.DefaultGatewayNodeID, config.XdsTLSSecretNameEnv)
+	}
 
 	statusProber := status.NewProber(
 		logger.Named("status-manager"),
-		NewProbeTargetLister(logger, endpointsInformer.Lister()),
+		NewProbeTargetLister(logger, endpointSliceInformer.Lister()),
 		func(ing *v1alpha1.Ingress) {
 			logger.Debugf("Ready callback triggered for ingress: %s/%s", ing.Namespace, ing.Name)
 			impl.EnqueueKey(types.NamespacedName{Namespace: ing.Namespace, Name: ing.Name})
@@ -198,8 +221,8 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 			}
 			return nsConfigmapInformer.Lister().List(selector)
 		},
-		func(ns, name string) (*corev1.Endpoints, error) {
-			return endpointsInformer.Lister().Endpoints(ns).Get(name)
+		func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+			return endpointSliceInformer.Lister().EndpointSlices(ns).List(endpointSliceSelector(name))
 		},
 		func(ns, name string) (*corev1.Service, error) {
 			return serviceInformer.Lister().Services(ns).Get(name)
@@ -207,14 +230,9 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 		impl.Tracker)
 	r.ingressTranslator = &ingressTranslator
 
-	// Initialize the Envoy snapshot.
-	snapshot, err := r.caches.ToEnvoySnapshot(ctx)
-	if err != nil {
-		logger.Fatalw("Failed to create snapshot", zap.Error(err))
-	}
-	err = r.xdsServer.SetSnapshot(nodeID, snapshot)
-	if err != nil {
-		logger.Fatalw("Failed to set snapshot", zap.Error(err))
+	// Initialize the Envoy snapshots.
+	if err := r.updateEnvoyConfig(ctx, nil); err != nil {
+		logger.Fatalw("Failed to set snapshots", zap.Error(err))
 	}
 
 	// Get the current list of ingresses that are ready and seed the Envoy config with them.
@@ -237,8 +255,18 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 			}
 			return nsConfigmapInformer.Lister().List(selector)
 		},
-		func(ns, name string) (*corev1.Endpoints, error) {
-			return kubernetesClient.CoreV1().Endpoints(ns).Get(ctx, name, metav1.GetOptions{})
+		func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+			slices, err := kubernetesClient.DiscoveryV1().EndpointSlices(ns).List(ctx, metav1.ListOptions{
+				LabelSelector: endpointSliceSelector(name).String(),
+			})
+			if err != nil {
+				return nil, err
+			}
+			res := make([]*discoveryv1.EndpointSlice, 0, len(slices.Items))
+			for i := range slices.Items {
+				res = append(res, &slices.Items[i])
+			}
+			return res, nil
 		},
 		func(ns, name string) (*corev1.Service, error) {
 			return kubernetesClient.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
@@ -252,7 +280,7 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 		}
 	}
 	// Update the entire batch of ready ingresses at once.
-	if err := r.updateEnvoyConfig(ctx); err != nil {
+	if err := r.updateEnvoyConfig(ctx, nil); err != nil {
 		logger.Fatalw("Failed to set initial envoy config", zap.Error(err))
 	}
 
@@ -264,6 +292,15 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 		}
 	}()
 
+	go func() {
+		logger.Info("Starting Debug Server on Port ", debugPort)
+		debugHandler := newDebugHandler(logger.Named("debug"), envoyXdsServer,
+			cachedDebugAuthorizer(kubeDebugAuthorizer(kubernetesClient), debugAuthorizationTTL))
+		if err := runDebugServer(ctx, debugPort, debugHandler); err != nil {
+			logger.Errorw("Failed to serve Debug Server", zap.Error(err))
+		}
+	}()
+
 	// Ingresses need to be filtered by ingress class, so Kourier does not
 	// react to nor modify ingresses created by other gateways.
 	ingressInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
@@ -288,19 +325,35 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 		),
 	))
 
-	viaTracker := controller.EnsureTypeMeta(
+	tracked := controller.EnsureTypeMeta(
 		impl.Tracker.OnChanged,
-		corev1.SchemeGroupVersion.WithKind("Endpoints"))
-	endpointsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		discoveryv1.SchemeGroupVersion.WithKind("EndpointSlice"))
+	viaTracker := func(obj interface{}) {
+		// The gateways are the endpoints of the local cluster of zone aware routing,
+		// which is part of the config of every ingress.
+		// Only the snapshot of the fleet changes, the ingresses don't need to be
+		// translated again.
+		if nodeID, ok := gatewayEndpointSliceNodeID(obj); ok && configStore.Load().Kourier.LocalityLBPolicy == config.LocalityLBPolicyZoneAware {
+			logger.Infof("Updating the config of gateway %q due to changed gateway endpoints", nodeID)
+			if err := r.updateFleetConfig(configStore.ToContext(ctx), nodeID); err != nil {
+				logger.Errorw("Failed to update the config of gateway "+nodeID, zap.Error(err))
+			}
+			return
+		}
+		tracked(obj)
+	}
+	endpointSliceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    viaTracker,
 		DeleteFunc: viaTracker,
 		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
-			before := readyAddresses(oldObj.(*corev1.Endpoints))
-			after := readyAddresses(newObj.(*corev1.Endpoints))
-
-			// If the ready addresses have not changed, there is no reason for us to
-			// reconcile this endpoint, so why bother?
-			if before.Equal(after) {
+			before := oldObj.(*discoveryv1.EndpointSlice)
+			after := newObj.(*discoveryv1.EndpointSlice)
+
+			// If neither the usable addresses nor the resolved ports have changed, there
+			// is no reason for us to reconcile this endpoint slice, so why bother?
+			if readyAddresses(before).Equal(readyAddresses(after)) &&
+				servingTerminatingAddresses(before).Equal(servingTerminatingAddresses(after)) &&
+				equality.Semantic.DeepEqual(before.Ports, after.Ports) {
 				return
 			}
 
@@ -358,24 +411,124 @@ func getReadyIngresses(ctx context.Context, knativeClient networkingClientSet.Ne
 	return ingressesToWarm, nil
 }
 
-func readyAddresses(eps *corev1.Endpoints) sets.Set[string] {
-	var count int
-	for _, subset := range eps.Subsets {
-		count += len(subset.Addresses)
+// readyAddresses returns the addresses of all endpoints in the slice the
+// generator considers ready.
+func readyAddresses(slice *discoveryv1.EndpointSlice) sets.Set[string] {
+	ready := sets.New[string]()
+	for _, ep := range slice.Endpoints {
+		if generator.IsEndpointReady(ep.Conditions) {
+			ready.Insert(ep.Addresses...)
+		}
 	}
+	return ready
+}
 
-	if count == 0 {
-		return nil
+// servingTerminatingAddresses returns the addresses of all endpoints in the slice
+// that are terminating but still serving traffic.
+func servingTerminatingAddresses(slice *discoveryv1.EndpointSlice) sets.Set[string] {
+	serving := sets.New[string]()
+	for _, ep := range slice.Endpoints {
+		if generator.IsEndpointServingAndTerminating(ep.Conditions) {
+			serving.Insert(ep.Addresses...)
+		}
 	}
+	return serving
+}
 
-	ready := make(sets.Set[string], count)
-	for _, subset := range eps.Subsets {
-		for _, address := range subset.Addresses {
-			ready.Insert(address.IP)
+// gatewayEndpointSliceNodeID returns the node ID of the fleet of gateways whose
+// internal service the given object is an EndpointSlice of, if any.
+func gatewayEndpointSliceNodeID(obj interface{}) (string, bool) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok || slice.Namespace != config.GatewayNamespace() {
+		return "", false
+	}
+	return config.NodeIDForInternalService(slice.Labels[discoveryv1.LabelServiceName])
+}
+
+// endpointSliceSelector returns a selector matching all EndpointSlices of the given service.
+func endpointSliceSelector(serviceName string) labels.Selector {
+	return labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: serviceName})
+}
+
+// watchXdsCertificates loads the certificates of the management server from the
+// given Secret in the system namespace and keeps them up to date as it is rotated.
+func watchXdsCertificates(ctx context.Context, kubeClient kubernetes.Interface, secretName string) (*envoy.CertificateReloader, error) {
+	logger := logging.FromContext(ctx)
+
+	secret, err := kubeClient.CoreV1().Secrets(system.Namespace()).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", system.Namespace(), secretName, err)
+	}
+	certs := &envoy.CertificateReloader{}
+	if err := certs.Update(secret); err != nil {
+		return nil, err
+	}
+
+	informer := v1.NewFilteredSecretInformer(kubeClient, system.Namespace(), controller.GetResyncPeriod(ctx), cache.Indexers{},
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", secretName).String()
+		})
+	update := func(obj interface{}) {
+		secret, ok := obj.(*corev1.Secret)
+		if !ok {
+			return
 		}
+		if err := certs.Update(secret); err != nil {
+			// Keep serving the previous certificates until the Secret is fixed.
+			logger.Errorw("Failed to reload the certificates of the management server", zap.Error(err))
+			return
+		}
+		logger.Info("Reloaded the certificates of the management server")
+	}
+	// The Secret is added when the informer starts, which covers changes made since
+	// it was read above, and again when it's recreated.
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, newObj interface{}) { update(newObj) },
+	}); err != nil {
+		return nil, fmt.Errorf("failed to watch secret %s/%s: %w", system.Namespace(), secretName, err)
 	}
+	go informer.Run(ctx.Done())
 
-	return ready
+	return certs, nil
+}
+
+// newNACKHandler returns the function reacting to a gateway rejecting a pushed
+// configuration. Both the state-of-the-world and the delta protocol report
+// rejections the same way. Rejections of a route to an unknown cluster reconcile
+// the ingresses routing to its service, every other rejection calls resync.
+func newNACKHandler(logger *zap.SugaredLogger, serviceChanged func(interface{}), resync func()) func(*rpcstatus.Status) error {
+	return func(errorDetail *rpcstatus.Status) error {
+		if errorDetail == nil {
+			return nil
+		}
+		logger.Warnf("Error pushing snapshot to gateway: code: %v message %s", errorDetail.GetCode(), errorDetail.GetMessage())
+
+		// We know we can handle this error without a global resync.
+		if strings.HasPrefix(errorDetail.GetMessage(), unknownWeightedClusterPrefix) {
+			// The error message contains the name of the cluster, which starts with
+			// the service as referenced by the ingress.
+			clusterName := strings.TrimPrefix(strings.TrimSuffix(errorDetail.GetMessage(), "'"), unknownWeightedClusterPrefix)
+			if svc, ok := generator.ServiceOfCluster(clusterName); ok {
+				logger.Infof("Triggering reconcile for all ingresses referencing %q", svc)
+				serviceChanged(&corev1.Service{
+					TypeMeta: metav1.TypeMeta{
+						Kind:       "Service",
+						APIVersion: "v1",
+					},
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: svc.Namespace,
+						Name:      svc.Name,
+					},
+				})
+				return nil
+			}
+			logger.Errorf("Failed to parse service name from cluster %q", clusterName)
+		}
+
+		resync()
+		return nil
+	}
 }
 
 func getSecretInformer(ctx context.Context) v1.SecretInformer {
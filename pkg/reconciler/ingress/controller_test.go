@@ -22,19 +22,24 @@ import (
 
 	_ "knative.dev/networking/pkg/client/injection/client/fake"
 	_ "knative.dev/networking/pkg/client/injection/informers/networking/v1alpha1/ingress/fake"
-	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints/fake"
 	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/pod/fake"
 	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/secret/filtered/fake"
 	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/service/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/discovery/v1/endpointslice/fake"
 	_ "knative.dev/pkg/client/injection/kube/informers/factory/filtered/fake"
 	_ "knative.dev/pkg/injection/clients/namespacedkube/informers/core/v1/configmap/fake"
 
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"gotest.tools/v3/assert"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	networkcfg "knative.dev/networking/pkg/config"
 	kubeclient "knative.dev/pkg/client/injection/kube/client/fake"
 	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/logging"
 	rtesting "knative.dev/pkg/reconciler/testing"
 	"knative.dev/pkg/system"
 
@@ -141,3 +146,97 @@ func TestGetInitialConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestGatewayEndpointSliceNodeID(t *testing.T) {
+	slice := func(namespace, serviceName string) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      serviceName + "-abcde",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: serviceName},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		want string
+	}{{
+		name: "default fleet",
+		obj:  slice(config.GatewayNamespace(), config.InternalServiceName),
+		want: config.DefaultGatewayNodeID,
+	}, {
+		name: "other fleet",
+		obj:  slice(config.GatewayNamespace(), config.InternalServiceName+"-tenant"),
+		want: "tenant",
+	}, {
+		name: "external service",
+		obj:  slice(config.GatewayNamespace(), config.ExternalServiceName),
+	}, {
+		name: "other namespace",
+		obj:  slice("default", config.InternalServiceName),
+	}, {
+		name: "not a slice",
+		obj:  &corev1.Service{},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := gatewayEndpointSliceNodeID(tt.obj)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("gatewayEndpointSliceNodeID() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNACKHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     string
+		wantService *types.NamespacedName
+	}{{
+		name:        "unknown cluster with default settings",
+		message:     "route: unknown weighted cluster 'servicens/servicename'",
+		wantService: &types.NamespacedName{Namespace: "servicens", Name: "servicename"},
+	}, {
+		name:        "unknown cluster with settings of an ingress",
+		message:     "route: unknown weighted cluster 'servicens/servicename/9320a7bf'",
+		wantService: &types.NamespacedName{Namespace: "servicens", Name: "servicename"},
+	}, {
+		name:    "unparsable cluster",
+		message: "route: unknown weighted cluster 'servicename'",
+	}, {
+		name:    "other error",
+		message: "Proto constraint validation failed",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				changed []types.NamespacedName
+				resyncs int
+			)
+			handleNACK := newNACKHandler(logging.FromContext(context.Background()), func(obj interface{}) {
+				svc := obj.(*corev1.Service)
+				changed = append(changed, types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name})
+			}, func() {
+				resyncs++
+			})
+
+			// ACKs don't trigger anything.
+			assert.NilError(t, handleNACK(nil))
+			assert.Assert(t, changed == nil && resyncs == 0)
+
+			assert.NilError(t, handleNACK(&rpcstatus.Status{Message: test.message}))
+			if test.wantService != nil {
+				assert.DeepEqual(t, changed, []types.NamespacedName{*test.wantService})
+				assert.Equal(t, resyncs, 0)
+			} else {
+				assert.Assert(t, changed == nil)
+				assert.Equal(t, resyncs, 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	cachetypes "github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/kubernetes"
+	envoyapi "knative.dev/net-kourier/pkg/envoy/api"
+	envoy "knative.dev/net-kourier/pkg/envoy/server"
+	"knative.dev/net-kourier/pkg/generator"
+)
+
+// debugSnapshotsPath is the path the snapshots served to the gateways are dumped
+// at. Access to it is granted through RBAC rules on the non-resource URL.
+const debugSnapshotsPath = "/debug/snapshots"
+
+const (
+	// debugAuthorizationTTL is how long the result of authorizing a token is reused,
+	// so that repeated requests don't each review the token again.
+	debugAuthorizationTTL = 10 * time.Second
+	// debugAuthorizationCacheSize is the number of tokens whose results are kept.
+	debugAuthorizationCacheSize = 128
+)
+
+var (
+	errUnauthenticated = errors.New("unauthenticated")
+	errForbidden       = errors.New("forbidden")
+)
+
+// debugAuthorizer verifies that the bearer of the given token is allowed to access
+// the debug endpoint. It returns errUnauthenticated or errForbidden otherwise.
+type debugAuthorizer func(ctx context.Context, token string) error
+
+// kubeDebugAuthorizer authenticates tokens with a TokenReview and authorizes the
+// resulting user with a SubjectAccessReview for getting the debug endpoint.
+func kubeDebugAuthorizer(kubeClient kubernetes.Interface) debugAuthorizer {
+	return func(ctx context.Context, token string) error {
+		review, err := kubeClient.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+			Spec: authenticationv1.TokenReviewSpec{Token: token},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to review token: %w", err)
+		}
+		if !review.Status.Authenticated {
+			return errUnauthenticated
+		}
+
+		user := review.Status.User
+		extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+		for k, v := range user.Extra {
+			extra[k] = authorizationv1.ExtraValue(v)
+		}
+		access, err := kubeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				Extra:  extra,
+				NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+					Path: debugSnapshotsPath,
+					Verb: "get",
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to review access: %w", err)
+		}
+		if !access.Status.Allowed {
+			return errForbidden
+		}
+		return nil
+	}
+}
+
+// authorizationResult is a cached result of a debugAuthorizer.
+type authorizationResult struct {
+	err error
+}
+
+// cachedDebugAuthorizer reuses the results of the given authorizer per token for
+// the given time. Failures to review a token are not cached.
+func cachedDebugAuthorizer(authorize debugAuthorizer, ttl time.Duration) debugAuthorizer {
+	results := utilcache.NewLRUExpireCache(debugAuthorizationCacheSize)
+	return func(ctx context.Context, token string) error {
+		// Don't keep the tokens themselves in memory.
+		key := sha256.Sum256([]byte(token))
+		if result, ok := results.Get(key); ok {
+			return result.(authorizationResult).err
+		}
+
+		err := authorize(ctx, token)
+		if err == nil || errors.Is(err, errUnauthenticated) || errors.Is(err, errForbidden) {
+			results.Add(key, authorizationResult{err: err}, ttl)
+		}
+		return err
+	}
+}
+
+// debugResponse is the dump of the snapshots served to the gateways.
+type debugResponse struct {
+	Nodes    map[string]debugNode `json:"nodes"`
+	Gateways []debugGateway       `json:"gateways"`
+}
+
+// debugNode is the dump of the snapshot served to a node and of how the gateways
+// of the node responded to it.
+type debugNode struct {
+	Version             string                    `json:"version,omitempty"`
+	LastAcceptedVersion string                    `json:"lastAcceptedVersion,omitempty"`
+	Acked               map[string]string         `json:"acked,omitempty"`
+	Nacked              map[string]debugRejection `json:"nacked,omitempty"`
+
+	Listeners []json.RawMessage `json:"listeners,omitempty"`
+	Routes    []json.RawMessage `json:"routes,omitempty"`
+	Clusters  []json.RawMessage `json:"clusters,omitempty"`
+	Endpoints []json.RawMessage `json:"endpoints,omitempty"`
+	Secrets   []json.RawMessage `json:"secrets,omitempty"`
+}
+
+type debugRejection struct {
+	Version string `json:"version"`
+	Message string `json:"message"`
+}
+
+type debugGateway struct {
+	NodeID         string    `json:"nodeID"`
+	Address        string    `json:"address"`
+	Authenticated  bool      `json:"authenticated"`
+	ConnectedSince time.Time `json:"connectedSince"`
+}
+
+// debugHandler dumps the snapshots served to the gateways as JSON. The dump can be
+// limited to a node with the "node" query parameter and to the routes, clusters
+// and endpoints of an ingress with the "ingress" query parameter, given as
+// namespace/name. Listeners and secrets are shared by all ingresses and therefore
+// omitted if filtering by ingress. Private keys are always redacted.
+type debugHandler struct {
+	logger    *zap.SugaredLogger
+	xdsServer *envoy.XdsServer
+	authorize debugAuthorizer
+}
+
+func newDebugHandler(logger *zap.SugaredLogger, xdsServer *envoy.XdsServer, authorize debugAuthorizer) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(debugSnapshotsPath, &debugHandler{
+		logger:    logger,
+		xdsServer: xdsServer,
+		authorize: authorize,
+	})
+	return mux
+}
+
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, errUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := h.authorize(r.Context(), token); err != nil {
+		switch {
+		case errors.Is(err, errUnauthenticated):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, errForbidden):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			h.logger.Errorw("Failed to authorize debug request", zap.Error(err))
+			http.Error(w, "failed to authorize request", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var ingress *types.NamespacedName
+	if key := r.URL.Query().Get("ingress"); key != "" {
+		ns, name, ok := strings.Cut(key, "/")
+		if !ok || ns == "" || name == "" {
+			http.Error(w, "ingress must be given as namespace/name", http.StatusBadRequest)
+			return
+		}
+		ingress = &types.NamespacedName{Namespace: ns, Name: name}
+	}
+
+	resp, err := h.dump(r.URL.Query().Get("node"), ingress)
+	if err != nil {
+		h.logger.Errorw("Failed to dump snapshots", zap.Error(err))
+		http.Error(w, "failed to dump snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(resp); err != nil {
+		h.logger.Errorw("Failed to write debug response", zap.Error(err))
+	}
+}
+
+func (h *debugHandler) dump(nodeID string, ingress *types.NamespacedName) (*debugResponse, error) {
+	resp := &debugResponse{
+		Nodes:    make(map[string]debugNode),
+		Gateways: make([]debugGateway, 0),
+	}
+
+	for id, status := range h.xdsServer.NodeStatuses() {
+		if nodeID != "" && id != nodeID {
+			continue
+		}
+		node, err := dumpNode(status, ingress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump snapshot of node %q: %w", id, err)
+		}
+		resp.Nodes[id] = node
+	}
+
+	for _, gw := range h.xdsServer.ConnectedGateways() {
+		if nodeID != "" && gw.NodeID != nodeID {
+			continue
+		}
+		resp.Gateways = append(resp.Gateways, debugGateway{
+			NodeID:         gw.NodeID,
+			Address:        gw.Address,
+			Authenticated:  gw.Authenticated,
+			ConnectedSince: gw.ConnectedSince,
+		})
+	}
+	return resp, nil
+}
+
+func dumpNode(status envoy.NodeStatus, ingress *types.NamespacedName) (debugNode, error) {
+	node := debugNode{
+		LastAcceptedVersion: status.LastAcceptedVersion,
+		Acked:               status.Acked,
+	}
+	if len(status.Nacked) > 0 {
+		node.Nacked = make(map[string]debugRejection, len(status.Nacked))
+		for typeURL, rejection := range status.Nacked {
+			node.Nacked[typeURL] = debugRejection{Version: rejection.Version, Message: rejection.Message}
+		}
+	}
+	if status.Snapshot == nil {
+		return node, nil
+	}
+	node.Version = status.Snapshot.GetVersion(resource.ListenerType)
+
+	routes := sortedResources(status.Snapshot.GetResources(resource.RouteType))
+	clusters := sortedResources(status.Snapshot.GetResources(resource.ClusterType))
+	endpoints := sortedResources(status.Snapshot.GetResources(resource.EndpointType))
+	var listeners, secrets []cachetypes.Resource
+	if ingress == nil {
+		listeners = sortedResources(status.Snapshot.GetResources(resource.ListenerType))
+		secrets = sortedResources(status.Snapshot.GetResources(resource.SecretType))
+	} else {
+		var referenced map[string]bool
+		routes, referenced = filterRoutes(routes, generator.VirtualHostNamePrefix(ingress.Namespace, ingress.Name))
+		clusters = filterResources(clusters, referenced)
+		endpoints = filterResources(endpoints, referenced)
+	}
+
+	var err error
+	for _, dump := range []struct {
+		into      *[]json.RawMessage
+		resources []cachetypes.Resource
+	}{
+		{&node.Listeners, listeners},
+		{&node.Routes, routes},
+		{&node.Clusters, clusters},
+		{&node.Endpoints, endpoints},
+		{&node.Secrets, secrets},
+	} {
+		if *dump.into, err = marshalResources(dump.resources); err != nil {
+			return node, err
+		}
+	}
+	return node, nil
+}
+
+// filterRoutes reduces the given route configurations to the virtual hosts whose
+// names have the given prefix. It also returns the names of the clusters the
+// remaining routes refer to.
+func filterRoutes(routes []cachetypes.Resource, prefix string) ([]cachetypes.Resource, map[string]bool) {
+	referenced := make(map[string]bool)
+	filtered := make([]cachetypes.Resource, 0, len(routes))
+	for _, r := range routes {
+		config, ok := r.(*route.RouteConfiguration)
+		if !ok {
+			continue
+		}
+
+		var vhosts []*route.VirtualHost
+		for _, vhost := range config.GetVirtualHosts() {
+			if !strings.HasPrefix(vhost.GetName(), prefix) {
+				continue
+			}
+			vhosts = append(vhosts, vhost)
+			for _, rt := range vhost.GetRoutes() {
+				if cluster := rt.GetRoute().GetCluster(); cluster != "" {
+					referenced[cluster] = true
+				}
+				for _, wc := range rt.GetRoute().GetWeightedClusters().GetClusters() {
+					referenced[wc.GetName()] = true
+				}
+			}
+		}
+		if len(vhosts) == 0 {
+			continue
+		}
+
+		config = proto.Clone(config).(*route.RouteConfiguration)
+		config.VirtualHosts = vhosts
+		filtered = append(filtered, config)
+	}
+	return filtered, referenced
+}
+
+// filterResources returns the resources with the given names.
+func filterResources(resources []cachetypes.Resource, names map[string]bool) []cachetypes.Resource {
+	filtered := make([]cachetypes.Resource, 0, len(resources))
+	for _, r := range resources {
+		name := cache.GetResourceName(r)
+		if cla, ok := r.(*endpoint.ClusterLoadAssignment); ok {
+			name = cla.GetClusterName()
+		}
+		if names[name] {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+func sortedResources(resources map[string]cachetypes.Resource) []cachetypes.Resource {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sorted := make([]cachetypes.Resource, 0, len(names))
+	for _, name := range names {
+		sorted = append(sorted, resources[name])
+	}
+	return sorted
+}
+
+// marshalResources returns the JSON representation of the given resources with
+// all private keys redacted.
+func marshalResources(resources []cachetypes.Resource) ([]json.RawMessage, error) {
+	if len(resources) == 0 {
+		return nil, nil
+	}
+
+	out := make([]json.RawMessage, 0, len(resources))
+	for _, r := range resources {
+		// The resources are shared with the snapshot cache, so redact a copy.
+		r = proto.Clone(r)
+		if err := envoyapi.RedactSecrets(r); err != nil {
+			return nil, err
+		}
+		b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %q: %w", cache.GetResourceName(r), err)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// runDebugServer serves the given handler on the given port until the context
+// is done. It only listens on the loopback interface, so that the bearer tokens
+// never cross the network in plaintext. It's reached through port forwarding.
+func runDebugServer(ctx context.Context, port int, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              fmt.Sprintf("127.0.0.1:%d", port),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -20,7 +20,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	"k8s.io/apimachinery/pkg/types"
 	envoy "knative.dev/net-kourier/pkg/envoy/server"
 	"knative.dev/net-kourier/pkg/generator"
@@ -44,6 +47,13 @@ type Reconciler struct {
 	ingressTranslator *generator.IngressTranslator
 	extAuthz          bool
 
+	// rejections tracks the ingresses whose configuration the gateways rejected.
+	rejections rejections
+	// configAcks tracks how long it takes for the gateways to accept new ingress
+	// generations.
+	configAcks configAcks
+	metrics    *metrics
+
 	// resyncConflicts triggers a filtered global resync to reenqueue all ingresses in
 	// a "Conflict" state.
 	resyncConflicts func()
@@ -59,6 +69,7 @@ var (
 func (r *Reconciler) ReconcileKind(ctx context.Context, ing *v1alpha1.Ingress) reconciler.Event {
 	ing.SetDefaults(ctx)
 	before := ing.DeepCopy()
+	r.configAcks.seen(ing, time.Now())
 
 	if err := r.updateIngress(ctx, ing); errors.Is(err, generator.ErrDomainConflict) {
 		// If we had an error due to a duplicated domain, we must mark the ingress as failed with a
@@ -66,6 +77,12 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, ing *v1alpha1.Ingress) r
 		logging.FromContext(ctx).Info(err.Error())
 		ing.Status.MarkLoadBalancerFailed(conflictReason, "Ingress rejected: "+err.Error())
 		return nil
+	} else if errors.Is(err, errConfigRejected) {
+		// The gateways have been rolled back to the last config they accepted, which doesn't
+		// contain this ingress. It stays failed until it is changed.
+		logging.FromContext(ctx).Info(err.Error())
+		ing.Status.MarkLoadBalancerFailed(configRejectedReason, "Ingress rejected: "+err.Error())
+		return nil
 	} else if err != nil {
 		ing.Status.MarkIngressNotReady(notReconciledReason, err.Error())
 		return fmt.Errorf("failed to update ingress: %w", err)
@@ -78,7 +95,7 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, ing *v1alpha1.Ingress) r
 			return fmt.Errorf("failed to probe Ingress: %w", err)
 		}
 		if ready {
-			external, internal := config.ServiceHostnames()
+			external, internal := config.ServiceHostnames(config.GatewayNodeID(ing.Labels, ing.Annotations))
 
 			ing.Status.MarkLoadBalancerReady(
 				[]v1alpha1.LoadBalancerIngressStatus{{DomainInternal: external}},
@@ -94,7 +111,7 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, ing *v1alpha1.Ingress) r
 
 // isExpectedLoadBalancer verifies if expected Loadbalancer is set in status field.
 func isExpectedLoadBalancer(ing *v1alpha1.Ingress) bool {
-	external, internal := config.ServiceHostnames()
+	external, internal := config.ServiceHostnames(config.GatewayNodeID(ing.Labels, ing.Annotations))
 	if ing.Status.PublicLoadBalancer == nil || len(ing.Status.PublicLoadBalancer.Ingress) < 1 ||
 		ing.Status.PublicLoadBalancer.Ingress[0].DomainInternal != external {
 		return false
@@ -113,6 +130,10 @@ func (r *Reconciler) ObserveKind(ctx context.Context, ing *v1alpha1.Ingress) rec
 		// If we had an error due to a duplicated domain, just abort.
 		logging.FromContext(ctx).Info(err.Error())
 		return nil
+	} else if errors.Is(err, errConfigRejected) {
+		// If the gateways rejected the ingress, just abort.
+		logging.FromContext(ctx).Info(err.Error())
+		return nil
 	} else if err != nil {
 		return fmt.Errorf("failed to update ingress: %w", err)
 	}
@@ -125,12 +146,14 @@ func (r *Reconciler) ObserveDeletion(ctx context.Context, key types.NamespacedNa
 	logger.Infof("Ingress deleted, updating config")
 
 	r.statusManager.CancelIngressProbingByKey(key)
+	r.rejections.forget(key)
+	r.configAcks.forget(key)
 
 	if err := r.caches.DeleteIngressInfo(ctx, key.Name, key.Namespace); err != nil {
 		return err
 	}
 
-	if err := r.updateEnvoyConfig(ctx); err != nil {
+	if err := r.updateEnvoyConfig(ctx, nil); err != nil {
 		return fmt.Errorf("failed updating envoy config: %w", err)
 	}
 
@@ -147,22 +170,56 @@ func (r *Reconciler) updateIngress(ctx context.Context, ingress *v1alpha1.Ingres
 	logger := logging.FromContext(ctx)
 	logger.Infof("Updating Ingress")
 
+	if message, rejected := r.rejections.isRejected(ingress); rejected {
+		return fmt.Errorf("%w: %s", errConfigRejected, message)
+	}
+
 	if err := generator.UpdateInfoForIngress(
 		ctx, r.caches, ingress, r.ingressTranslator, r.extAuthz); err != nil {
 		return err
 	}
 
-	return r.updateEnvoyConfig(ctx)
+	return r.updateEnvoyConfig(ctx, ingress)
 }
 
-func (r *Reconciler) updateEnvoyConfig(ctx context.Context) error {
+// updateEnvoyConfig pushes the current config to all fleets of gateways. The given
+// ingress, if any, is the one that changed the config.
+func (r *Reconciler) updateEnvoyConfig(ctx context.Context, ingress *v1alpha1.Ingress) error {
 	logger := logging.FromContext(ctx)
-	logger.Debugf("Preparing Envoy Snapshot")
+	logger.Debugf("Preparing Envoy Snapshots")
 
-	newSnapshot, err := r.caches.ToEnvoySnapshot(ctx)
+	snapshots, err := r.caches.ToEnvoySnapshots(ctx)
 	if err != nil {
 		return err
 	}
 
-	return r.xdsServer.SetSnapshot(nodeID, newSnapshot)
+	for nodeID, snapshot := range snapshots {
+		if err := r.pushSnapshot(ctx, nodeID, snapshot, ingress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateFleetConfig pushes the current config to the given fleet of gateways, for
+// changes that only affect the config of the fleet itself.
+func (r *Reconciler) updateFleetConfig(ctx context.Context, nodeID string) error {
+	snapshot, err := r.caches.ToEnvoySnapshotForNode(ctx, nodeID)
+	if err != nil || snapshot == nil {
+		return err
+	}
+	return r.pushSnapshot(ctx, nodeID, snapshot, nil)
+}
+
+// pushSnapshot pushes the given snapshot to the given fleet of gateways. The given
+// ingress, if any, is the one that changed the config.
+func (r *Reconciler) pushSnapshot(ctx context.Context, nodeID string, snapshot *cache.Snapshot, ingress *v1alpha1.Ingress) error {
+	// Record the push before the gateways can possibly reject it.
+	version := snapshot.GetVersion(resource.ListenerType)
+	r.rejections.pushed(nodeID, version, ingress)
+	r.metrics.recordConfigAcks(ctx, nodeID, r.configAcks.pushed(nodeID, version, ingress, time.Now()))
+	if err := r.xdsServer.SetSnapshot(nodeID, snapshot); err != nil {
+		return fmt.Errorf("failed to set snapshot for gateway %q: %w", nodeID, err)
+	}
+	return nil
 }
@@ -23,6 +23,7 @@ import (
 
 	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -79,13 +80,17 @@ func TestReconcile(t *testing.T) {
 		Key:  "ns/name",
 		Objects: []runtime.Object{
 			ing("name", "ns", withBasicSpec, withKourier),
-			&corev1.Endpoints{
+			&discoveryv1.EndpointSlice{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      config.InternalServiceName,
+					Name:      config.InternalServiceName + "-abcde",
 					Namespace: config.GatewayNamespace(),
+					Labels: map[string]string{
+						discoveryv1.LabelServiceName: config.InternalServiceName,
+					},
 				},
-				Subsets: []corev1.EndpointSubset{{
-					Addresses: []corev1.EndpointAddress{{IP: "2.2.2.2"}},
+				AddressType: discoveryv1.AddressTypeIPv4,
+				Endpoints: []discoveryv1.Endpoint{{
+					Addresses: []string{"2.2.2.2"},
 				}},
 			},
 		},
@@ -103,6 +108,29 @@ func TestReconcile(t *testing.T) {
 				i.Status.MarkLoadBalancerNotReady()
 			}),
 		}},
+	}, {
+		Name: "ingress rejected by the gateway",
+		Key:  "ns/name",
+		Objects: []runtime.Object{
+			ing("name", "ns", withBasicSpec, withKourier),
+		},
+		OtherTestData: map[string]interface{}{
+			rejectedMessageKey: "bad listener",
+		},
+		WantEvents: []string{
+			rtesting.Eventf(corev1.EventTypeNormal, "FinalizerUpdate", "Updated %q finalizers", "name"),
+		},
+		WantPatches: []clientgotesting.PatchActionImpl{{
+			Name:  "name",
+			Patch: []byte(`{"metadata":{"finalizers":["ingresses.networking.internal.knative.dev"],"resourceVersion":""}}`),
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing("name", "ns", withBasicSpec, withKourier, func(i *v1alpha1.Ingress) {
+				i.Status.InitializeConditions()
+				i.Status.MarkLoadBalancerFailed(configRejectedReason,
+					"Ingress rejected: ingress configuration was rejected by the gateway: bad listener")
+			}),
+		}},
 	}}
 
 	table.Test(t, func(t *testing.T, tr *rtesting.TableRow) (
@@ -121,8 +149,8 @@ func TestReconcile(t *testing.T) {
 			func(_ string) ([]*corev1.ConfigMap, error) {
 				return ls.GetConfigMapLister().List(labels.NewSelector())
 			},
-			func(ns, name string) (*corev1.Endpoints, error) {
-				return ls.GetEndpointsLister().Endpoints(ns).Get(name)
+			func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+				return ls.GetEndpointSliceLister().EndpointSlices(ns).List(endpointSliceSelector(name))
 			},
 			func(ns, name string) (*corev1.Service, error) {
 				return ls.GetK8sServiceLister().Services(ns).Get(name)
@@ -146,7 +174,7 @@ func TestReconcile(t *testing.T) {
 
 		ctx = config.ToContext(ctx, config.FromContextOrDefaults(ctx))
 
-		c, _ := generator.NewCaches(ctx, kubeclient)
+		c, _ := generator.NewCaches(ctx, kubeclient, nil)
 
 		r := &Reconciler{
 			xdsServer:         server.NewXdsServer(18000, &xds.CallbackFuncs{}),
@@ -154,11 +182,21 @@ func TestReconcile(t *testing.T) {
 			ingressTranslator: &it,
 			extAuthz:          false,
 			resyncConflicts:   func() {},
+			metrics:           newMetrics(nil),
 			statusManager: status.NewProber(
-				nil, NewProbeTargetLister(logging.FromContext(ctx), ls.GetEndpointsLister()), nil,
+				nil, NewProbeTargetLister(logging.FromContext(ctx), ls.GetEndpointSliceLister()), nil,
 			),
 		}
 
+		if message, ok := tr.OtherTestData[rejectedMessageKey]; ok {
+			for _, obj := range tr.Objects {
+				if i, ok := obj.(*v1alpha1.Ingress); ok {
+					r.rejections.pushed(config.DefaultGatewayNodeID, "rejected", i)
+				}
+			}
+			r.rejections.reject(config.DefaultGatewayNodeID, "rejected", message.(string))
+		}
+
 		rr := ingressreconciler.NewReconciler(ctx,
 			logging.FromContext(ctx), fakenetworkingclient.Get(ctx),
 			ls.GetIngressLister(), controller.GetEventRecorder(ctx), r, config.KourierIngressClassName,
@@ -183,6 +221,10 @@ func TestReconcile(t *testing.T) {
 	})
 }
 
+// rejectedMessageKey marks the ingresses of a test as rejected by the gateway
+// with the given message.
+const rejectedMessageKey = "rejectedMessage"
+
 type testConfigStore struct {
 	config *config.Config
 }
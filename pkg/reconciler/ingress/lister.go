@@ -24,36 +24,47 @@ import (
 	"strconv"
 
 	"go.uber.org/zap"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
-	corev1listers "k8s.io/client-go/listers/core/v1"
+	discoveryv1listers "k8s.io/client-go/listers/discovery/v1"
 	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
 	"knative.dev/networking/pkg/apis/networking/v1alpha1"
 	"knative.dev/networking/pkg/status"
 )
 
-func NewProbeTargetLister(logger *zap.SugaredLogger, endpointsLister corev1listers.EndpointsLister) status.ProbeTargetLister {
+func NewProbeTargetLister(logger *zap.SugaredLogger, endpointSliceLister discoveryv1listers.EndpointSliceLister) status.ProbeTargetLister {
 	return &gatewayPodTargetLister{
-		logger:          logger,
-		endpointsLister: endpointsLister,
+		logger:              logger,
+		endpointSliceLister: endpointSliceLister,
 	}
 }
 
 type gatewayPodTargetLister struct {
-	logger          *zap.SugaredLogger
-	endpointsLister corev1listers.EndpointsLister
+	logger              *zap.SugaredLogger
+	endpointSliceLister discoveryv1listers.EndpointSliceLister
 }
 
-func (l *gatewayPodTargetLister) ListProbeTargets(_ context.Context, ing *v1alpha1.Ingress) ([]status.ProbeTarget, error) {
-	eps, err := l.endpointsLister.Endpoints(config.GatewayNamespace()).Get(config.InternalServiceName)
+func (l *gatewayPodTargetLister) ListProbeTargets(ctx context.Context, ing *v1alpha1.Ingress) ([]status.ProbeTarget, error) {
+	// Probe the gateways of the fleet the ingress is assigned to.
+	nodeID := config.DefaultGatewayNodeID
+	if ing != nil {
+		nodeID = config.GatewayNodeID(ing.Labels, ing.Annotations)
+	}
+	_, internalServiceName := config.ServiceNames(nodeID)
+	slices, err := l.endpointSliceLister.EndpointSlices(config.GatewayNamespace()).List(endpointSliceSelector(internalServiceName))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get internal service: %w", err)
 	}
 
+	// Only probe the addresses the listeners of the gateways bind to.
+	addressTypes := listenerAddressTypes(config.FromContextOrDefaults(ctx).Kourier.ListenerIPFamily)
+
 	var readyIPs []string
-	for _, sub := range eps.Subsets {
-		for _, address := range sub.Addresses {
-			readyIPs = append(readyIPs, address.IP)
+	for _, slice := range slices {
+		if !addressTypes.Has(slice.AddressType) {
+			continue
 		}
+		readyIPs = append(readyIPs, sets.List(readyAddresses(slice))...)
 	}
 	if len(readyIPs) == 0 {
 		return nil, errors.New("no gateway pods available")
@@ -98,6 +109,19 @@ func (l *gatewayPodTargetLister) getIngressUrls(ing *v1alpha1.Ingress, gatewayIp
 	return targets, nil
 }
 
+// listenerAddressTypes returns the address types of the EndpointSlices whose
+// addresses the listeners of the given IP family accept connections on.
+func listenerAddressTypes(family config.ListenerIPFamily) sets.Set[discoveryv1.AddressType] {
+	switch family {
+	case config.ListenerIPFamilyIPv6:
+		return sets.New(discoveryv1.AddressTypeIPv6)
+	case config.ListenerIPFamilyDualStack:
+		return sets.New(discoveryv1.AddressTypeIPv4, discoveryv1.AddressTypeIPv6)
+	default:
+		return sets.New(discoveryv1.AddressTypeIPv4)
+	}
+}
+
 func domainsToURL(domains []string, scheme string) []*url.URL {
 	urls := make([]*url.URL, 0, len(domains))
 	for _, domain := range domains {
@@ -33,12 +33,13 @@ import (
 	"knative.dev/pkg/kmeta"
 
 	"go.uber.org/zap/zaptest"
-	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
-	corev1listers "k8s.io/client-go/listers/core/v1"
+	discoveryv1listers "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/utils/ptr"
 )
 
 const (
@@ -47,15 +48,16 @@ const (
 
 func TestListProveTargets(t *testing.T) {
 	tests := []struct {
-		name            string
-		endpointsLister corev1listers.EndpointsLister
-		ingress         *v1alpha1.Ingress
-		errMessage      string
-		results         []status.ProbeTarget
+		name                string
+		endpointSliceLister discoveryv1listers.EndpointSliceLister
+		ipFamily            config.ListenerIPFamily
+		ingress             *v1alpha1.Ingress
+		errMessage          string
+		results             []status.ProbeTarget
 	}{
 		{
-			name: "endpoints error",
-			endpointsLister: &fakeEndpointsLister{
+			name: "endpoint slices error",
+			endpointSliceLister: &fakeEndpointSliceLister{
 				fails: true,
 			},
 			ingress:    &v1alpha1.Ingress{},
@@ -63,50 +65,55 @@ func TestListProveTargets(t *testing.T) {
 		},
 		{
 			name: "not found intertnal service name",
-			endpointsLister: &fakeEndpointsLister{
-				endpointses: []*v1.Endpoints{{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: gatewayNamespace,
-						Name:      "not-internal-service-name",
-					},
-				}},
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice("not-internal-service-name", "1.1.1.1"),
+				},
 			},
-			errMessage: "failed to get internal service:",
+			errMessage: "no gateway pods available",
 		},
 		{
-			name: "subset with no addresses",
-			endpointsLister: &fakeEndpointsLister{
-				endpointses: []*v1.Endpoints{{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: "default",
-						Name:      config.InternalServiceName,
-					},
-					Subsets: []v1.EndpointSubset{{
-						Ports: []v1.EndpointPort{{
-							Name: "bogus",
-							Port: 8080,
-						}},
-					}},
-				}},
+			name: "slice with no endpoints",
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, ""),
+				},
 			},
 			errMessage: "no gateway pods available",
 		},
+		{
+			name: "slice with no ready endpoints",
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1", func(slice *discoveryv1.EndpointSlice) {
+						slice.Endpoints[0].Conditions.Ready = ptr.To(false)
+					}),
+				},
+			},
+			errMessage: "no gateway pods available",
+		},
+		{
+			name: "multiple slices",
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
+					internalSlice(config.InternalServiceName, "2.2.2.2"),
+				},
+			},
+			ingress: ing("ing", gatewayNamespace,
+				withRule([]string{"foo.bar.com"}, v1alpha1.IngressVisibilityExternalIP),
+			),
+			results: []status.ProbeTarget{{
+				PodIPs:  sets.New("1.1.1.1", "2.2.2.2"),
+				PodPort: "8090",
+				URLs:    []*url.URL{{Scheme: "http", Host: "foo.bar.com", Path: "/"}},
+			}},
+		},
 		{
 			name: "externalIP and externalTLS",
-			endpointsLister: &fakeEndpointsLister{
-				endpointses: []*v1.Endpoints{
-					{
-						ObjectMeta: metav1.ObjectMeta{
-							Namespace: "default",
-							Name:      config.InternalServiceName,
-						},
-						Subsets: []v1.EndpointSubset{{
-							Ports: []v1.EndpointPort{},
-							Addresses: []v1.EndpointAddress{{
-								IP: "1.1.1.1",
-							}},
-						}},
-					},
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
 				},
 			},
 			ingress: ing("ing", gatewayNamespace,
@@ -121,20 +128,9 @@ func TestListProveTargets(t *testing.T) {
 		},
 		{
 			name: "externalIP and not externalTLS",
-			endpointsLister: &fakeEndpointsLister{
-				endpointses: []*v1.Endpoints{
-					{
-						ObjectMeta: metav1.ObjectMeta{
-							Namespace: "default",
-							Name:      config.InternalServiceName,
-						},
-						Subsets: []v1.EndpointSubset{{
-							Ports: []v1.EndpointPort{},
-							Addresses: []v1.EndpointAddress{{
-								IP: "1.1.1.1",
-							}},
-						}},
-					},
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
 				},
 			},
 			ingress: ing("ing", gatewayNamespace,
@@ -148,20 +144,9 @@ func TestListProveTargets(t *testing.T) {
 		},
 		{
 			name: "clousterLocal and localTLS",
-			endpointsLister: &fakeEndpointsLister{
-				endpointses: []*v1.Endpoints{
-					{
-						ObjectMeta: metav1.ObjectMeta{
-							Namespace: "default",
-							Name:      config.InternalServiceName,
-						},
-						Subsets: []v1.EndpointSubset{{
-							Ports: []v1.EndpointPort{},
-							Addresses: []v1.EndpointAddress{{
-								IP: "1.1.1.1",
-							}},
-						}},
-					},
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
 				},
 			},
 			ingress: ing("ing", gatewayNamespace,
@@ -176,20 +161,9 @@ func TestListProveTargets(t *testing.T) {
 		},
 		{
 			name: "clousterLocal and not localTLS",
-			endpointsLister: &fakeEndpointsLister{
-				endpointses: []*v1.Endpoints{
-					{
-						ObjectMeta: metav1.ObjectMeta{
-							Namespace: "default",
-							Name:      config.InternalServiceName,
-						},
-						Subsets: []v1.EndpointSubset{{
-							Ports: []v1.EndpointPort{},
-							Addresses: []v1.EndpointAddress{{
-								IP: "1.1.1.1",
-							}},
-						}},
-					},
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
 				},
 			},
 			ingress: ing("ing", gatewayNamespace,
@@ -201,6 +175,87 @@ func TestListProveTargets(t *testing.T) {
 				URLs:    []*url.URL{{Scheme: "http", Host: "foo.bar.com", Path: "/"}},
 			}},
 		},
+		{
+			name: "ingress assigned to another fleet of gateways",
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
+					internalSlice(config.InternalServiceName+"-tenant-a", "2.2.2.2"),
+				},
+			},
+			ingress: ing("ing", gatewayNamespace,
+				withRule([]string{"foo.bar.com"}, v1alpha1.IngressVisibilityClusterLocal),
+				withAnnotation(map[string]string{"kourier.knative.dev/gateway": "tenant-a"}),
+			),
+			results: []status.ProbeTarget{{
+				PodIPs:  sets.New("2.2.2.2"),
+				PodPort: "8081",
+				URLs:    []*url.URL{{Scheme: "http", Host: "foo.bar.com", Path: "/"}},
+			}},
+		},
+		{
+			name: "dual stack slices with IPv4 listeners",
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
+					internalSlice(config.InternalServiceName, "fd00::1", withAddressType(discoveryv1.AddressTypeIPv6)),
+				},
+			},
+			ingress: ing("ing", gatewayNamespace,
+				withRule([]string{"foo.bar.com"}, v1alpha1.IngressVisibilityExternalIP),
+			),
+			results: []status.ProbeTarget{{
+				PodIPs:  sets.New("1.1.1.1"),
+				PodPort: "8090",
+				URLs:    []*url.URL{{Scheme: "http", Host: "foo.bar.com", Path: "/"}},
+			}},
+		},
+		{
+			name: "dual stack slices with IPv6 listeners",
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
+					internalSlice(config.InternalServiceName, "fd00::1", withAddressType(discoveryv1.AddressTypeIPv6)),
+				},
+			},
+			ipFamily: config.ListenerIPFamilyIPv6,
+			ingress: ing("ing", gatewayNamespace,
+				withRule([]string{"foo.bar.com"}, v1alpha1.IngressVisibilityExternalIP),
+			),
+			results: []status.ProbeTarget{{
+				PodIPs:  sets.New("fd00::1"),
+				PodPort: "8090",
+				URLs:    []*url.URL{{Scheme: "http", Host: "foo.bar.com", Path: "/"}},
+			}},
+		},
+		{
+			name: "dual stack slices with dual stack listeners",
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
+					internalSlice(config.InternalServiceName, "fd00::1", withAddressType(discoveryv1.AddressTypeIPv6)),
+				},
+			},
+			ipFamily: config.ListenerIPFamilyDualStack,
+			ingress: ing("ing", gatewayNamespace,
+				withRule([]string{"foo.bar.com"}, v1alpha1.IngressVisibilityExternalIP),
+			),
+			results: []status.ProbeTarget{{
+				PodIPs:  sets.New("1.1.1.1", "fd00::1"),
+				PodPort: "8090",
+				URLs:    []*url.URL{{Scheme: "http", Host: "foo.bar.com", Path: "/"}},
+			}},
+		},
+		{
+			name: "IPv4 slices with IPv6 listeners",
+			endpointSliceLister: &fakeEndpointSliceLister{
+				slices: []*discoveryv1.EndpointSlice{
+					internalSlice(config.InternalServiceName, "1.1.1.1"),
+				},
+			},
+			ipFamily:   config.ListenerIPFamilyIPv6,
+			errMessage: "no gateway pods available",
+		},
 	}
 
 	for _, test := range tests {
@@ -208,10 +263,14 @@ func TestListProveTargets(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			lister := NewProbeTargetLister(
 				zaptest.NewLogger(t).Sugar(),
-				test.endpointsLister,
+				test.endpointSliceLister,
 			)
 
-			results, err := lister.ListProbeTargets(context.Background(), test.ingress)
+			cfg := config.FromContextOrDefaults(context.Background())
+			cfg.Kourier.ListenerIPFamily = test.ipFamily
+			ctx := config.ToContext(context.Background(), cfg)
+
+			results, err := lister.ListProbeTargets(ctx, test.ingress)
 			if err == nil {
 				if test.errMessage != "" {
 					t.Fatalf("expected error message %q, saw no error", test.errMessage)
@@ -233,30 +292,59 @@ func TestListProveTargets(t *testing.T) {
 	}
 }
 
-type fakeEndpointsLister struct {
-	endpointses []*v1.Endpoints
-	fails       bool
+type fakeEndpointSliceLister struct {
+	slices []*discoveryv1.EndpointSlice
+	fails  bool
 }
 
-func (l *fakeEndpointsLister) List(_ labels.Selector) ([]*v1.Endpoints, error) {
-	log.Panic("not implemented")
-	return nil, nil
+func (l *fakeEndpointSliceLister) List(selector labels.Selector) ([]*discoveryv1.EndpointSlice, error) {
+	if l.fails {
+		return nil, errors.New("failed to list EndpointSlices")
+	}
+	var res []*discoveryv1.EndpointSlice
+	for _, slice := range l.slices {
+		if selector.Matches(labels.Set(slice.Labels)) {
+			res = append(res, slice)
+		}
+	}
+	return res, nil
 }
 
-func (l *fakeEndpointsLister) Endpoints(_ string) corev1listers.EndpointsNamespaceLister {
+func (l *fakeEndpointSliceLister) EndpointSlices(_ string) discoveryv1listers.EndpointSliceNamespaceLister {
 	return l
 }
 
-func (l *fakeEndpointsLister) Get(name string) (*v1.Endpoints, error) {
-	if l.fails {
-		return nil, errors.New("failed to get Endpoints")
+func (l *fakeEndpointSliceLister) Get(_ string) (*discoveryv1.EndpointSlice, error) {
+	log.Panic("not implemented")
+	return nil, nil
+}
+
+func internalSlice(serviceName string, ip string, opts ...func(*discoveryv1.EndpointSlice)) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: gatewayNamespace,
+			Name:      serviceName + "-" + ip,
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: serviceName,
+			},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
 	}
-	for _, ep := range l.endpointses {
-		if ep.Name == name {
-			return ep, nil
-		}
+	if ip != "" {
+		slice.Endpoints = []discoveryv1.Endpoint{{
+			Addresses: []string{ip},
+		}}
+	}
+	for _, opt := range opts {
+		opt(slice)
+	}
+	return slice
+}
+
+func withAddressType(addressType discoveryv1.AddressType) func(*discoveryv1.EndpointSlice) {
+	return func(slice *discoveryv1.EndpointSlice) {
+		slice.AddressType = addressType
 	}
-	return nil, errors.New("not found")
 }
 
 type ingressOption func(*v1alpha1.Ingress)
@@ -0,0 +1,201 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/pkg/observability/attributekey"
+)
+
+const scopeName = "knative.dev/net-kourier/pkg/reconciler/ingress"
+
+// nodeIDAttr is the node ID of the fleet of gateways that accepted a config.
+var nodeIDAttr = attributekey.String("kn.kourier.node_id")
+
+type metrics struct {
+	configAckDuration metric.Float64Histogram
+}
+
+func newMetrics(provider metric.MeterProvider) *metrics {
+	var (
+		m   metrics
+		err error
+	)
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+	meter := provider.Meter(scopeName)
+
+	m.configAckDuration, err = meter.Float64Histogram(
+		"kn.kourier.ingress.config.ack.duration",
+		metric.WithDescription("The duration from the reconciler seeing a new ingress generation until the gateways accepted its config. Generations accepted together are measured once, from the oldest one."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &m
+}
+
+func (m *metrics) recordConfigAcks(ctx context.Context, nodeID string, durations []time.Duration) {
+	for _, d := range durations {
+		m.configAckDuration.Record(ctx, d.Seconds(), metric.WithAttributes(nodeIDAttr.With(nodeID)))
+	}
+}
+
+// pendingAcks tracks the new ingress generations pushed to a fleet of gateways
+// that haven't been accepted yet. Only the oldest generation is kept: accepting the
+// latest version completes all of them at once, and the oldest one waited the longest.
+type pendingAcks struct {
+	pushedVersion   string
+	acceptedVersion string
+	// since is the time the oldest pending generation was seen, zero if none is pending.
+	since time.Time
+}
+
+// seenGeneration is the latest generation of an ingress seen by the reconciler.
+type seenGeneration struct {
+	generation int64
+	since      time.Time
+	// pushed is true once the config of the generation has been pushed.
+	pushed bool
+}
+
+// configAcks measures the time it takes from the reconciler seeing a new ingress
+// generation until its config is accepted by the gateways it is pushed to.
+type configAcks struct {
+	mu sync.Mutex
+
+	generations map[types.NamespacedName]*seenGeneration
+	nodes       map[string]*pendingAcks
+}
+
+// seen records that the reconciler saw the given ingress. A new generation is
+// measured from the first time it is seen, so retries of a failed reconciliation
+// are included.
+func (c *configAcks) seen(ing *v1alpha1.Ingress, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation(ing, now)
+}
+
+// pushed records that a snapshot with the given version was pushed to the given
+// fleet of gateways. The ingress is the one that changed the config, if any. It
+// returns the durations of generations that are accepted already.
+func (c *configAcks) pushed(nodeID, version string, ing *v1alpha1.Ingress, now time.Time) []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node := c.node(nodeID)
+	node.pushedVersion = version
+	if ing == nil || config.GatewayNodeID(ing.Labels, ing.Annotations) != nodeID {
+		return nil
+	}
+
+	seen := c.generation(ing, now)
+	if seen.pushed {
+		return nil
+	}
+	seen.pushed = true
+
+	if version == node.acceptedVersion {
+		// The new generation didn't change the config the gateways already accepted.
+		return []time.Duration{now.Sub(seen.since)}
+	}
+	if node.since.IsZero() || seen.since.Before(node.since) {
+		node.since = seen.since
+	}
+	return nil
+}
+
+// accepted records that the given fleet of gateways accepted the snapshot with
+// the given version and returns the duration of the oldest push it completes.
+func (c *configAcks) accepted(nodeID, version string, now time.Time) []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node := c.node(nodeID)
+	node.acceptedVersion = version
+	if version != node.pushedVersion {
+		// Accepting an older version doesn't mean the latest generations are live.
+		return nil
+	}
+
+	if node.since.IsZero() {
+		return []time.Duration{}
+	}
+	duration := now.Sub(node.since)
+	node.since = time.Time{}
+	return []time.Duration{duration}
+}
+
+// rejected records that the given fleet of gateways rejected the pushed config and
+// rolled back. The pending pushes are dropped, as they will never be accepted.
+func (c *configAcks) rejected(nodeID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node := c.node(nodeID)
+	node.pushedVersion = node.acceptedVersion
+	node.since = time.Time{}
+}
+
+// forget stops tracking the given ingress.
+func (c *configAcks) forget(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.generations, key)
+}
+
+// generation returns the latest generation seen of the given ingress, starting to
+// track it at the given time if it is new.
+func (c *configAcks) generation(ing *v1alpha1.Ingress, now time.Time) *seenGeneration {
+	key := types.NamespacedName{Namespace: ing.Namespace, Name: ing.Name}
+	seen := c.generations[key]
+	if seen == nil || seen.generation != ing.Generation {
+		if c.generations == nil {
+			c.generations = make(map[types.NamespacedName]*seenGeneration)
+		}
+		seen = &seenGeneration{generation: ing.Generation, since: now}
+		c.generations[key] = seen
+	}
+	return seen
+}
+
+func (c *configAcks) node(nodeID string) *pendingAcks {
+	if c.nodes == nil {
+		c.nodes = make(map[string]*pendingAcks)
+	}
+	node := c.nodes[nodeID]
+	if node == nil {
+		node = &pendingAcks{}
+		c.nodes[nodeID] = node
+	}
+	return node
+}
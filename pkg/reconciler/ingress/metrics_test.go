@@ -0,0 +1,90 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+)
+
+func TestConfigAcks(t *testing.T) {
+	var acks configAcks
+	start := time.Now()
+	at := func(d time.Duration) time.Time {
+		return start.Add(d)
+	}
+	ingress := func(generation int64) *v1alpha1.Ingress {
+		return &v1alpha1.Ingress{ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "ns",
+			Name:       "foo",
+			Generation: generation,
+		}}
+	}
+	nodeID := config.DefaultGatewayNodeID
+
+	// Pushes not caused by an ingress aren't measured.
+	assert.Assert(t, acks.pushed(nodeID, "1", nil, at(0)) == nil)
+	assert.DeepEqual(t, acks.accepted(nodeID, "1", at(time.Second)), []time.Duration{})
+
+	// The push of a new generation is measured until the gateways accept it.
+	assert.Assert(t, acks.pushed(nodeID, "2", ingress(1), at(time.Second)) == nil)
+	// Accepting an older version doesn't complete the push.
+	assert.Assert(t, acks.accepted(nodeID, "1", at(2*time.Second)) == nil)
+	assert.DeepEqual(t, acks.accepted(nodeID, "2", at(3*time.Second)), []time.Duration{2 * time.Second})
+
+	// Reconciling the same generation again isn't measured.
+	assert.Assert(t, acks.pushed(nodeID, "3", ingress(1), at(4*time.Second)) == nil)
+	assert.DeepEqual(t, acks.accepted(nodeID, "3", at(5*time.Second)), []time.Duration{})
+
+	// A new generation that doesn't change the accepted config is accepted right away.
+	assert.DeepEqual(t, acks.pushed(nodeID, "3", ingress(2), at(6*time.Second)), []time.Duration{0})
+
+	// Superseded pushes are completed by accepting the latest one, measured from the oldest.
+	assert.Assert(t, acks.pushed(nodeID, "4", ingress(3), at(7*time.Second)) == nil)
+	assert.Assert(t, acks.pushed(nodeID, "5", ingress(4), at(8*time.Second)) == nil)
+	assert.DeepEqual(t, acks.accepted(nodeID, "5", at(10*time.Second)), []time.Duration{3 * time.Second})
+
+	// Ingresses are only measured on their own fleet of gateways.
+	assert.Assert(t, acks.pushed("tenant-a", "6", ingress(5), at(11*time.Second)) == nil)
+	assert.DeepEqual(t, acks.accepted("tenant-a", "6", at(12*time.Second)), []time.Duration{})
+
+	// Forgotten ingresses are measured again.
+	acks.forget(types.NamespacedName{Namespace: "ns", Name: "foo"})
+	assert.Assert(t, acks.pushed(nodeID, "7", ingress(4), at(13*time.Second)) == nil)
+	assert.DeepEqual(t, acks.accepted(nodeID, "7", at(14*time.Second)), []time.Duration{time.Second})
+
+	// Rejected pushes are dropped, so they don't inflate the next accepted push.
+	assert.Assert(t, acks.pushed(nodeID, "8", ingress(5), at(15*time.Second)) == nil)
+	acks.rejected(nodeID)
+	assert.Assert(t, acks.accepted(nodeID, "8", at(16*time.Second)) == nil)
+	assert.Assert(t, acks.pushed(nodeID, "9", ingress(6), at(20*time.Second)) == nil)
+	assert.DeepEqual(t, acks.accepted(nodeID, "9", at(21*time.Second)), []time.Duration{time.Second})
+
+	// Generations are measured from the first time the reconciler saw them, retries included.
+	acks.seen(ingress(7), at(22*time.Second))
+	acks.seen(ingress(7), at(23*time.Second))
+	assert.Assert(t, acks.pushed(nodeID, "10", ingress(7), at(24*time.Second)) == nil)
+	assert.DeepEqual(t, acks.accepted(nodeID, "10", at(25*time.Second)), []time.Duration{3 * time.Second})
+	acks.seen(ingress(8), at(26*time.Second))
+	assert.DeepEqual(t, acks.pushed(nodeID, "10", ingress(8), at(27*time.Second)), []time.Duration{time.Second})
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"errors"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+)
+
+const configRejectedReason = "ConfigRejected"
+
+// errConfigRejected is returned for ingresses whose configuration has been
+// rejected by the gateways.
+var errConfigRejected = errors.New("ingress configuration was rejected by the gateway")
+
+type rejection struct {
+	generation int64
+	message    string
+}
+
+// push is the snapshot last pushed to a fleet of gateways along with the ingress
+// that caused it, if any.
+type push struct {
+	version    string
+	ingress    types.NamespacedName
+	generation int64
+}
+
+// rejections keeps track of which ingress caused the snapshot last pushed to each
+// fleet of gateways, so that a rejection of that snapshot can be attributed to it,
+// and of the ingresses whose configuration got rejected.
+type rejections struct {
+	mu sync.Mutex
+
+	lastPushes map[string]push
+	rejected   map[types.NamespacedName]rejection
+}
+
+// pushed records that the given ingress caused a snapshot with the given version
+// to be pushed to the given fleet of gateways. The ingress is nil if the push
+// wasn't caused by an ingress change.
+func (r *rejections) pushed(nodeID, version string, ing *v1alpha1.Ingress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.lastPushes[nodeID].version == version {
+		// The config didn't change, so the ingress that changed it still is to blame.
+		return
+	}
+
+	p := push{version: version}
+	if ing != nil {
+		p.ingress = types.NamespacedName{Namespace: ing.Namespace, Name: ing.Name}
+		p.generation = ing.Generation
+	}
+	if r.lastPushes == nil {
+		r.lastPushes = make(map[string]push)
+	}
+	r.lastPushes[nodeID] = p
+}
+
+// reject marks the ingress that caused the snapshot with the given version to be
+// pushed to the given fleet of gateways as rejected and returns it. It returns
+// false if no ingress can be blamed.
+func (r *rejections) reject(nodeID, version, message string) (types.NamespacedName, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.lastPushes[nodeID]
+	if !ok || p.version != version || p.ingress.Name == "" {
+		return types.NamespacedName{}, false
+	}
+
+	if r.rejected == nil {
+		r.rejected = make(map[types.NamespacedName]rejection)
+	}
+	r.rejected[p.ingress] = rejection{generation: p.generation, message: message}
+	return p.ingress, true
+}
+
+// isRejected returns the reason the configuration of the given ingress has been
+// rejected for. A new generation of the ingress is given another chance.
+func (r *rejections) isRejected(ing *v1alpha1.Ingress) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: ing.Namespace, Name: ing.Name}
+	rejected, ok := r.rejected[key]
+	if !ok {
+		return "", false
+	}
+	if rejected.generation != ing.Generation {
+		delete(r.rejected, key)
+		return "", false
+	}
+	return rejected.message, true
+}
+
+// forget drops any rejection of the given ingress.
+func (r *rejections) forget(key types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.rejected, key)
+}
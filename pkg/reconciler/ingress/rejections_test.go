@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+)
+
+const testNodeID = "test-gateway"
+
+func TestRejections(t *testing.T) {
+	var r rejections
+	foo := ing("foo", "ns")
+	bar := ing("bar", "ns")
+
+	// Nothing is blamed for versions that weren't pushed by an ingress.
+	r.pushed(testNodeID, "1", nil)
+	_, ok := r.reject(testNodeID, "1", "bad config")
+	assert.Assert(t, !ok)
+
+	// A version is blamed on the ingress that first produced it.
+	r.pushed(testNodeID, "2", foo)
+	r.pushed(testNodeID, "2", bar)
+	_, ok = r.reject(testNodeID, "1", "bad config")
+	assert.Assert(t, !ok)
+	key, ok := r.reject(testNodeID, "2", "bad config")
+	assert.Assert(t, ok)
+	assert.Equal(t, key, types.NamespacedName{Namespace: "ns", Name: "foo"})
+
+	message, rejected := r.isRejected(foo)
+	assert.Assert(t, rejected)
+	assert.Equal(t, message, "bad config")
+	_, rejected = r.isRejected(bar)
+	assert.Assert(t, !rejected)
+
+	// A new generation gets another chance.
+	updated := ing("foo", "ns", func(i *v1alpha1.Ingress) {
+		i.Generation = foo.Generation + 1
+	})
+	_, rejected = r.isRejected(updated)
+	assert.Assert(t, !rejected)
+
+	// Versions are tracked per fleet of gateways.
+	r.pushed("other-gateway", "2", bar)
+	_, ok = r.reject("other-gateway", "3", "bad config")
+	assert.Assert(t, !ok)
+
+	// Deleted ingresses are forgotten.
+	r.pushed(testNodeID, "3", bar)
+	_, ok = r.reject(testNodeID, "3", "bad config")
+	assert.Assert(t, ok)
+	r.forget(types.NamespacedName{Namespace: "ns", Name: "bar"})
+	_, rejected = r.isRejected(bar)
+	assert.Assert(t, !rejected)
+}
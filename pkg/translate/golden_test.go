@@ -0,0 +1,134 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package translate
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	envoy "knative.dev/net-kourier/pkg/envoy/api"
+)
+
+var update = flag.Bool("update", false, "Regenerate the golden files of TestGolden.")
+
+const (
+	goldenDir  = "testdata/golden"
+	goldenFile = "expected.json"
+)
+
+// TestGolden translates each case in testdata/golden and compares the snapshots
+// to the golden file of the case. A case is a directory of manifests, the
+// config-kourier and config-network ConfigMaps included, and the snapshots they
+// are expected to render as in expected.json.
+//
+// To add a case or to accept a change in the generated config, run
+//
+//	go test ./pkg/translate -run TestGolden -update
+//
+// and review the diff of the golden files.
+func TestGolden(t *testing.T) {
+	entries, err := os.ReadDir(goldenDir)
+	assert.NilError(t, err)
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(goldenDir, entry.Name())
+
+		t.Run(entry.Name(), func(t *testing.T) {
+			snapshots, err := Snapshots(context.Background(), decodeCase(t, dir))
+			assert.NilError(t, err)
+			// The golden files only hold test certificates, render them to cover the secrets.
+			got, err := Render(snapshots, FormatJSON, WithSecrets())
+			assert.NilError(t, err)
+
+			golden := filepath.Join(dir, goldenFile)
+			if *update {
+				assert.NilError(t, os.WriteFile(golden, got, 0o644)) //nolint:gosec // Golden files aren't secret.
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			assert.NilError(t, err, "run with -update to create the golden file")
+			if diff := cmp.Diff(string(want), string(got)); diff != "" {
+				t.Errorf("Snapshots differ from %s (-want, +got):\n%s\nRun with -update to accept the changes.", golden, diff)
+			}
+		})
+	}
+}
+
+// decodeCase decodes the manifests of the given golden case.
+func decodeCase(t *testing.T, dir string) []runtime.Object {
+	t.Helper()
+
+	manifests, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	assert.NilError(t, err)
+	assert.Assert(t, len(manifests) > 0, "case %s has no manifests", dir)
+
+	var objects []runtime.Object
+	for _, manifest := range manifests {
+		f, err := os.Open(manifest)
+		assert.NilError(t, err)
+		objs, err := Decode(f)
+		f.Close()
+		assert.NilError(t, err, "failed to decode %s", manifest)
+		objects = append(objects, objs...)
+	}
+	return objects
+}
+
+func TestRenderRedactsSecrets(t *testing.T) {
+	snapshots, err := Snapshots(context.Background(), decodeCase(t, filepath.Join(goldenDir, "tls")))
+	assert.NilError(t, err)
+
+	var privateKeys, certificates []string
+	for _, snapshot := range snapshots {
+		for _, r := range snapshot.GetResources(resource.SecretType) {
+			tlsCertificate := r.(*tlsv3.Secret).GetTlsCertificate()
+			privateKeys = append(privateKeys, base64.StdEncoding.EncodeToString(tlsCertificate.GetPrivateKey().GetInlineBytes()))
+			certificates = append(certificates, base64.StdEncoding.EncodeToString(tlsCertificate.GetCertificateChain().GetInlineBytes()))
+		}
+	}
+	assert.Assert(t, len(privateKeys) > 0)
+
+	redacted, err := Render(snapshots, FormatJSON)
+	assert.NilError(t, err)
+	withSecrets, err := Render(snapshots, FormatJSON, WithSecrets())
+	assert.NilError(t, err)
+
+	assert.Assert(t, strings.Contains(string(redacted), envoy.Redacted))
+	for _, privateKey := range privateKeys {
+		assert.Assert(t, !strings.Contains(string(redacted), privateKey))
+		// Redacting doesn't change the snapshots served to the gateways.
+		assert.Assert(t, strings.Contains(string(withSecrets), privateKey))
+	}
+	// The certificates aren't secret.
+	for _, certificate := range certificates {
+		assert.Assert(t, strings.Contains(string(redacted), certificate))
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	cachetypes "github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	envoy "knative.dev/net-kourier/pkg/envoy/api"
+	"sigs.k8s.io/yaml"
+
+	// The generator refers to these by type URL only, but they have to be known
+	// to render them.
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/tls_inspector/v3"
+)
+
+// Format is the format snapshots are rendered in.
+type Format string
+
+const (
+	// FormatJSON renders snapshots as indented JSON.
+	FormatJSON Format = "json"
+	// FormatYAML renders snapshots as YAML.
+	FormatYAML Format = "yaml"
+)
+
+// node is the rendered snapshot of a fleet of gateways.
+type node struct {
+	Version   string            `json:"version"`
+	Listeners []json.RawMessage `json:"listeners,omitempty"`
+	Routes    []json.RawMessage `json:"routes,omitempty"`
+	Clusters  []json.RawMessage `json:"clusters,omitempty"`
+	Endpoints []json.RawMessage `json:"endpoints,omitempty"`
+	Secrets   []json.RawMessage `json:"secrets,omitempty"`
+}
+
+// RenderOption changes how snapshots are rendered.
+type RenderOption func(*renderOptions)
+
+type renderOptions struct {
+	secrets bool
+}
+
+// WithSecrets renders private keys and secrets as they are served to the gateways.
+// They are redacted otherwise, as the output tends to end up in CI logs and bug
+// reports.
+func WithSecrets() RenderOption {
+	return func(o *renderOptions) {
+		o.secrets = true
+	}
+}
+
+// Render renders the given snapshots, keyed by node ID, in the given format. The
+// resources of each type are sorted by name, so the same snapshots always render
+// the same way. Private keys and secrets are redacted unless WithSecrets is given.
+func Render(snapshots map[string]*cache.Snapshot, format Format, opts ...RenderOption) ([]byte, error) {
+	var o renderOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	nodes := make(map[string]node, len(snapshots))
+	for nodeID, snapshot := range snapshots {
+		n := node{Version: snapshot.GetVersion(resource.ListenerType)}
+		for _, r := range []struct {
+			into    *[]json.RawMessage
+			typeURL string
+		}{
+			{&n.Listeners, resource.ListenerType},
+			{&n.Routes, resource.RouteType},
+			{&n.Clusters, resource.ClusterType},
+			{&n.Endpoints, resource.EndpointType},
+			{&n.Secrets, resource.SecretType},
+		} {
+			var err error
+			if *r.into, err = marshalResources(snapshot.GetResources(r.typeURL), o.secrets); err != nil {
+				return nil, fmt.Errorf("failed to render snapshot of node %q: %w", nodeID, err)
+			}
+		}
+		nodes[nodeID] = n
+	}
+
+	// Re-encoding the resources normalizes the whitespace protojson emits, which
+	// is deliberately unstable.
+	out, err := json.MarshalIndent(nodes, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatJSON:
+		return append(out, '\n'), nil
+	case FormatYAML:
+		return yaml.JSONToYAML(out)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func marshalResources(resources map[string]cachetypes.Resource, secrets bool) ([]json.RawMessage, error) {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]json.RawMessage, 0, len(names))
+	for _, name := range names {
+		r := resources[name]
+		if !secrets {
+			// The resources are shared with the snapshot, so redact a copy.
+			r = proto.Clone(r)
+			if err := envoy.RedactSecrets(r); err != nil {
+				return nil, fmt.Errorf("failed to redact %q: %w", name, err)
+			}
+		}
+		b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %q: %w", name, err)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package translate renders the Envoy configuration Kourier generates for a set
+// of Kubernetes manifests without a cluster.
+package translate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+
+	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/fake"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"knative.dev/net-kourier/pkg/generator"
+	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
+	"knative.dev/networking/pkg/apis/networking"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	networkingscheme "knative.dev/networking/pkg/client/clientset/versioned/scheme"
+	netconfig "knative.dev/networking/pkg/config"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/system"
+	"knative.dev/pkg/tracker"
+)
+
+var decoder = newDecoder()
+
+func newDecoder() runtime.Decoder {
+	scheme := runtime.NewScheme()
+	if err := kubescheme.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	if err := networkingscheme.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	return serializer.NewCodecFactory(scheme).UniversalDeserializer()
+}
+
+// Decode reads all objects of the given stream of YAML or JSON documents.
+func Decode(r io.Reader) ([]runtime.Object, error) {
+	reader := yaml.NewYAMLReader(bufio.NewReader(r))
+
+	var objects []runtime.Object
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read document: %w", err)
+		}
+
+		// Skip documents that only consist of comments or whitespace.
+		if obj, err := yaml.ToJSON(doc); err != nil {
+			return nil, fmt.Errorf("failed to parse document: %w", err)
+		} else if string(obj) == "null" {
+			continue
+		}
+
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode document: %w", err)
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// Snapshots translates the Kourier ingresses among the given objects into the
+// snapshots of each fleet of gateways, keyed by the fleet's node ID.
+//
+// The config-kourier and config-network ConfigMaps among the objects configure
+// the translation. Defaults are used for missing ones. All other objects, like
+// Services, EndpointSlices, Endpoints and Secrets, are what the ingresses are
+// resolved against, as if they were in a cluster. Ingresses are added in the
+// order of their names, so the ones conflicting with an earlier ingress are
+// skipped.
+//
+// The system namespace has to be set, as it is when running the controller.
+func Snapshots(ctx context.Context, objects []runtime.Object) (map[string]*cache.Snapshot, error) {
+	logger := logging.FromContext(ctx)
+
+	cfg := &config.Config{}
+	var (
+		ingresses []*v1alpha1.Ingress
+		state     []runtime.Object
+	)
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *v1alpha1.Ingress:
+			ingresses = append(ingresses, o.DeepCopy())
+		case *corev1.ConfigMap:
+			var err error
+			switch o.Name {
+			case config.ConfigName:
+				cfg.Kourier, err = config.NewKourierConfigFromConfigMap(o)
+			case netconfig.ConfigMapName:
+				cfg.Network, err = netconfig.NewConfigFromConfigMap(o)
+			default:
+				state = append(state, o)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse ConfigMap %s: %w", o.Name, err)
+			}
+		case *corev1.Endpoints: //nolint:staticcheck // Endpoints are still common in bug reports.
+			for _, slice := range endpointSlices(o) {
+				state = append(state, slice)
+			}
+		default:
+			state = append(state, obj)
+		}
+	}
+
+	var err error
+	if cfg.Kourier == nil {
+		if cfg.Kourier, err = config.NewKourierConfigFromMap(nil); err != nil {
+			return nil, fmt.Errorf("failed to default %s: %w", config.ConfigName, err)
+		}
+	}
+	if cfg.Network == nil {
+		if cfg.Network, err = netconfig.NewConfigFromMap(nil); err != nil {
+			return nil, fmt.Errorf("failed to default %s: %w", netconfig.ConfigMapName, err)
+		}
+	}
+	ctx = config.ToContext(ctx, cfg)
+
+	kubeClient := fake.NewSimpleClientset(state...)
+	endpointSlicesGetter := func(ns, name string) ([]*discoveryv1.EndpointSlice, error) {
+		slices, err := kubeClient.DiscoveryV1().EndpointSlices(ns).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: name}).String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		res := make([]*discoveryv1.EndpointSlice, 0, len(slices.Items))
+		for i := range slices.Items {
+			res = append(res, &slices.Items[i])
+		}
+		return res, nil
+	}
+	translator := generator.NewIngressTranslator(
+		func(ns, name string) (*corev1.Secret, error) {
+			return kubeClient.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(label string) ([]*corev1.ConfigMap, error) {
+			req, err := labels.NewRequirement(label, selection.Exists, nil)
+			if err != nil {
+				return nil, err
+			}
+			cms, err := kubeClient.CoreV1().ConfigMaps(system.Namespace()).List(ctx, metav1.ListOptions{
+				LabelSelector: labels.NewSelector().Add(*req).String(),
+			})
+			if err != nil {
+				return nil, err
+			}
+			res := make([]*corev1.ConfigMap, 0, len(cms.Items))
+			for i := range cms.Items {
+				res = append(res, &cms.Items[i])
+			}
+			return res, nil
+		},
+		endpointSlicesGetter,
+		func(ns, name string) (*corev1.Service, error) {
+			return kubeClient.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
+		},
+		noopTracker{},
+	)
+
+	caches, err := generator.NewCaches(ctx, kubeClient, endpointSlicesGetter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create caches: %w", err)
+	}
+
+	sort.Slice(ingresses, func(i, j int) bool {
+		return types.NamespacedName{Namespace: ingresses[i].Namespace, Name: ingresses[i].Name}.String() <
+			types.NamespacedName{Namespace: ingresses[j].Namespace, Name: ingresses[j].Name}.String()
+	})
+	for _, ing := range ingresses {
+		if class := ing.Annotations[networking.IngressClassAnnotationKey]; class != "" && class != config.KourierIngressClassName {
+			logger.Infof("Skipping ingress %s/%s of class %q", ing.Namespace, ing.Name, class)
+			continue
+		}
+
+		ing.SetDefaults(ctx)
+		err := generator.UpdateInfoForIngress(ctx, caches, ing, &translator, cfg.Kourier.ExternalAuthz.Enabled)
+		if errors.Is(err, generator.ErrDomainConflict) {
+			logger.Warnf("Skipping ingress %s/%s: %v", ing.Namespace, ing.Name, err)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to translate ingress %s/%s: %w", ing.Namespace, ing.Name, err)
+		}
+	}
+
+	return caches.ToEnvoySnapshots(ctx)
+}
+
+// endpointSlices converts the given legacy Endpoints into the EndpointSlices the
+// EndpointSlice controller would create for them, one per subset and address
+// family.
+func endpointSlices(eps *corev1.Endpoints) []*discoveryv1.EndpointSlice { //nolint:staticcheck // Endpoints are still common in bug reports.
+	var slices []*discoveryv1.EndpointSlice
+	for i, subset := range eps.Subsets {
+		ports := make([]discoveryv1.EndpointPort, 0, len(subset.Ports))
+		for _, p := range subset.Ports {
+			ports = append(ports, discoveryv1.EndpointPort{
+				Name:     ptr.To(p.Name),
+				Port:     ptr.To(p.Port),
+				Protocol: ptr.To(p.Protocol),
+			})
+		}
+
+		byFamily := make(map[discoveryv1.AddressType][]discoveryv1.Endpoint)
+		add := func(addresses []corev1.EndpointAddress, ready bool) {
+			for _, a := range addresses {
+				addressType := discoveryv1.AddressTypeIPv4
+				if ip := net.ParseIP(a.IP); ip != nil && ip.To4() == nil {
+					addressType = discoveryv1.AddressTypeIPv6
+				}
+				byFamily[addressType] = append(byFamily[addressType], discoveryv1.Endpoint{
+					Addresses:  []string{a.IP},
+					Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(ready)},
+					NodeName:   a.NodeName,
+				})
+			}
+		}
+		add(subset.Addresses, true)
+		add(subset.NotReadyAddresses, false)
+
+		for _, addressType := range []discoveryv1.AddressType{discoveryv1.AddressTypeIPv4, discoveryv1.AddressTypeIPv6} {
+			endpoints, ok := byFamily[addressType]
+			if !ok {
+				continue
+			}
+			slices = append(slices, &discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: eps.Namespace,
+					Name:      fmt.Sprintf("%s-%d-%s", eps.Name, i, addressType),
+					Labels:    map[string]string{discoveryv1.LabelServiceName: eps.Name},
+				},
+				AddressType: addressType,
+				Endpoints:   endpoints,
+				Ports:       ports,
+			})
+		}
+	}
+	return slices
+}
+
+// noopTracker ignores all references, as there are no changes to react to offline.
+type noopTracker struct{}
+
+var _ tracker.Interface = noopTracker{}
+
+func (noopTracker) Track(corev1.ObjectReference, interface{}) error     { return nil }
+func (noopTracker) TrackReference(tracker.Reference, interface{}) error { return nil }
+func (noopTracker) OnChanged(interface{})                               {}
+func (noopTracker) GetObservers(interface{}) []types.NamespacedName     { return nil }
+func (noopTracker) OnDeletedObserver(interface{})                       {}
@@ -0,0 +1,199 @@
+/*
+Copyright 2025 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package translate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"knative.dev/net-kourier/pkg/reconciler/ingress/config"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+
+	_ "knative.dev/pkg/system/testing"
+)
+
+const manifests = `
+# A leading comment only document.
+---
+apiVersion: networking.internal.knative.dev/v1alpha1
+kind: Ingress
+metadata:
+  name: hello
+  namespace: default
+spec:
+  rules:
+  - hosts: [hello.default.example.com]
+    visibility: ExternalIP
+    http:
+      paths:
+      - splits:
+        - serviceName: hello
+          serviceNamespace: default
+          servicePort: 80
+          percent: 100
+---
+apiVersion: networking.internal.knative.dev/v1alpha1
+kind: Ingress
+metadata:
+  name: later
+  namespace: default
+spec:
+  rules:
+  - hosts: [hello.default.example.com]
+    visibility: ExternalIP
+    http:
+      paths:
+      - splits:
+        - serviceName: hello
+          serviceNamespace: default
+          servicePort: 80
+          percent: 100
+---
+apiVersion: networking.internal.knative.dev/v1alpha1
+kind: Ingress
+metadata:
+  name: other-class
+  namespace: default
+  annotations:
+    networking.knative.dev/ingress.class: istio.ingress.networking.knative.dev
+spec:
+  rules:
+  - hosts: [other.default.example.com]
+    visibility: ExternalIP
+    http:
+      paths:
+      - splits:
+        - serviceName: hello
+          serviceNamespace: default
+          servicePort: 80
+          percent: 100
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: hello
+  namespace: default
+spec:
+  ports:
+  - name: http
+    port: 80
+    targetPort: 8080
+---
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: hello
+  namespace: default
+subsets:
+- addresses: [{ip: 10.0.0.1}]
+  ports: [{name: http, port: 8080}]
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-kourier
+  namespace: knative-serving
+data:
+  enable-service-access-logging: "false"
+`
+
+func TestDecode(t *testing.T) {
+	objects, err := Decode(strings.NewReader(manifests))
+	assert.NilError(t, err)
+	assert.Equal(t, len(objects), 6)
+
+	ing, ok := objects[0].(*v1alpha1.Ingress)
+	assert.Assert(t, ok)
+	assert.Equal(t, ing.Name, "hello")
+
+	_, err = Decode(strings.NewReader("apiVersion: v1\nkind: Unknown\n"))
+	assert.ErrorContains(t, err, "failed to decode document")
+}
+
+func TestSnapshots(t *testing.T) {
+	objects, err := Decode(strings.NewReader(manifests))
+	assert.NilError(t, err)
+
+	snapshots, err := Snapshots(context.Background(), objects)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snapshots), 1)
+	snapshot := snapshots[config.DefaultGatewayNodeID]
+	assert.Assert(t, snapshot != nil)
+
+	// Only the first of the conflicting ingresses and none of another class are translated.
+	external := snapshot.GetResources(resource.RouteType)["external_services"].(*route.RouteConfiguration)
+	var names []string
+	for _, vhost := range external.GetVirtualHosts() {
+		names = append(names, vhost.GetName())
+	}
+	assert.DeepEqual(t, names, []string{"(default/hello).Rules[0]"})
+
+	assert.Equal(t, len(snapshot.GetResources(resource.EndpointType)), 1)
+
+	// Rendering is stable and honors config-kourier.
+	first, err := Render(snapshots, FormatJSON)
+	assert.NilError(t, err)
+	second, err := Render(snapshots, FormatJSON)
+	assert.NilError(t, err)
+	assert.Equal(t, string(first), string(second))
+	assert.Assert(t, !strings.Contains(string(first), "access_log"))
+
+	_, err = Render(snapshots, Format("xml"))
+	assert.ErrorContains(t, err, "unknown format")
+}
+
+func TestEndpointSlices(t *testing.T) {
+	eps := &corev1.Endpoints{ //nolint:staticcheck // Endpoints are still common in bug reports.
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "svc"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "fd00::1"}},
+			NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+			Ports:             []corev1.EndpointPort{{Name: "http", Port: 8080, Protocol: corev1.ProtocolTCP}},
+		}},
+	}
+	ports := []discoveryv1.EndpointPort{{Name: ptr.To("http"), Port: ptr.To[int32](8080), Protocol: ptr.To(corev1.ProtocolTCP)}}
+	labels := map[string]string{discoveryv1.LabelServiceName: "svc"}
+
+	assert.DeepEqual(t, endpointSlices(eps), []*discoveryv1.EndpointSlice{{
+		ObjectMeta:  metav1.ObjectMeta{Namespace: "ns", Name: "svc-0-IPv4", Labels: labels},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+		}, {
+			Addresses:  []string{"10.0.0.2"},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(false)},
+		}},
+		Ports: ports,
+	}, {
+		ObjectMeta:  metav1.ObjectMeta{Namespace: "ns", Name: "svc-0-IPv6", Labels: labels},
+		AddressType: discoveryv1.AddressTypeIPv6,
+		Endpoints: []discoveryv1.Endpoint{{
+			Addresses:  []string{"fd00::1"},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+		}},
+		Ports: ports,
+	}})
+}